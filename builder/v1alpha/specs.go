@@ -23,12 +23,12 @@ import (
 
 // DockerBuildRequest represents a request a build request using docker
 type DockerBuildRequest struct {
-	Dockerfile     string               `yaml:"dockerfile"`             // Dockerfile is the contents of the Dockerfile
-	DockerIgnore   string               `yaml:"dockerignore,omitempty"` // DockerIgnore is the contents of the .dockerignore file
-	Tags           []string             `yaml:"tags,omitempty"`         // Tags are tags to apply to the built docker image
-	BuildArgs      map[string]string    `yaml:"buildargs,omitempty"`    // BuildArgs are arguments to pass while building the docker image
-	ExtraFiles     common.EmbeddedFiles `yaml:"files, omitempty"`       // ExtraFiles are files to include in the docker build process
-	BuildDirectory string               `yaml:"buildDirectory"`         // BuildDirectory is the output directory where built files are generated
+	Dockerfile     string               `yaml:"dockerfile" json:"dockerfile"`                         // Dockerfile is the contents of the Dockerfile
+	DockerIgnore   string               `yaml:"dockerignore,omitempty" json:"dockerignore,omitempty"` // DockerIgnore is the contents of the .dockerignore file
+	Tags           []string             `yaml:"tags,omitempty" json:"tags,omitempty"`                 // Tags are tags to apply to the built docker image
+	BuildArgs      map[string]string    `yaml:"buildargs,omitempty" json:"buildargs,omitempty"`       // BuildArgs are arguments to pass while building the docker image
+	ExtraFiles     common.EmbeddedFiles `yaml:"files,omitempty" json:"files,omitempty"`               // ExtraFiles are files to include in the docker build process
+	BuildDirectory string               `yaml:"buildDirectory" json:"buildDirectory"`                 // BuildDirectory is the output directory where built files are generated
 }
 
 // BuiltFile represents a built file
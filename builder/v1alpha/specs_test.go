@@ -13,3 +13,62 @@
 // limitations under the License.
 
 package v1alpha
+
+import (
+	"encoding/json"
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	"github.com/limejuice-cc/api/helper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDockerBuildRequestEncodings(t *testing.T) {
+	request := &DockerBuildRequest{
+		Dockerfile:     "FROM scratch\nCOPY tool /usr/bin/tool\n",
+		DockerIgnore:   "*.tmp\n",
+		Tags:           []string{"tool:1.0.0", "tool:latest"},
+		BuildArgs:      map[string]string{"VERSION": "1.0.0"},
+		ExtraFiles:     common.EmbeddedFiles{"tool": common.EmbeddedFileContents("#!/bin/sh\necho tool\n")},
+		BuildDirectory: "/build/out",
+	}
+	keys := []string{"buildDirectory", "buildargs", "dockerfile", "dockerignore", "files", "tags"}
+
+	encodings := []struct {
+		name      string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+	}{
+		{"yaml", yaml.Marshal, yaml.Unmarshal},
+		{"json", json.Marshal, json.Unmarshal},
+		{"toml", helper.MarshalTOML, helper.UnmarshalTOML},
+	}
+	for _, e := range encodings {
+		encoded, err := e.marshal(request)
+		if !assert.NoError(t, err, e.name) {
+			continue
+		}
+		var decoded DockerBuildRequest
+		if assert.NoError(t, e.unmarshal(encoded, &decoded), e.name) {
+			assert.Equal(t, request, &decoded, e.name)
+		}
+		var document map[string]interface{}
+		if assert.NoError(t, e.unmarshal(encoded, &document), e.name) {
+			var actual []string
+			for key := range document {
+				actual = append(actual, key)
+			}
+			assert.ElementsMatch(t, keys, actual, e.name)
+		}
+
+		encoded, err = e.marshal(&DockerBuildRequest{Dockerfile: request.Dockerfile, BuildDirectory: request.BuildDirectory})
+		if assert.NoError(t, err, e.name) {
+			document = map[string]interface{}{}
+			if assert.NoError(t, e.unmarshal(encoded, &document), e.name) {
+				assert.Len(t, document, 2, e.name)
+				assert.NotContains(t, document, "files", e.name)
+			}
+		}
+	}
+}
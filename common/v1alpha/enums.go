@@ -180,3 +180,51 @@ func (o *OperatingSystem) UnmarshalText(text []byte) error {
 	*o = tmp
 	return nil
 }
+
+// *** VersionScheme ***
+
+// VersionScheme specifies how versions are parsed and ordered
+type VersionScheme int
+
+const (
+	_ VersionScheme = iota
+	// SemanticVersioning specifies strict semantic versioning 2.0
+	SemanticVersioning
+	// DebianVersioning specifies lenient debian style versions with epochs and revisions
+	DebianVersioning
+)
+
+var versionSchemeValues = helper.EnumeratorValues{
+	"semver": SemanticVersioning,
+	"debian": DebianVersioning,
+}
+
+// String implements the Stringer interface.
+func (s VersionScheme) String() string {
+	return versionSchemeValues.AsString(s)
+}
+
+// ParseVersionScheme attempts to convert a string to a VersionScheme
+func ParseVersionScheme(name string) (VersionScheme, error) {
+	x, err := versionSchemeValues.Parse(name)
+	if err != nil {
+		return VersionScheme(0), err
+	}
+	return x.(VersionScheme), nil
+}
+
+// MarshalText implements the text marshaller method
+func (s VersionScheme) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (s *VersionScheme) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseVersionScheme(name)
+	if err != nil {
+		return err
+	}
+	*s = tmp
+	return nil
+}
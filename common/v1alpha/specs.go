@@ -16,6 +16,7 @@ package v1alpha
 
 import (
 	"encoding/ascii85"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -26,21 +27,147 @@ type Architectures []Architecture
 
 // Version represents the version of a lime package
 type Version struct {
-	Major int    // Major is the package's major version
-	Minor int    // Minor is the package's minor version
-	Patch int    // Patch is the package's patch version
-	Tag   string // Tag is the package version's tag
+	Major    int           `yaml:"major" json:"major"`                           // Major is the package's major version
+	Minor    int           `yaml:"minor" json:"minor"`                           // Minor is the package's minor version
+	Patch    int           `yaml:"patch" json:"patch"`                           // Patch is the package's patch version
+	Tag      string        `yaml:"tag" json:"tag"`                               // Tag is the package version's tag
+	Build    string        `yaml:"build,omitempty" json:"build,omitempty"`       // Build is the version's build metadata, it is ignored when ordering versions
+	Epoch    int           `yaml:"epoch,omitempty" json:"epoch,omitempty"`       // Epoch is the debian epoch of the version
+	Revision string        `yaml:"revision,omitempty" json:"revision,omitempty"` // Revision is the debian revision of the version
+	Upstream string        `yaml:"upstream,omitempty" json:"upstream,omitempty"` // Upstream is the debian upstream version as it was parsed, it is printed and compared instead of the major, minor and patch version and tag
+	Scheme   VersionScheme `yaml:"scheme,omitempty" json:"scheme,omitempty"`     // Scheme is the versioning scheme of the version
 }
 
 func (v *Version) String() string {
+	if v.Scheme == DebianVersioning {
+		o := v.debianUpstream()
+		if v.Epoch != 0 {
+			o = fmt.Sprintf("%d:%s", v.Epoch, o)
+		}
+		if v.Revision != "" {
+			o = fmt.Sprintf("%s-%s", o, v.Revision)
+		}
+		return o
+	}
+
 	o := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
 	if v.Tag != "" {
-		return fmt.Sprintf("%s-%s", o, v.Tag)
+		o = fmt.Sprintf("%s-%s", o, v.Tag)
+	}
+	if v.Build != "" {
+		o = fmt.Sprintf("%s+%s", o, v.Build)
 	}
 	return o
 }
 
-// ParseVersion parses a version
+// debianUpstream returns the debian upstream version, which is built from the major, minor and patch version and tag
+// if the version was not parsed from a debian version
+func (v *Version) debianUpstream() string {
+	if v.Upstream != "" {
+		return v.Upstream
+	}
+	return fmt.Sprintf("%d.%d.%d%s", v.Major, v.Minor, v.Patch, v.Tag)
+}
+
+// Valid checks if the version is valid for its versioning scheme
+func (v *Version) Valid() error {
+	if v.Major < 0 || v.Minor < 0 || v.Patch < 0 || v.Epoch < 0 {
+		return fmt.Errorf("invalid version %s", v.String())
+	}
+	if v.Scheme != DebianVersioning && (v.Epoch != 0 || v.Revision != "" || v.Upstream != "") {
+		return fmt.Errorf("invalid version %s epoch, revision and upstream require debian versioning", v.String())
+	}
+	_, err := ParseVersionWithScheme(v.String(), v.Scheme)
+	return err
+}
+
+// Compare compares the version to other returning -1 if it is lower, 0 if it is equal and 1 if it is higher.
+// Versions are ordered by epoch, major, minor and patch version, build metadata is ignored.
+//
+// When either version uses debian versioning the versions are ordered by epoch, upstream version and revision
+// instead. The upstream version and revision are compared using the debian ordering in which a tilde sorts before
+// anything, even the end of the version, so that 1.2~rc1 < 1.2 < 1.2.0.
+//
+// Otherwise a version with a tag is a pre-release that is lower than the same version without a tag. Tags are
+// compared by their dot separated identifiers, identifiers consisting only of digits are compared numerically and
+// are lower than other identifiers which are compared lexically. A tag with fewer identifiers is lower if all
+// preceding identifiers are equal.
+func (v *Version) Compare(other *Version) int {
+	if v.Scheme == DebianVersioning || other.Scheme == DebianVersioning {
+		if v.Epoch != other.Epoch {
+			return compareInts(v.Epoch, other.Epoch)
+		}
+		if c := compareDebianStrings(v.debianUpstream(), other.debianUpstream()); c != 0 {
+			return c
+		}
+		return compareDebianStrings(v.Revision, other.Revision)
+	}
+
+	for _, c := range [][2]int{{v.Epoch, other.Epoch}, {v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if c[0] != c[1] {
+			return compareInts(c[0], c[1])
+		}
+	}
+
+	switch {
+	case v.Tag == other.Tag:
+		return 0
+	case v.Tag == "":
+		return 1
+	case other.Tag == "":
+		return -1
+	}
+
+	a, b := strings.Split(v.Tag, "."), strings.Split(other.Tag, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareTagIdentifiers(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// Less returns true if the version is lower than other
+func (v *Version) Less(other *Version) bool {
+	return v.Compare(other) < 0
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumeric(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func compareTagIdentifiers(a, b string) int {
+	numericA, numericB := isNumeric(a), isNumeric(b)
+	switch {
+	case numericA && numericB:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			return compareInts(len(a), len(b))
+		}
+	case numericA:
+		return -1
+	case numericB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// ParseVersion parses a version leniently, missing minor and patch versions default to zero
 func ParseVersion(v string) (*Version, error) {
 	if strings.HasPrefix(v, "v") {
 		v = v[1:]
@@ -50,7 +177,12 @@ func ParseVersion(v string) (*Version, error) {
 	}
 
 	parsed := &Version{}
-	parts := strings.SplitN(v, "-", 2)
+	parts := strings.SplitN(v, "+", 2)
+	if len(parts) > 1 {
+		parsed.Build = parts[1]
+	}
+
+	parts = strings.SplitN(parts[0], "-", 2)
 	if len(parts) > 1 {
 		parsed.Tag = parts[1]
 	}
@@ -90,17 +222,42 @@ func (v *Version) MarshalText() ([]byte, error) {
 	return []byte(v.String()), nil
 }
 
-// UnmarshalText implements the text unmarshaller method
+// UnmarshalText implements the text unmarshaller method. Versions are parsed leniently by ParseVersion, versions it
+// cannot parse such as debian versions with an epoch are parsed as debian versions. Documents that declare a version
+// scheme, such as package manifests, parse the version text again using their scheme.
 func (v *Version) UnmarshalText(text []byte) error {
 	value := string(text)
 	tmp, err := ParseVersion(value)
 	if err != nil {
-		return err
+		var debianErr error
+		if tmp, debianErr = ParseDebianVersion(value); debianErr != nil {
+			return err
+		}
 	}
-	v = tmp
+	*v = *tmp
 	return nil
 }
 
+// MarshalJSON implements the json marshaller method, versions are encoded as objects like in yaml documents
+func (v Version) MarshalJSON() ([]byte, error) {
+	type plain Version
+	return json.Marshal(plain(v))
+}
+
+// UnmarshalJSON implements the json unmarshaller method, versions are decoded from objects or from strings like in
+// yaml documents
+func (v *Version) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		return v.UnmarshalText([]byte(text))
+	}
+	type plain Version
+	return json.Unmarshal(data, (*plain)(v))
+}
+
 // EmbeddedFileContents represents the contents of an embedded file
 type EmbeddedFileContents []byte
 
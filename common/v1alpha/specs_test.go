@@ -16,6 +16,7 @@ package v1alpha
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,11 +28,11 @@ func TestParseVersion(t *testing.T) {
 		value   string
 		outcome Version
 	}{
-		{"v1.2.0", Version{1, 2, 0, ""}},
-		{"v1.2", Version{1, 2, 0, ""}},
-		{"v1", Version{1, 0, 0, ""}},
-		{"1.2.0", Version{1, 2, 0, ""}},
-		{"v1.2.0-test", Version{1, 2, 0, "test"}},
+		{"v1.2.0", Version{Major: 1, Minor: 2, Patch: 0, Tag: ""}},
+		{"v1.2", Version{Major: 1, Minor: 2, Patch: 0, Tag: ""}},
+		{"v1", Version{Major: 1, Minor: 0, Patch: 0, Tag: ""}},
+		{"1.2.0", Version{Major: 1, Minor: 2, Patch: 0, Tag: ""}},
+		{"v1.2.0-test", Version{Major: 1, Minor: 2, Patch: 0, Tag: "test"}},
 	}
 
 	for _, v := range testValues {
@@ -54,6 +55,13 @@ func TestParseVersion(t *testing.T) {
 		assert.Equal(t, "v1.0.0-test", ver.String())
 	}
 
+	ver, err = ParseVersion("1.0.0-test+build.5")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test", ver.Tag)
+		assert.Equal(t, "build.5", ver.Build)
+		assert.Equal(t, "v1.0.0-test+build.5", ver.String())
+	}
+
 	for _, v := range []string{"", "x2e", "1.x", "1.1.x"} {
 		_, err := ParseVersion(v)
 		assert.Error(t, err)
@@ -62,11 +70,173 @@ func TestParseVersion(t *testing.T) {
 	assert.Error(t, yaml.Unmarshal([]byte("[1,2,3]"), &ver))
 	assert.Error(t, yaml.Unmarshal([]byte("NONEn"), &ver))
 	assert.NoError(t, yaml.Unmarshal([]byte("v1.0.0-test"), &ver))
+	assert.Equal(t, "v1.0.0-test", ver.String())
 
 	_, err = yaml.Marshal(&ver)
 	assert.NoError(t, err)
 }
 
+func TestParseSemanticVersion(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome Version
+	}{
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"v1.2.3", Version{Major: 1, Minor: 2, Patch: 3}},
+		{"1.0.0-alpha.1", Version{Major: 1, Tag: "alpha.1"}},
+		{"1.0.0-0.3.7", Version{Major: 1, Tag: "0.3.7"}},
+		{"1.0.0-x-y-z.--", Version{Major: 1, Tag: "x-y-z.--"}},
+		{"1.0.0+20130313144700", Version{Major: 1, Build: "20130313144700"}},
+		{"1.0.0-beta+exp.sha.5114f85", Version{Major: 1, Tag: "beta", Build: "exp.sha.5114f85"}},
+		{"1.0.0+21AF26D3----117B344092BD", Version{Major: 1, Build: "21AF26D3----117B344092BD"}},
+	}
+
+	for _, v := range testValues {
+		ver, err := ParseSemanticVersion(v.value)
+		if assert.NoError(t, err, v.value) {
+			v.outcome.Scheme = SemanticVersioning
+			assert.Equal(t, v.outcome, *ver)
+			assert.NoError(t, ver.Valid())
+		}
+	}
+
+	for _, v := range []string{"", "1", "1.2", "01.2.3", "1.02.3", "1.2.03", "1.2.3-01", "1.2.3-", "1.2.3+", "1.2.3-a..b", "1.2.3+a_b", "1:1.2.3"} {
+		_, err := ParseSemanticVersion(v)
+		assert.Error(t, err, v)
+	}
+
+	a, _ := ParseSemanticVersion("1.0.0+build.1")
+	b, _ := ParseSemanticVersion("1.0.0+build.2")
+	assert.Equal(t, 0, a.Compare(b))
+}
+
+func TestParseDebianVersion(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome Version
+		str     string
+	}{
+		{"1", Version{Major: 1, Upstream: "1"}, "1"},
+		{"1.2.3", Version{Major: 1, Minor: 2, Patch: 3, Upstream: "1.2.3"}, "1.2.3"},
+		{"2:1.2.3-1", Version{Epoch: 2, Major: 1, Minor: 2, Patch: 3, Revision: "1", Upstream: "1.2.3"}, "2:1.2.3-1"},
+		{"1.2.3~rc1-0ubuntu1", Version{Major: 1, Minor: 2, Patch: 3, Tag: "~rc1", Revision: "0ubuntu1", Upstream: "1.2.3~rc1"}, "1.2.3~rc1-0ubuntu1"},
+		{"1.2+dfsg-2", Version{Major: 1, Minor: 2, Tag: "+dfsg", Revision: "2", Upstream: "1.2+dfsg"}, "1.2+dfsg-2"},
+		{"2.30+dfsg-1", Version{Major: 2, Minor: 30, Tag: "+dfsg", Revision: "1", Upstream: "2.30+dfsg"}, "2.30+dfsg-1"},
+		{"1:2.0~rc1-2", Version{Epoch: 1, Major: 2, Tag: "~rc1", Revision: "2", Upstream: "2.0~rc1"}, "1:2.0~rc1-2"},
+		{"1.2.3.4", Version{Major: 1, Minor: 2, Patch: 3, Tag: ".4", Upstream: "1.2.3.4"}, "1.2.3.4"},
+		{"1.2_3-4.el8_3", Version{Major: 1, Minor: 2, Tag: "_3", Revision: "4.el8_3", Upstream: "1.2_3"}, "1.2_3-4.el8_3"},
+		{"2.0-beta-1", Version{Major: 2, Tag: "-beta", Revision: "1", Upstream: "2.0-beta"}, "2.0-beta-1"},
+		{"1.2-3-4", Version{Major: 1, Minor: 2, Tag: "-3", Revision: "4", Upstream: "1.2-3"}, "1.2-3-4"},
+		{"1:2.0:1-1", Version{Epoch: 1, Major: 2, Tag: ":1", Revision: "1", Upstream: "2.0:1"}, "1:2.0:1-1"},
+	}
+
+	for _, v := range testValues {
+		ver, err := ParseDebianVersion(v.value)
+		if assert.NoError(t, err, v.value) {
+			v.outcome.Scheme = DebianVersioning
+			assert.Equal(t, v.outcome, *ver)
+			assert.Equal(t, v.str, ver.String())
+			assert.NoError(t, ver.Valid())
+		}
+	}
+
+	for _, v := range []string{"", "v1.2.3", "a:1.2.3", "1.2.3-", "1.2.3-1/1", "1.2.3/1", "-1:1.2", "1:-1", "1.2-beta-"} {
+		_, err := ParseDebianVersion(v)
+		assert.Error(t, err, v)
+	}
+
+	ordered := []string{"1.0~~", "1.0~~a", "1.0~", "1.0", "1.0-1", "1.0-1.1", "1.0-2", "1.0-10", "1.0a", "1.0+dfsg", "1.0.0", "1.1", "1.2", "1.2.0", "1.2.0.1", "1:0.1"}
+	for i, a := range ordered {
+		va, err := ParseDebianVersion(a)
+		if !assert.NoError(t, err, a) {
+			continue
+		}
+		for j, b := range ordered {
+			vb, err := ParseDebianVersion(b)
+			if assert.NoError(t, err, b) {
+				assert.Equal(t, compareInts(i, j), va.Compare(vb), "%s compared to %s", a, b)
+			}
+		}
+	}
+
+	ver, err := ParseVersionWithScheme("1:1.0-1", DebianVersioning)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, ver.Epoch)
+	}
+	_, err = ParseVersionWithScheme("1:1.0-1", SemanticVersioning)
+	assert.Error(t, err)
+	assert.Error(t, (&Version{Major: 1, Epoch: 1}).Valid())
+	assert.Error(t, (&Version{Major: 1, Upstream: "1"}).Valid())
+
+	built := Version{Major: 1, Minor: 2, Tag: "~rc1", Revision: "1", Scheme: DebianVersioning}
+	assert.Equal(t, "1.2.0~rc1-1", built.String())
+	parsed, err := ParseDebianVersion("1.2.0~rc1-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, built.Compare(parsed))
+	}
+}
+
+func TestParseVersionScheme(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome VersionScheme
+	}{
+		{"semver", SemanticVersioning},
+		{"debian", DebianVersioning},
+	}
+
+	for _, v := range testValues {
+		s, err := ParseVersionScheme(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, s)
+			assert.Equal(t, v.value, s.String())
+		}
+	}
+
+	_, err := ParseVersionScheme("")
+	assert.Error(t, err)
+
+	var vs VersionScheme
+	assert.Error(t, yaml.Unmarshal([]byte("unknown"), &vs))
+	assert.NoError(t, yaml.Unmarshal([]byte("debian"), &vs))
+}
+
+func TestCompareVersion(t *testing.T) {
+	ordered := []string{
+		"v0.9.9",
+		"v1.0.0-1",
+		"v1.0.0-2",
+		"v1.0.0-10",
+		"v1.0.0-alpha",
+		"v1.0.0-alpha.1",
+		"v1.0.0-alpha.beta",
+		"v1.0.0-beta",
+		"v1.0.0-beta.2",
+		"v1.0.0-beta.11",
+		"v1.0.0-rc.1",
+		"v1.0.0",
+		"v1.0.1",
+		"v1.1.0",
+		"v2.0.0",
+	}
+
+	for i, a := range ordered {
+		va, err := ParseVersion(a)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for j, b := range ordered {
+			vb, err := ParseVersion(b)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			expected := compareInts(i, j)
+			assert.Equal(t, expected, va.Compare(vb), "%s compared to %s", a, b)
+			assert.Equal(t, expected < 0, va.Less(vb), "%s less than %s", a, b)
+		}
+	}
+}
+
 func TestParseArchitecture(t *testing.T) {
 	var testValues = []struct {
 		value   string
@@ -177,3 +347,23 @@ func TestEmbeddedFileContents(t *testing.T) {
 	assert.Error(t, yaml.Unmarshal([]byte("[1,2,3"), &c))
 	assert.Error(t, yaml.Unmarshal([]byte("!!!!!>>>>"), &c))
 }
+
+func TestVersionJSON(t *testing.T) {
+	v := Version{Major: 1, Minor: 2, Patch: 3, Tag: "rc.1", Build: "abc"}
+	out, err := json.Marshal(&v)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"major": 1, "minor": 2, "patch": 3, "tag": "rc.1", "build": "abc"}`, string(out))
+		var decoded Version
+		if assert.NoError(t, json.Unmarshal(out, &decoded)) {
+			assert.Equal(t, v, decoded)
+		}
+	}
+
+	var decoded Version
+	if assert.NoError(t, json.Unmarshal([]byte(`"v1.2.3-rc.1+abc"`), &decoded)) {
+		assert.Equal(t, v, decoded)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`"dead beef"`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"major": "one"}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"scheme": "unknown"}`), &decoded))
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	semanticVersionPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+		`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+		`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+	debianEpochPattern    = regexp.MustCompile(`^\d+$`)
+	debianUpstreamPattern = regexp.MustCompile(`^(\d+)(?:\.(\d+))?(?:\.(\d+))?([A-Za-z0-9.+~_:-]*)$`)
+	debianRevisionPattern = regexp.MustCompile(`^[A-Za-z0-9.+~_]+$`)
+)
+
+// ParseVersionWithScheme parses a version using the given versioning scheme. Versions without a scheme are parsed
+// leniently by ParseVersion.
+func ParseVersionWithScheme(v string, scheme VersionScheme) (*Version, error) {
+	switch scheme {
+	case SemanticVersioning:
+		return ParseSemanticVersion(v)
+	case DebianVersioning:
+		return ParseDebianVersion(v)
+	}
+	return ParseVersion(v)
+}
+
+// ParseSemanticVersion strictly parses a semantic version 2.0 with an optional v prefix. Major, minor and patch
+// versions are required and numeric identifiers may not have leading zeros.
+func ParseSemanticVersion(v string) (*Version, error) {
+	match := semanticVersionPattern.FindStringSubmatch(v)
+	if match == nil {
+		return nil, fmt.Errorf("invalid semantic version %s", v)
+	}
+
+	parsed := &Version{Tag: match[4], Build: match[5], Scheme: SemanticVersioning}
+	for i, part := range []*int{&parsed.Major, &parsed.Minor, &parsed.Patch} {
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid semantic version %s: %s", v, err)
+		}
+		*part = n
+	}
+	return parsed, nil
+}
+
+// ParseDebianVersion leniently parses a debian style version of the form [epoch:]upstream[-revision]. Like dpkg, the
+// epoch ends at the first colon and the revision starts after the last hyphen, so the upstream version may contain
+// hyphens if there is a revision and colons if there is an epoch. The upstream version starts with up to three
+// numeric components, any remainder such as ~rc1 is stored in the tag. The upstream version is also kept as it was
+// given, so that the version is printed and ordered unchanged. Underscores, which separate the components of rpm
+// versions, are accepted as well.
+func ParseDebianVersion(v string) (*Version, error) {
+	parsed := &Version{Scheme: DebianVersioning}
+	upstream := v
+	if i := strings.Index(upstream, ":"); i >= 0 {
+		if !debianEpochPattern.MatchString(upstream[:i]) {
+			return nil, fmt.Errorf("invalid debian version %s", v)
+		}
+		epoch, err := strconv.Atoi(upstream[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid debian version %s: %s", v, err)
+		}
+		parsed.Epoch, upstream = epoch, upstream[i+1:]
+	}
+	if i := strings.LastIndex(upstream, "-"); i >= 0 {
+		if !debianRevisionPattern.MatchString(upstream[i+1:]) {
+			return nil, fmt.Errorf("invalid debian version %s", v)
+		}
+		parsed.Revision, upstream = upstream[i+1:], upstream[:i]
+	}
+
+	match := debianUpstreamPattern.FindStringSubmatch(upstream)
+	if match == nil {
+		return nil, fmt.Errorf("invalid debian version %s", v)
+	}
+	parsed.Upstream, parsed.Tag = upstream, match[4]
+	for i, part := range []*int{&parsed.Major, &parsed.Minor, &parsed.Patch} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid debian version %s: %s", v, err)
+		}
+		*part = n
+	}
+	return parsed, nil
+}
+
+// debianOrder returns the sort weight of a non digit character in a debian version
+func debianOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case c >= '0' && c <= '9':
+		return 0
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	}
+	return int(c) + 256
+}
+
+// compareDebianStrings compares two version strings using the debian ordering
+func compareDebianStrings(a, b string) int {
+	for a != "" || b != "" {
+		for (a != "" && !isDigit(a[0])) || (b != "" && !isDigit(b[0])) {
+			var ca, cb int
+			if a != "" {
+				ca = debianOrder(a[0])
+			}
+			if b != "" {
+				cb = debianOrder(b[0])
+			}
+			if ca != cb {
+				return compareInts(ca, cb)
+			}
+			a, b = a[1:], b[1:]
+		}
+
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		var da, db int
+		for da < len(a) && isDigit(a[da]) {
+			da++
+		}
+		for db < len(b) && isDigit(b[db]) {
+			db++
+		}
+		if da != db {
+			return compareInts(da, db)
+		}
+		if c := strings.Compare(a[:da], b[:db]); c != 0 {
+			return c
+		}
+		a, b = a[da:], b[db:]
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
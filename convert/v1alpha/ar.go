@@ -0,0 +1,149 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+// arHeader is the header of an ar archive member
+type arHeader struct {
+	Name    string
+	ModTime time.Time
+	Mode    int64
+	Size    int64
+}
+
+// arReader reads the members of an ar archive
+type arReader struct {
+	r       *bufio.Reader
+	pending int64
+	padding int64
+	started bool
+}
+
+func newArReader(r io.Reader) *arReader {
+	return &arReader{r: bufio.NewReader(r)}
+}
+
+func parseArField(field []byte, base int) (int64, error) {
+	s := strings.TrimSpace(string(field))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, base, 64)
+}
+
+// Next advances to the next member, returning io.EOF at the end of the archive
+func (a *arReader) Next() (*arHeader, error) {
+	if !a.started {
+		magic := make([]byte, len(arMagic))
+		if _, err := io.ReadFull(a.r, magic); err != nil || string(magic) != arMagic {
+			return nil, fmt.Errorf("not an ar archive")
+		}
+		a.started = true
+	}
+	if _, err := io.CopyN(ioutil.Discard, a.r, a.pending+a.padding); err != nil {
+		return nil, err
+	}
+
+	var raw [arHeaderSize]byte
+	if _, err := io.ReadFull(a.r, raw[:]); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot read ar header: %s", err)
+	}
+	if string(raw[58:60]) != "`\n" {
+		return nil, fmt.Errorf("invalid ar header")
+	}
+
+	h := &arHeader{Name: strings.TrimSuffix(strings.TrimSpace(string(raw[0:16])), "/")}
+	mtime, err := parseArField(raw[16:28], 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ar modification time: %s", err)
+	}
+	h.ModTime = time.Unix(mtime, 0).UTC()
+	if h.Mode, err = parseArField(raw[40:48], 8); err != nil {
+		return nil, fmt.Errorf("invalid ar mode: %s", err)
+	}
+	if h.Size, err = parseArField(raw[48:58], 10); err != nil || h.Size < 0 {
+		return nil, fmt.Errorf("invalid ar member size")
+	}
+	a.pending, a.padding = h.Size, h.Size%2
+	return h, nil
+}
+
+// Read reads the contents of the current member
+func (a *arReader) Read(p []byte) (int, error) {
+	if a.pending <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > a.pending {
+		p = p[:a.pending]
+	}
+	n, err := a.r.Read(p)
+	a.pending -= int64(n)
+	if err == io.EOF && a.pending > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// arWriter writes an ar archive
+type arWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func newArWriter(w io.Writer) *arWriter {
+	return &arWriter{w: w}
+}
+
+// WriteMember writes a member with the given contents
+func (a *arWriter) WriteMember(name string, modTime time.Time, mode int64, contents []byte) error {
+	if !a.started {
+		if _, err := io.WriteString(a.w, arMagic); err != nil {
+			return err
+		}
+		a.started = true
+	}
+	if len(name) > 16 {
+		return fmt.Errorf("ar member name %s is too long", name)
+	}
+
+	header := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, modTime.Unix(), 0, 0, mode, len(contents))
+	if _, err := io.WriteString(a.w, header); err != nil {
+		return err
+	}
+	if _, err := a.w.Write(contents); err != nil {
+		return err
+	}
+	if len(contents)%2 != 0 {
+		_, err := io.WriteString(a.w, "\n")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+const (
+	cpioMagic      = "070701"
+	cpioHeaderSize = 110
+	cpioTrailer    = "TRAILER!!!"
+)
+
+// cpioHeader is the header of an entry of a new ascii cpio archive
+type cpioHeader struct {
+	Name    string
+	Inode   int64
+	Mode    int64
+	Links   int64
+	ModTime time.Time
+	Size    int64
+}
+
+// cpioPadding returns the number of bytes padding n to a multiple of four
+func cpioPadding(n int64) int64 {
+	return (4 - n%4) % 4
+}
+
+// cpioReader reads the entries of a new ascii cpio archive
+type cpioReader struct {
+	r       *bufio.Reader
+	pending int64
+	padding int64
+}
+
+func newCpioReader(r io.Reader) *cpioReader {
+	return &cpioReader{r: bufio.NewReader(r)}
+}
+
+// Next advances to the next entry, returning io.EOF at the trailer
+func (c *cpioReader) Next() (*cpioHeader, error) {
+	if _, err := io.CopyN(ioutil.Discard, c.r, c.pending+c.padding); err != nil {
+		return nil, err
+	}
+
+	var raw [cpioHeaderSize]byte
+	if _, err := io.ReadFull(c.r, raw[:]); err != nil {
+		return nil, fmt.Errorf("cannot read cpio header: %s", err)
+	}
+	if string(raw[:6]) != cpioMagic {
+		return nil, fmt.Errorf("unsupported cpio format %q", raw[:6])
+	}
+	var fields [13]int64
+	for i := range fields {
+		field, err := strconv.ParseInt(string(raw[6+8*i:14+8*i]), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpio header: %s", err)
+		}
+		fields[i] = field
+	}
+	nameSize := fields[11]
+	if nameSize < 1 || nameSize > 4096 {
+		return nil, fmt.Errorf("invalid cpio name size %d", nameSize)
+	}
+	name := make([]byte, nameSize+cpioPadding(cpioHeaderSize+nameSize))
+	if _, err := io.ReadFull(c.r, name); err != nil {
+		return nil, fmt.Errorf("cannot read cpio name: %s", err)
+	}
+
+	h := &cpioHeader{
+		Name:    string(name[:nameSize-1]),
+		Inode:   fields[0],
+		Mode:    fields[1],
+		Links:   fields[4],
+		ModTime: time.Unix(fields[5], 0).UTC(),
+		Size:    fields[6],
+	}
+	if h.Name == cpioTrailer {
+		return nil, io.EOF
+	}
+	c.pending, c.padding = h.Size, cpioPadding(h.Size)
+	return h, nil
+}
+
+// Read reads the contents of the current entry
+func (c *cpioReader) Read(p []byte) (int, error) {
+	if c.pending <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > c.pending {
+		p = p[:c.pending]
+	}
+	n, err := c.r.Read(p)
+	c.pending -= int64(n)
+	if err == io.EOF && c.pending > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// cpioWriter writes a new ascii cpio archive
+type cpioWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func newCpioWriter(w io.Writer) *cpioWriter {
+	return &cpioWriter{w: w}
+}
+
+func (c *cpioWriter) write(p []byte) error {
+	n, err := c.w.Write(p)
+	c.written += int64(n)
+	return err
+}
+
+func (c *cpioWriter) pad() error {
+	return c.write(make([]byte, cpioPadding(c.written)))
+}
+
+// WriteEntry writes an entry with the given contents
+func (c *cpioWriter) WriteEntry(h *cpioHeader, contents []byte) error {
+	modTime := h.ModTime.Unix()
+	if modTime < 0 {
+		modTime = 0
+	}
+	header := fmt.Sprintf("%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		cpioMagic, h.Inode, h.Mode, 0, 0, h.Links, modTime, len(contents), 0, 0, 0, 0, len(h.Name)+1, 0)
+	if err := c.write([]byte(header + h.Name + "\x00")); err != nil {
+		return err
+	}
+	if err := c.pad(); err != nil {
+		return err
+	}
+	if err := c.write(contents); err != nil {
+		return err
+	}
+	return c.pad()
+}
+
+// Close writes the trailer of the archive
+func (c *cpioWriter) Close() error {
+	return c.WriteEntry(&cpioHeader{Name: cpioTrailer, Links: 1}, nil)
+}
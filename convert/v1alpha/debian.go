@@ -0,0 +1,604 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// debianRelationships maps control fields to relationships
+var debianRelationships = []struct {
+	field        string
+	relationship pkg.Relationship
+}{
+	{"Pre-Depends", pkg.Predepends},
+	{"Depends", pkg.Depends},
+	{"Recommends", pkg.Recommends},
+	{"Suggests", pkg.Suggests},
+	{"Breaks", pkg.Breaks},
+	{"Conflicts", pkg.Conflicts},
+	{"Provides", pkg.Provides},
+	{"Replaces", pkg.Replaces},
+}
+
+// debianOperators maps version relation operators to version requirements
+var debianOperators = []struct {
+	operator string
+	requires pkg.Required
+}{
+	{">=", pkg.RequiresGreaterThanEqual},
+	{"<=", pkg.RequiresLessThanEqual},
+	{">>", pkg.RequiresGreaterThan},
+	{"<<", pkg.RequiresLessThan},
+	{"=", pkg.RequiresEqual},
+}
+
+// debianMetadataFields are control fields imported as metadata items with lower case keys
+var debianMetadataFields = []string{"Maintainer", "Section", "Priority", "Homepage"}
+
+// debianScripts maps maintainer scripts to actions
+var debianScripts = []script{
+	{"preinst", []scriptSlot{{pkg.Install, false, "install"}, {pkg.Upgrade, false, "upgrade"}}},
+	{"postinst", []scriptSlot{{pkg.Install, true, "configure"}, {pkg.Upgrade, true, "configure"}, {pkg.Reconfigure, true, "configure"}}},
+	{"prerm", []scriptSlot{{pkg.Remove, false, "remove"}, {pkg.Purge, false, "remove"}}},
+	{"postrm", []scriptSlot{{pkg.Remove, true, "remove"}, {pkg.Purge, true, "purge"}}},
+}
+
+var debianDependencyPattern = regexp.MustCompile(`^([a-z0-9][a-z0-9+.-]*)(?::[a-z0-9-]+)?\s*(?:\(\s*(<<|<=|=|>=|>>|<|>)\s*([^)\s]+)\s*\))?$`)
+
+// parseControl parses the fields of a debian control file. Continuation lines are joined with newlines.
+func parseControl(control []byte) (map[string]string, error) {
+	fields := map[string]string{}
+	var last string
+	scanner := bufio.NewScanner(bytes.NewReader(control))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if last == "" {
+				return nil, fmt.Errorf("invalid control continuation line %q", line)
+			}
+			fields[last] += "\n" + strings.TrimSpace(line)
+		default:
+			i := strings.Index(line, ":")
+			if i < 1 {
+				return nil, fmt.Errorf("invalid control line %q", line)
+			}
+			last = line[:i]
+			fields[last] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return fields, scanner.Err()
+}
+
+// parseDebianDependencies parses a dependency field. Only the first of several alternatives is imported, the
+// other alternatives are returned as unmapped.
+func parseDebianDependencies(field string, relationship pkg.Relationship) (pkg.Dependencies, []string, error) {
+	var deps pkg.Dependencies
+	var unmapped []string
+	for _, entry := range strings.Split(strings.Replace(field, "\n", " ", -1), ",") {
+		alternatives := strings.Split(entry, "|")
+		entry = strings.TrimSpace(alternatives[0])
+		if entry == "" {
+			continue
+		}
+		for _, alternative := range alternatives[1:] {
+			unmapped = append(unmapped, strings.TrimSpace(alternative))
+		}
+		match := debianDependencyPattern.FindStringSubmatch(entry)
+		if match == nil {
+			return nil, nil, fmt.Errorf("invalid dependency %q", entry)
+		}
+		name, err := packageName(match[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		dep := &pkg.Dependency{Name: name, Relationship: relationship}
+		if match[2] != "" {
+			// < and > are obsolete forms of <= and >=
+			operator := map[string]string{"<": "<=", ">": ">="}[match[2]]
+			if operator == "" {
+				operator = match[2]
+			}
+			for _, o := range debianOperators {
+				if o.operator == operator {
+					dep.Requires = o.requires
+				}
+			}
+			v, err := common.ParseDebianVersion(match[3])
+			if err != nil {
+				return nil, nil, err
+			}
+			dep.Version = *v
+		}
+		deps = append(deps, dep)
+	}
+	return deps, unmapped, nil
+}
+
+// decompress decompresses r according to a file name extension
+func decompress(ext string, r io.Reader) (io.Reader, error) {
+	var compression pkg.Compression
+	switch ext {
+	case ".tar", ".cpio":
+		compression = pkg.NoCompression
+	case ".gz":
+		compression = pkg.GzipCompression
+	case ".xz":
+		compression = pkg.XZCompression
+	case ".zst":
+		compression = pkg.ZstdCompression
+	case ".bz2":
+		return bzip2.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", ext)
+	}
+	codec, err := pkg.LookupCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	return codec.NewReader(r)
+}
+
+// openTarMember decompresses an ar member according to the extension of its name
+func openTarMember(name string, r io.Reader) (*tar.Reader, error) {
+	decompressed, err := decompress(path.Ext(name), r)
+	if err != nil {
+		return nil, err
+	}
+	return tar.NewReader(decompressed), nil
+}
+
+// debianImport is the state of a debian package being imported
+type debianImport struct {
+	manifest  *pkg.Manifest
+	result    *ImportResult
+	conffiles map[string]bool
+	scripts   map[string][]byte
+	contents  map[string][]byte
+}
+
+// ImportDeb imports a debian binary package. Control fields are mapped to the manifest, conffiles become
+// configuration files and maintainer scripts are installed below ScriptDir and run by command actions with the
+// arguments dpkg would use. Entries of the data archive other than regular files, hard links and directories are
+// skipped and only the first of alternative dependencies is imported.
+func ImportDeb(r io.Reader) (*ImportResult, error) {
+	d := &debianImport{
+		manifest:  &pkg.Manifest{VersionScheme: common.DebianVersioning},
+		conffiles: map[string]bool{},
+		scripts:   map[string][]byte{},
+		contents:  map[string][]byte{},
+	}
+	d.result = &ImportResult{Package: pkg.NewPackageWriter(d.manifest)}
+
+	ar := newArReader(r)
+	control := false
+	for {
+		h, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch {
+		case h.Name == "debian-binary":
+			version, err := ioutil.ReadAll(ar)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(string(version), "2.") {
+				return nil, fmt.Errorf("unsupported debian package format %s", strings.TrimSpace(string(version)))
+			}
+			d.manifest.Created = h.ModTime
+		case strings.HasPrefix(h.Name, "control.tar"):
+			if err = d.readControl(h.Name, ar); err != nil {
+				return nil, err
+			}
+			control = true
+		case strings.HasPrefix(h.Name, "data.tar"):
+			if !control {
+				return nil, fmt.Errorf("data archive precedes control archive")
+			}
+			if err = d.readData(h.Name, ar); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !control {
+		return nil, fmt.Errorf("debian package has no control archive")
+	}
+	return d.result, d.addScripts()
+}
+
+func (d *debianImport) readControl(name string, r io.Reader) error {
+	t, err := openTarMember(name, r)
+	if err != nil {
+		return err
+	}
+	var control []byte
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		contents, err := ioutil.ReadAll(t)
+		if err != nil {
+			return err
+		}
+		switch base := path.Base(h.Name); base {
+		case "control":
+			control = contents
+		case "conffiles":
+			for _, conffile := range strings.Fields(string(contents)) {
+				d.conffiles[conffile] = true
+			}
+		case "preinst", "postinst", "prerm", "postrm":
+			d.scripts[base] = contents
+		}
+	}
+	if control == nil {
+		return fmt.Errorf("control archive has no control file")
+	}
+	return d.applyControl(control)
+}
+
+func (d *debianImport) applyControl(control []byte) error {
+	fields, err := parseControl(control)
+	if err != nil {
+		return err
+	}
+	m := d.manifest
+	if m.Name, err = packageName(fields["Package"]); err != nil || m.Name == "" {
+		return fmt.Errorf("invalid package name %q", fields["Package"])
+	}
+	v, err := common.ParseDebianVersion(fields["Version"])
+	if err != nil {
+		return err
+	}
+	m.Version = *v
+
+	switch arch := fields["Architecture"]; arch {
+	case "all", "":
+	case common.AMD64.String():
+		m.Metadata.Architectures = common.Architectures{common.AMD64}
+	default:
+		return fmt.Errorf("unsupported architecture %s", arch)
+	}
+
+	description := strings.Split(fields["Description"], "\n")
+	for i, line := range description {
+		if line == "." {
+			description[i] = ""
+		}
+	}
+	m.Metadata.Description = strings.Join(description, "\n")
+	for _, field := range debianMetadataFields {
+		if value, found := fields[field]; found {
+			m.Metadata.Items = append(m.Metadata.Items, &pkg.MetadataItem{Key: strings.ToLower(field), Value: value})
+		}
+	}
+
+	for _, r := range debianRelationships {
+		deps, unmapped, err := parseDebianDependencies(fields[r.field], r.relationship)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", r.field, err)
+		}
+		m.Dependencies = append(m.Dependencies, deps...)
+		d.result.Unmapped = append(d.result.Unmapped, unmapped...)
+	}
+	return nil
+}
+
+func (d *debianImport) readData(name string, r io.Reader) error {
+	t, err := openTarMember(name, r)
+	if err != nil {
+		return err
+	}
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		p := path.Clean("/" + h.Name)
+		var contents []byte
+		switch h.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+			if contents, err = ioutil.ReadAll(t); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			found := false
+			if contents, found = d.contents[path.Clean("/"+h.Linkname)]; !found {
+				return fmt.Errorf("hard link %s to unknown file %s", p, h.Linkname)
+			}
+		default:
+			d.result.Skipped = append(d.result.Skipped, p)
+			continue
+		}
+		d.contents[p] = contents
+
+		file := &pkg.File{Path: p, Type: pkg.DataFile, User: h.Uname, Group: h.Gname, Mode: int(h.Mode & 07777)}
+		switch {
+		case d.conffiles[p]:
+			file.Type = pkg.ConfigurationFile
+		case h.Mode&0111 != 0:
+			file.Type = pkg.ExecutableFile
+		}
+		if err = d.result.Package.AddFile(file, bytes.NewReader(contents)); err != nil {
+			return err
+		}
+	}
+}
+
+// addScripts installs the maintainer scripts and adds the actions running them
+func (d *debianImport) addScripts() error {
+	for _, script := range debianScripts {
+		if contents, found := d.scripts[script.name]; found {
+			if err := importScript(d.result.Package, script, nil, contents); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// debianVersion formats a version for a debian control file. Debian versions are written as they were parsed, tags of
+// semantic versions are pre-releases, which debian versions express with a tilde.
+func debianVersion(v common.Version) string {
+	if v.Scheme == common.DebianVersioning {
+		return v.String()
+	}
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Tag != "" {
+		s += "~" + strings.Replace(v.Tag, "-", ".", -1)
+	}
+	return s
+}
+
+// formatDebianDependency formats a dependency for a debian control file
+func formatDebianDependency(dep *pkg.Dependency) string {
+	for _, o := range debianOperators {
+		if o.requires == dep.Requires {
+			return fmt.Sprintf("%s (%s %s)", dep.Name, o.operator, debianVersion(dep.Version))
+		}
+	}
+	return string(dep.Name)
+}
+
+// tarEntry is an entry of a tar archive being written
+type tarEntry struct {
+	name     string
+	mode     int64
+	user     string
+	group    string
+	dir      bool
+	contents []byte
+}
+
+// writeTar writes a gzip compressed tar archive with the given entries
+func writeTar(entries []*tarEntry, modTime time.Time) ([]byte, error) {
+	codec, err := pkg.LookupCodec(pkg.GzipCompression)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	compressed, err := codec.NewWriter(&out)
+	if err != nil {
+		return nil, err
+	}
+	t := tar.NewWriter(compressed)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.name, Mode: e.mode, Uname: e.user, Gname: e.group, ModTime: modTime, Format: tar.FormatGNU}
+		if e.dir {
+			h.Typeflag = tar.TypeDir
+		} else {
+			h.Typeflag = tar.TypeReg
+			h.Size = int64(len(e.contents))
+		}
+		if err = t.WriteHeader(h); err != nil {
+			return nil, err
+		}
+		if _, err = t.Write(e.contents); err != nil {
+			return nil, err
+		}
+	}
+	if err = t.Close(); err != nil {
+		return nil, err
+	}
+	if err = compressed.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// readPackageFile reads the verified contents of a package file
+func readPackageFile(p *pkg.PackageReader, path string) ([]byte, error) {
+	r, err := p.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// debianControl returns the control file of a package
+func debianControl(p *pkg.PackageReader) ([]byte, error) {
+	m := p.Manifest()
+	arch := "all"
+	switch len(m.Metadata.Architectures) {
+	case 0:
+	case 1:
+		arch = m.Metadata.Architectures[0].String()
+	default:
+		return nil, fmt.Errorf("debian packages support a single architecture")
+	}
+
+	var size int64
+	for _, entry := range p.Index().Files {
+		size += entry.Size
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Package: %s\nVersion: %s\nArchitecture: %s\n", m.Name, debianVersion(m.Version), arch)
+	items := map[string]string{}
+	for _, item := range m.Metadata.Items {
+		items[item.Key] = item.Value
+	}
+	if items["maintainer"] == "" {
+		items["maintainer"] = "unknown"
+	}
+	for _, field := range debianMetadataFields {
+		if value := items[strings.ToLower(field)]; value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", field, value)
+		}
+	}
+	fmt.Fprintf(&b, "Installed-Size: %d\n", (size+1023)/1024)
+	for _, r := range debianRelationships {
+		var deps []string
+		for _, dep := range m.Dependencies {
+			if dep.Relationship == r.relationship {
+				deps = append(deps, formatDebianDependency(dep))
+			}
+		}
+		if len(deps) > 0 {
+			fmt.Fprintf(&b, "%s: %s\n", r.field, strings.Join(deps, ", "))
+		}
+	}
+
+	description := strings.Split(strings.TrimSpace(m.Metadata.Description), "\n")
+	if description[0] == "" {
+		description[0] = string(m.Name)
+	}
+	fmt.Fprintf(&b, "Description: %s\n", description[0])
+	for _, line := range description[1:] {
+		if strings.TrimSpace(line) == "" {
+			line = "."
+		}
+		fmt.Fprintf(&b, " %s\n", line)
+	}
+	return []byte(b.String()), nil
+}
+
+// ExportDeb writes a lime package as a debian binary package. Configuration files are listed as conffiles and
+// command actions are exported as maintainer scripts, other kinds of action items cannot be exported.
+func ExportDeb(p *pkg.PackageReader, w io.Writer) error {
+	m := p.Manifest()
+	control, err := debianControl(p)
+	if err != nil {
+		return err
+	}
+
+	controlEntries := []*tarEntry{{name: "./", mode: 0755, dir: true, user: "root", group: "root"}}
+	controlEntries = append(controlEntries, &tarEntry{name: "./control", mode: 0644, user: "root", group: "root", contents: control})
+	exported := map[string]bool{}
+	for _, script := range debianScripts {
+		contents, _, err := exportScript(p, script, false, exported)
+		if err != nil {
+			return err
+		}
+		if contents != nil {
+			controlEntries = append(controlEntries, &tarEntry{name: "./" + script.name, mode: 0755, user: "root", group: "root", contents: contents})
+		}
+	}
+
+	files := append(pkg.Files{}, m.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	var conffiles, md5sums strings.Builder
+	dataEntries := []*tarEntry{{name: "./", mode: 0755, dir: true, user: "root", group: "root"}}
+	dirs := map[string]bool{"/": true}
+	for _, file := range files {
+		if exported[file.Path] {
+			continue
+		}
+		contents, err := readPackageFile(p, file.Path)
+		if err != nil {
+			return err
+		}
+
+		var parents []string
+		for dir := path.Dir(file.Path); !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+			parents = append([]string{dir}, parents...)
+		}
+		for _, dir := range parents {
+			dataEntries = append(dataEntries, &tarEntry{name: "." + dir + "/", mode: 0755, dir: true, user: "root", group: "root"})
+		}
+
+		entry := &tarEntry{name: "." + file.Path, mode: int64(file.Mode), user: file.User, group: file.Group, contents: contents}
+		if entry.mode == 0 {
+			entry.mode = 0644
+		}
+		if entry.user == "" {
+			entry.user = "root"
+		}
+		if entry.group == "" {
+			entry.group = "root"
+		}
+		dataEntries = append(dataEntries, entry)
+
+		sum := md5.Sum(contents)
+		fmt.Fprintf(&md5sums, "%s  %s\n", hex.EncodeToString(sum[:]), strings.TrimPrefix(file.Path, "/"))
+		if file.Type == pkg.ConfigurationFile {
+			fmt.Fprintf(&conffiles, "%s\n", file.Path)
+		}
+	}
+	controlEntries = append(controlEntries, &tarEntry{name: "./md5sums", mode: 0644, user: "root", group: "root", contents: []byte(md5sums.String())})
+	if conffiles.Len() > 0 {
+		controlEntries = append(controlEntries, &tarEntry{name: "./conffiles", mode: 0644, user: "root", group: "root", contents: []byte(conffiles.String())})
+	}
+
+	controlTar, err := writeTar(controlEntries, m.Created)
+	if err != nil {
+		return err
+	}
+	dataTar, err := writeTar(dataEntries, m.Created)
+	if err != nil {
+		return err
+	}
+
+	ar := newArWriter(w)
+	if err = ar.WriteMember("debian-binary", m.Created, 0100644, []byte("2.0\n")); err != nil {
+		return err
+	}
+	if err = ar.WriteMember("control.tar.gz", m.Created, 0100644, controlTar); err != nil {
+		return err
+	}
+	return ar.WriteMember("data.tar.gz", m.Created, 0100644, dataTar)
+}
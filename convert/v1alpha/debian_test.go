@@ -0,0 +1,237 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testControl = `Package: libfoo++
+Version: 1:2.3-4
+Architecture: amd64
+Maintainer: Jane Doe <jane@example.com>
+Section: libs
+Depends: libc6 (>= 2.14), libbar | libbaz, libqux:any
+Pre-Depends: dpkg (>> 1.15)
+Conflicts: oldfoo (<< 2.0)
+Replaces: oldfoo
+Provides: foo (= 2.3)
+Description: foo library
+ The foo library does things.
+ .
+ It does them well.
+`
+
+func testTar(t *testing.T, compression pkg.Compression, entries ...*tar.Header) []byte {
+	codec, err := pkg.LookupCodec(compression)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var out bytes.Buffer
+	w, _ := codec.NewWriter(&out)
+	tw := tar.NewWriter(w)
+	for _, h := range entries {
+		contents := []byte(h.Linkname)
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(contents))
+			h.Linkname = ""
+		}
+		assert.NoError(t, tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			tw.Write(contents)
+		}
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, w.Close())
+	return out.Bytes()
+}
+
+// testFile returns a tar header of a regular file, its contents are stored as the link name
+func testFile(name string, mode int64, contents string) *tar.Header {
+	return &tar.Header{Name: name, Mode: mode, Typeflag: tar.TypeReg, Linkname: contents, Uname: "root", Gname: "root"}
+}
+
+func testDeb(t *testing.T) []byte {
+	return testDebControl(t, testControl)
+}
+
+func testDebControl(t *testing.T, controlFile string) []byte {
+	modTime := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	control := testTar(t, pkg.GzipCompression,
+		testFile("./control", 0644, controlFile),
+		testFile("./conffiles", 0644, "/etc/foo.conf\n"),
+		testFile("./postinst", 0755, "#!/bin/sh\nldconfig\n"))
+	data := testTar(t, pkg.XZCompression,
+		&tar.Header{Name: "./usr/", Typeflag: tar.TypeDir, Mode: 0755},
+		testFile("./etc/foo.conf", 0644, "key=value\n"),
+		testFile("./usr/lib/libfoo.so.2", 0755, "ELF"),
+		&tar.Header{Name: "./usr/lib/libfoo.so.2.3", Typeflag: tar.TypeLink, Linkname: "./usr/lib/libfoo.so.2", Mode: 0755, Uname: "root", Gname: "root"},
+		&tar.Header{Name: "./usr/lib/libfoo.so", Typeflag: tar.TypeSymlink, Linkname: "libfoo.so.2"})
+
+	var out bytes.Buffer
+	ar := newArWriter(&out)
+	assert.NoError(t, ar.WriteMember("debian-binary", modTime, 0100644, []byte("2.0\n")))
+	assert.NoError(t, ar.WriteMember("control.tar.gz", modTime, 0100644, control))
+	assert.NoError(t, ar.WriteMember("data.tar.xz", modTime, 0100644, data))
+	return out.Bytes()
+}
+
+func testBuild(t *testing.T, w *pkg.PackageWriter) *pkg.PackageReader {
+	var out bytes.Buffer
+	if _, err := w.WriteTo(&out); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	p, err := pkg.OpenPackage(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return p
+}
+
+func TestImportDeb(t *testing.T) {
+	result, err := ImportDeb(bytes.NewReader(testDeb(t)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"/usr/lib/libfoo.so"}, result.Skipped)
+	assert.Equal(t, []string{"libbaz"}, result.Unmapped)
+
+	m := result.Package.Manifest()
+	assert.Equal(t, pkg.PackageName("libfooplusplus"), m.Name)
+	assert.Equal(t, "1:2.3-4", m.Version.String())
+	assert.Equal(t, common.Architectures{common.AMD64}, m.Metadata.Architectures)
+	assert.Equal(t, "foo library\nThe foo library does things.\n\nIt does them well.", m.Metadata.Description)
+	assert.Equal(t, []*pkg.MetadataItem{{Key: "maintainer", Value: "Jane Doe <jane@example.com>"}, {Key: "section", Value: "libs"}}, m.Metadata.Items)
+
+	var deps []string
+	for _, dep := range m.Dependencies {
+		deps = append(deps, dep.Relationship.String()+" "+dep.String())
+	}
+	assert.Equal(t, []string{
+		"predepends dpkg (>> 1.15)",
+		"depends libc6 (>= 2.14)",
+		"depends libbar",
+		"depends libqux",
+		"conflicts oldfoo (<< 2.0)",
+		"provides foo (== 2.3)",
+		"replaces oldfoo",
+	}, deps)
+
+	if assert.Len(t, m.Files, 4) {
+		assert.Equal(t, pkg.ConfigurationFile, m.Files.Find("/etc/foo.conf").Type)
+		assert.Equal(t, pkg.ExecutableFile, m.Files.Find("/usr/lib/libfoo.so.2").Type)
+		assert.Equal(t, m.Files.Find("/usr/lib/libfoo.so.2").SHA256, m.Files.Find("/usr/lib/libfoo.so.2.3").SHA256)
+		assert.NotNil(t, m.Files.Find("/var/lib/lime/scripts/libfooplusplus.postinst"))
+	}
+	for _, actionType := range []pkg.ActionType{pkg.Install, pkg.Upgrade, pkg.Reconfigure} {
+		action := m.Actions.Find(actionType)
+		if assert.NotNil(t, action) && assert.Len(t, action.After, 1) {
+			assert.Equal(t, []string{"/var/lib/lime/scripts/libfooplusplus.postinst", "configure"}, action.After[0].Values.(*pkg.CommandAction).Command)
+		}
+	}
+
+	_, err = ImportDeb(bytes.NewReader([]byte("!<arch>\n")))
+	assert.Error(t, err)
+	_, err = ImportDeb(bytes.NewReader([]byte("not a deb")))
+	assert.Error(t, err)
+}
+
+func TestExportDeb(t *testing.T) {
+	result, err := ImportDeb(bytes.NewReader(testDeb(t)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	imported := testBuild(t, result.Package)
+	install := imported.Manifest().Actions.Find(pkg.Install)
+	install.Before = append(install.Before, &pkg.ActionItem{Values: &pkg.CommandAction{Command: []string{"echo", "it's installing"}}})
+
+	var out bytes.Buffer
+	if !assert.NoError(t, ExportDeb(imported, &out)) {
+		return
+	}
+	reimported, err := ImportDeb(bytes.NewReader(out.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := testBuild(t, reimported.Package)
+	m := p.Manifest()
+	assert.Equal(t, imported.Manifest().Name, m.Name)
+	assert.Equal(t, imported.Manifest().Version, m.Version)
+	assert.Equal(t, imported.Manifest().Metadata, m.Metadata)
+	assert.Equal(t, imported.Manifest().Dependencies, m.Dependencies)
+	assert.Len(t, m.Files, 5)
+	for _, file := range imported.Manifest().Files {
+		assert.Equal(t, file, m.Files.Find(file.Path))
+	}
+
+	r, err := p.Open("/var/lib/lime/scripts/libfooplusplus.preinst")
+	if assert.NoError(t, err) {
+		preinst, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "#!/bin/sh\nset -e\n\ncase \"$1\" in\ninstall)\n\techo 'it'\\''s installing'\n\t;;\nesac\n", string(preinst))
+	}
+	r, err = p.Open("/var/lib/lime/scripts/libfooplusplus.postinst")
+	if assert.NoError(t, err) {
+		postinst, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "#!/bin/sh\nldconfig\n", string(postinst))
+	}
+
+	install.Before = append(install.Before, &pkg.ActionItem{Values: &pkg.SysctlAction{Key: "vm.swappiness", Value: "10"}})
+	assert.Error(t, ExportDeb(imported, &out))
+}
+
+func TestDebianVersionRoundTrip(t *testing.T) {
+	controlFile := "Package: binutils\nVersion: 2.30+dfsg-1\nArchitecture: amd64\n" +
+		"Depends: libc6 (>= 2.27), libbinutils (= 2.30+dfsg-1), zlib1g (>= 1:1.2.0), libfoo (>= 2.0-beta-1)\nDescription: binary utilities\n"
+	result, err := ImportDeb(bytes.NewReader(testDebControl(t, controlFile)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	imported := testBuild(t, result.Package)
+	assert.Equal(t, "2.30+dfsg-1", imported.Manifest().Version.String())
+
+	control, err := debianControl(imported)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(control), "Version: 2.30+dfsg-1\n")
+		assert.Contains(t, string(control), "Depends: libc6 (>= 2.27), libbinutils (= 2.30+dfsg-1), zlib1g (>= 1:1.2.0), libfoo (>= 2.0-beta-1)\n")
+	}
+
+	var out bytes.Buffer
+	if !assert.NoError(t, ExportDeb(imported, &out)) {
+		return
+	}
+	reimported, err := ImportDeb(bytes.NewReader(out.Bytes()))
+	if assert.NoError(t, err) {
+		m := reimported.Package.Manifest()
+		assert.Equal(t, imported.Manifest().Version, m.Version)
+		assert.Equal(t, imported.Manifest().Dependencies, m.Dependencies)
+	}
+
+	result, err = ImportDeb(bytes.NewReader(testDebControl(t, "Package: foo\nVersion: 1:2.0-beta-1-3\nArchitecture: all\nDescription: foo\n")))
+	if assert.NoError(t, err) {
+		v := result.Package.Manifest().Version
+		assert.Equal(t, "1:2.0-beta-1-3", v.String())
+		assert.Equal(t, "2.0-beta-1", v.Upstream)
+		assert.Equal(t, "3", v.Revision)
+	}
+}
@@ -0,0 +1,770 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// rpm dependency flags
+const (
+	rpmSenseLess       = 1 << 1
+	rpmSenseGreater    = 1 << 2
+	rpmSenseEqual      = 1 << 3
+	rpmSensePrereq     = 1 << 6
+	rpmSenseScriptPre  = 1 << 9
+	rpmSenseScriptPost = 1 << 10
+	rpmSenseRPMLib     = 1 << 24
+)
+
+// rpm file flags
+const (
+	rpmFileConfig    = 1 << 0
+	rpmFileNoReplace = 1 << 4
+	rpmFileGhost     = 1 << 6
+)
+
+// rpm file digest algorithms
+const (
+	rpmDigestMD5    = 1
+	rpmDigestSHA1   = 2
+	rpmDigestSHA256 = 8
+	rpmDigestSHA512 = 10
+)
+
+// rpmRelationships maps dependency tags to relationships. Requirements flagged as prerequisites are imported as
+// pre-dependencies, obsoleted packages are replaced.
+var rpmRelationships = []struct {
+	name, version, flags uint32
+	relationship         pkg.Relationship
+}{
+	{rpmTagRequireName, rpmTagRequireVersion, rpmTagRequireFlags, pkg.Depends},
+	{rpmTagProvideName, rpmTagProvideVersion, rpmTagProvideFlags, pkg.Provides},
+	{rpmTagConflictName, rpmTagConflictVersion, rpmTagConflictFlags, pkg.Conflicts},
+	{rpmTagObsoleteName, rpmTagObsoleteVersion, rpmTagObsoleteFlags, pkg.Replaces},
+	{rpmTagRecommendName, rpmTagRecommendVersion, rpmTagRecommendFlags, pkg.Recommends},
+	{rpmTagSuggestName, rpmTagSuggestVersion, rpmTagSuggestFlags, pkg.Suggests},
+}
+
+// rpmSenses maps dependency flags to version requirements
+var rpmSenses = []struct {
+	flag     int64
+	requires pkg.Required
+}{
+	{rpmSenseEqual, pkg.RequiresEqual},
+	{rpmSenseGreater, pkg.RequiresGreaterThan},
+	{rpmSenseLess, pkg.RequiresLessThan},
+}
+
+// rpmMetadataTags are header tags imported as metadata items
+var rpmMetadataTags = []struct {
+	tag uint32
+	key string
+}{
+	{rpmTagPackager, "maintainer"},
+	{rpmTagGroup, "group"},
+	{rpmTagLicense, "license"},
+	{rpmTagURL, "homepage"},
+}
+
+// rpmCompressors maps payload compressors to file name extensions
+var rpmCompressors = map[string]string{
+	"":      ".gz",
+	"gzip":  ".gz",
+	"bzip2": ".bz2",
+	"xz":    ".xz",
+	"zstd":  ".zst",
+}
+
+// rpmScripts maps scriptlets to actions. Scriptlets are run with the number of installed instances of the package
+// after the transaction.
+var rpmScripts = []struct {
+	script
+	tag, prog uint32
+}{
+	{script{"pre", []scriptSlot{{pkg.Install, false, "1"}, {pkg.Upgrade, false, "2"}}}, rpmTagPreIn, rpmTagPreInProg},
+	{script{"post", []scriptSlot{{pkg.Install, true, "1"}, {pkg.Upgrade, true, "2"}}}, rpmTagPostIn, rpmTagPostInProg},
+	{script{"preun", []scriptSlot{{pkg.Remove, false, "0"}, {pkg.Purge, false, "0"}}}, rpmTagPreUn, rpmTagPreUnProg},
+	{script{"postun", []scriptSlot{{pkg.Remove, true, "0"}, {pkg.Purge, true, "0"}}}, rpmTagPostUn, rpmTagPostUnProg},
+}
+
+// rpmLibRequirements are the rpmlib features used by exported packages
+var rpmLibRequirements = [][2]string{
+	{"rpmlib(CompressedFileNames)", "3.0.4-1"},
+	{"rpmlib(FileDigests)", "4.6.0-1"},
+	{"rpmlib(PayloadFilesHavePrefix)", "4.0-1"},
+}
+
+// parseRPMVersion parses an rpm epoch, version and release. The version and release are kept as the debian upstream
+// version and revision, so that they are exported unchanged. Versions using the caret operator are rejected.
+func parseRPMVersion(evr string) (*common.Version, error) {
+	return common.ParseDebianVersion(evr)
+}
+
+// rpmVersion returns the rpm version and release of a version. Versions without a debian revision are release 1.
+func rpmVersion(v common.Version) (string, string) {
+	release := v.Revision
+	if release == "" {
+		release = "1"
+	}
+	v.Epoch, v.Revision = 0, ""
+	return debianVersion(v), release
+}
+
+// rpmDependencyVersion formats the version of a dependency, the release is only included if it is set
+func rpmDependencyVersion(v common.Version) string {
+	version, release := rpmVersion(v)
+	if v.Revision != "" {
+		version += "-" + release
+	}
+	if v.Epoch != 0 {
+		version = fmt.Sprintf("%d:%s", v.Epoch, version)
+	}
+	return version
+}
+
+// rpmDependencyString formats a dependency that cannot be imported
+func rpmDependencyString(name string, flags int64, version string) string {
+	if version == "" {
+		return name
+	}
+	operator := ""
+	for _, o := range []struct {
+		flag     int64
+		operator string
+	}{{rpmSenseLess, "<"}, {rpmSenseGreater, ">"}, {rpmSenseEqual, "="}} {
+		if flags&o.flag != 0 {
+			operator += o.operator
+		}
+	}
+	return fmt.Sprintf("%s %s %s", name, operator, version)
+}
+
+// rpmDigest returns the hash used for file digests of the given algorithm or nil if it is not supported
+func rpmDigest(algorithm int64) hash.Hash {
+	switch algorithm {
+	case rpmDigestMD5:
+		return md5.New()
+	case rpmDigestSHA1:
+		return sha1.New()
+	case rpmDigestSHA256:
+		return sha256.New()
+	case rpmDigestSHA512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// rpmImport is the state of an rpm package being imported
+type rpmImport struct {
+	header   rpmHeader
+	manifest *pkg.Manifest
+	result   *ImportResult
+}
+
+// ImportRPM imports a binary rpm package. Header tags are mapped to the manifest, %config files become
+// configuration files and scriptlets are installed below ScriptDir and run by command actions with their
+// interpreter and the arguments rpm would use. The header digest from the signature and the digests of all files
+// are verified, signatures are not. Payload entries other than regular files and hard links are skipped, as are
+// ghost files and lua scriptlets. Dependencies on files, libraries and other capabilities that are not package
+// names cannot be imported, rpmlib dependencies are ignored.
+//
+// RPM versions are imported as debian versions and are ordered using the debian ordering rather than rpmvercmp. Both
+// agree on most versions, but rpmvercmp treats all separators alike while debian orders them, and versions using the
+// rpm caret operator (^) cannot be imported.
+func ImportRPM(r io.Reader) (*ImportResult, error) {
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(r, lead); err != nil || !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return nil, fmt.Errorf("not an rpm package")
+	}
+	signature, raw, err := readRPMHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.CopyN(ioutil.Discard, r, int64((8-len(raw)%8)%8)); err != nil {
+		return nil, fmt.Errorf("cannot read rpm signature padding: %s", err)
+	}
+	h, raw, err := readRPMHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = verifyRPMHeader(signature, raw); err != nil {
+		return nil, err
+	}
+	if h.String(rpmTagSourceRPM) == "" {
+		return nil, fmt.Errorf("source rpm packages are not supported")
+	}
+
+	i := &rpmImport{header: h, manifest: &pkg.Manifest{VersionScheme: common.DebianVersioning}}
+	i.result = &ImportResult{Package: pkg.NewPackageWriter(i.manifest)}
+	if err = i.applyHeader(); err != nil {
+		return nil, err
+	}
+	if err = i.readPayload(r); err != nil {
+		return nil, err
+	}
+	return i.result, i.addScripts()
+}
+
+// verifyRPMHeader verifies the digest of the main header listed in the signature
+func verifyRPMHeader(signature rpmHeader, raw []byte) error {
+	for _, digest := range []struct {
+		tag  uint32
+		hash hash.Hash
+	}{{rpmSigTagSHA256, sha256.New()}, {rpmSigTagSHA1, sha1.New()}} {
+		expected := signature.String(digest.tag)
+		if expected == "" {
+			continue
+		}
+		digest.hash.Write(raw)
+		if hex.EncodeToString(digest.hash.Sum(nil)) != expected {
+			return fmt.Errorf("rpm header digest mismatch")
+		}
+		return nil
+	}
+	return nil
+}
+
+func (i *rpmImport) applyHeader() error {
+	h, m := i.header, i.manifest
+	var err error
+	rpmName := h.String(rpmTagName)
+	if m.Name, err = packageName(rpmName); err != nil || m.Name == "" {
+		return fmt.Errorf("invalid package name %q", rpmName)
+	}
+	evr := h.String(rpmTagVersion) + "-" + h.String(rpmTagRelease)
+	if epoch, found := h.Int(rpmTagEpoch); found {
+		evr = fmt.Sprintf("%d:%s", epoch, evr)
+	}
+	v, err := parseRPMVersion(evr)
+	if err != nil {
+		return err
+	}
+	m.Version = *v
+	if buildTime, found := h.Int(rpmTagBuildTime); found {
+		m.Created = time.Unix(buildTime, 0).UTC()
+	}
+
+	switch arch := h.String(rpmTagArch); arch {
+	case "noarch":
+	case "x86_64":
+		m.Metadata.Architectures = common.Architectures{common.AMD64}
+	default:
+		return fmt.Errorf("unsupported architecture %s", arch)
+	}
+
+	summary, description := strings.TrimSpace(h.String(rpmTagSummary)), strings.TrimSpace(h.String(rpmTagDescription))
+	m.Metadata.Description = summary
+	if description != "" && description != summary {
+		m.Metadata.Description += "\n" + description
+	}
+	for _, t := range rpmMetadataTags {
+		if value := h.String(t.tag); value != "" {
+			m.Metadata.Items = append(m.Metadata.Items, &pkg.MetadataItem{Key: t.key, Value: value})
+		}
+	}
+
+	for _, r := range rpmRelationships {
+		names, versions, flags := h.Strings(r.name), h.Strings(r.version), h.Ints(r.flags)
+		if (versions == nil) != (flags == nil) || (versions != nil && (len(versions) != len(names) || len(flags) != len(names))) {
+			return fmt.Errorf("invalid rpm dependency tags %d", r.name)
+		}
+		for j, name := range names {
+			var version string
+			var flag int64
+			if versions != nil {
+				version, flag = versions[j], flags[j]
+			}
+			if flag&rpmSenseRPMLib != 0 || strings.HasPrefix(name, "rpmlib(") {
+				continue
+			}
+			if r.relationship == pkg.Provides && (name == rpmName || strings.HasPrefix(name, rpmName+"(")) {
+				continue
+			}
+
+			converted, err := packageName(name)
+			if err != nil || converted == "" || strings.ContainsAny(name, "/()") {
+				i.result.Unmapped = append(i.result.Unmapped, rpmDependencyString(name, flag, version))
+				continue
+			}
+			dep := &pkg.Dependency{Name: converted, Relationship: r.relationship}
+			if r.relationship == pkg.Depends && flag&(rpmSensePrereq|rpmSenseScriptPre) != 0 {
+				dep.Relationship = pkg.Predepends
+			}
+			if version != "" {
+				for _, s := range rpmSenses {
+					if flag&s.flag != 0 {
+						dep.Requires |= s.requires
+					}
+				}
+				v, err := parseRPMVersion(version)
+				if err != nil {
+					return err
+				}
+				dep.Version = *v
+			}
+			if !containsDependency(m.Dependencies, dep) {
+				m.Dependencies = append(m.Dependencies, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// containsDependency returns true if deps lists dep, rpm packages often list requirements for several scriptlets.
+// Versions must be identical, versions that are merely ordered equally such as 1.0 and 1.0.0 are kept apart.
+func containsDependency(deps pkg.Dependencies, dep *pkg.Dependency) bool {
+	for _, d := range deps {
+		if d.Name == dep.Name && d.Relationship == dep.Relationship && d.Requires == dep.Requires && d.Version == dep.Version {
+			return true
+		}
+	}
+	return false
+}
+
+// rpmPayloadEntry is a regular file read from the payload
+type rpmPayloadEntry struct {
+	path     string
+	header   *cpioHeader
+	contents []byte
+}
+
+func (i *rpmImport) readPayload(r io.Reader) error {
+	h := i.header
+	if format := h.String(rpmTagPayloadFormat); format != "" && format != "cpio" {
+		return fmt.Errorf("unsupported rpm payload format %s", format)
+	}
+	compressor := h.String(rpmTagPayloadCompressor)
+	ext, found := rpmCompressors[compressor]
+	if !found {
+		return fmt.Errorf("unsupported rpm payload compressor %s", compressor)
+	}
+	decompressed, err := decompress(ext, r)
+	if err != nil {
+		return err
+	}
+
+	paths := h.Strings(rpmTagOldFileNames)
+	if baseNames := h.Strings(rpmTagBaseNames); baseNames != nil {
+		dirNames, dirIndexes := h.Strings(rpmTagDirNames), h.Ints(rpmTagDirIndexes)
+		if len(dirIndexes) != len(baseNames) {
+			return fmt.Errorf("invalid rpm file name tags")
+		}
+		paths = make([]string, len(baseNames))
+		for j, base := range baseNames {
+			if dirIndexes[j] < 0 || dirIndexes[j] >= int64(len(dirNames)) {
+				return fmt.Errorf("invalid rpm file name tags")
+			}
+			paths[j] = dirNames[dirIndexes[j]] + base
+		}
+	}
+	modes, flags, digests := h.Ints(rpmTagFileModes), h.Ints(rpmTagFileFlags), h.Strings(rpmTagFileDigests)
+	users, groups := h.Strings(rpmTagFileUserName), h.Strings(rpmTagFileGroupName)
+	for _, n := range []int{len(modes), len(flags), len(digests), len(users), len(groups)} {
+		if n != len(paths) {
+			return fmt.Errorf("invalid rpm file tags")
+		}
+	}
+	algorithm, found := h.Int(rpmTagFileDigestAlgo)
+	if !found {
+		algorithm = rpmDigestMD5
+	}
+
+	listed := map[string]int{}
+	for j, p := range paths {
+		listed[path.Clean(p)] = j
+		if flags[j]&rpmFileGhost != 0 {
+			i.result.Skipped = append(i.result.Skipped, p)
+		}
+	}
+
+	// hard linked files share an inode and only the last link carries the contents
+	var entries []*rpmPayloadEntry
+	linked := map[int64][]byte{}
+	c := newCpioReader(decompressed)
+	for {
+		ch, err := c.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		p := path.Clean("/" + ch.Name)
+		switch ch.Mode & 0170000 {
+		case 0040000:
+			continue
+		case 0100000:
+		default:
+			i.result.Skipped = append(i.result.Skipped, p)
+			continue
+		}
+		contents, err := ioutil.ReadAll(c)
+		if err != nil {
+			return err
+		}
+		if ch.Links > 1 && len(contents) > 0 {
+			linked[ch.Inode] = contents
+		}
+		entries = append(entries, &rpmPayloadEntry{path: p, header: ch, contents: contents})
+	}
+
+	for _, e := range entries {
+		if e.header.Links > 1 && len(e.contents) == 0 {
+			e.contents = linked[e.header.Inode]
+		}
+		j, found := listed[e.path]
+		if !found {
+			return fmt.Errorf("payload file %s is not listed in the rpm header", e.path)
+		}
+		if flags[j]&rpmFileGhost != 0 {
+			continue
+		}
+		if digest := rpmDigest(algorithm); digest != nil && digests[j] != "" {
+			digest.Write(e.contents)
+			if hex.EncodeToString(digest.Sum(nil)) != digests[j] {
+				return fmt.Errorf("digest mismatch for %s", e.path)
+			}
+		}
+
+		file := &pkg.File{Path: e.path, Type: pkg.DataFile, User: users[j], Group: groups[j], Mode: int(modes[j] & 07777)}
+		switch {
+		case flags[j]&rpmFileConfig != 0:
+			file.Type = pkg.ConfigurationFile
+		case modes[j]&0111 != 0:
+			file.Type = pkg.ExecutableFile
+		}
+		if err := i.result.Package.AddFile(file, bytes.NewReader(e.contents)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addScripts installs the scriptlets and adds the actions running them
+func (i *rpmImport) addScripts() error {
+	for _, s := range rpmScripts {
+		if _, found := i.header[s.tag]; !found {
+			continue
+		}
+		interpreter := i.header.Strings(s.prog)
+		if len(interpreter) == 0 {
+			interpreter = []string{"/bin/sh"}
+		}
+		if interpreter[0] == "<lua>" {
+			i.result.Skipped = append(i.result.Skipped, "%"+s.name)
+			continue
+		}
+		if err := importScript(i.result.Package, s.script, interpreter, []byte(i.header.String(s.tag))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpmDependencyList are the values of the name, version and flags tags of a kind of dependency
+type rpmDependencyList struct {
+	names, versions []string
+	flags           []int64
+}
+
+// rpmDependencies collects the dependency tags of an exported package by their name tag
+type rpmDependencies map[uint32]*rpmDependencyList
+
+func (d rpmDependencies) add(tag uint32, name, version string, flags int64) {
+	if d[tag] == nil {
+		d[tag] = &rpmDependencyList{}
+	}
+	d[tag].names = append(d[tag].names, name)
+	d[tag].versions = append(d[tag].versions, version)
+	d[tag].flags = append(d[tag].flags, flags)
+}
+
+// addDependency adds a dependency of the manifest
+func (d rpmDependencies) addDependency(dep *pkg.Dependency) {
+	relationship, flags := dep.Relationship, int64(0)
+	switch relationship {
+	case pkg.Predepends:
+		relationship, flags = pkg.Depends, rpmSensePrereq
+	case pkg.Breaks:
+		relationship = pkg.Conflicts
+	}
+	version := ""
+	if dep.Requires != 0 {
+		version = rpmDependencyVersion(dep.Version)
+		for _, s := range rpmSenses {
+			if dep.Requires&s.requires != 0 {
+				flags |= s.flag
+			}
+		}
+	}
+	for _, r := range rpmRelationships {
+		if r.relationship == relationship {
+			d.add(r.name, string(dep.Name), version, flags)
+		}
+	}
+}
+
+// rpmMainHeader returns the main header of an exported package without file tags
+func rpmMainHeader(m *pkg.Manifest) (rpmHeader, error) {
+	h := rpmHeader{}
+	version, release := rpmVersion(m.Version)
+	h.SetStrings(rpmTagName, rpmString, string(m.Name))
+	h.SetStrings(rpmTagVersion, rpmString, version)
+	h.SetStrings(rpmTagRelease, rpmString, release)
+	if m.Version.Epoch != 0 {
+		h.SetInts(rpmTagEpoch, rpmInt32, int64(m.Version.Epoch))
+	}
+
+	description := strings.SplitN(strings.TrimSpace(m.Metadata.Description), "\n", 2)
+	if description[0] == "" {
+		description[0] = string(m.Name)
+	}
+	h.SetStrings(rpmTagSummary, rpmI18NString, description[0])
+	h.SetStrings(rpmTagDescription, rpmI18NString, description[len(description)-1])
+	h.SetInts(rpmTagBuildTime, rpmInt32, m.Created.Unix())
+
+	items := map[string]string{"group": "Unspecified", "license": "Unspecified"}
+	for _, item := range m.Metadata.Items {
+		items[item.Key] = item.Value
+	}
+	for _, t := range rpmMetadataTags {
+		if value := items[t.key]; value != "" {
+			h.SetStrings(t.tag, rpmString, value)
+		}
+	}
+	h[rpmTagGroup].typ = rpmI18NString
+
+	arch := "noarch"
+	switch len(m.Metadata.Architectures) {
+	case 0:
+	case 1:
+		if m.Metadata.Architectures[0] != common.AMD64 {
+			return nil, fmt.Errorf("unsupported architecture %s", m.Metadata.Architectures[0])
+		}
+		arch = "x86_64"
+	default:
+		return nil, fmt.Errorf("rpm packages support a single architecture")
+	}
+	h.SetStrings(rpmTagOS, rpmString, "linux")
+	h.SetStrings(rpmTagArch, rpmString, arch)
+	h.SetStrings(rpmTagSourceRPM, rpmString, fmt.Sprintf("%s-%s-%s.src.rpm", m.Name, version, release))
+	h.SetStrings(rpmTagPayloadFormat, rpmString, "cpio")
+	h.SetStrings(rpmTagPayloadCompressor, rpmString, "gzip")
+	h.SetStrings(rpmTagPayloadFlags, rpmString, "9")
+
+	deps := rpmDependencies{}
+	for _, lib := range rpmLibRequirements {
+		deps.add(rpmTagRequireName, lib[0], lib[1], rpmSenseRPMLib|rpmSenseLess|rpmSenseEqual)
+	}
+	deps.add(rpmTagProvideName, string(m.Name), rpmDependencyVersion(m.Version), rpmSenseEqual)
+	for _, dep := range m.Dependencies {
+		deps.addDependency(dep)
+	}
+	for _, r := range rpmRelationships {
+		if d := deps[r.name]; d != nil {
+			h.SetStrings(r.name, rpmStringArray, d.names...)
+			h.SetStrings(r.version, rpmStringArray, d.versions...)
+			h.SetInts(r.flags, rpmInt32, d.flags...)
+		}
+	}
+	return h, nil
+}
+
+// ExportRPM writes a lime package as a binary rpm package. Configuration files are marked %config(noreplace) and
+// command actions are exported as scriptlets, other kinds of action items cannot be exported. The package is not
+// signed, its signature header only holds digests.
+func ExportRPM(p *pkg.PackageReader, w io.Writer) error {
+	m := p.Manifest()
+	h, err := rpmMainHeader(m)
+	if err != nil {
+		return err
+	}
+
+	exported := map[string]bool{}
+	for _, s := range rpmScripts {
+		contents, interpreter, err := exportScript(p, s.script, true, exported)
+		if err != nil {
+			return err
+		}
+		if contents == nil {
+			continue
+		}
+		h.SetStrings(s.tag, rpmString, string(contents))
+		if len(interpreter) == 1 {
+			h.SetStrings(s.prog, rpmString, interpreter[0])
+		} else {
+			h.SetStrings(s.prog, rpmStringArray, interpreter...)
+		}
+	}
+
+	var files pkg.Files
+	for _, file := range m.Files {
+		if !exported[file.Path] {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	var cpio bytes.Buffer
+	c := newCpioWriter(&cpio)
+	var size int64
+	var dirNames []string
+	dirs := map[string]int64{}
+	tags := map[uint32][]int64{}
+	strs := map[uint32][]string{}
+	for j, file := range files {
+		contents, err := readPackageFile(p, file.Path)
+		if err != nil {
+			return err
+		}
+		size += int64(len(contents))
+
+		mode := int64(file.Mode)
+		if mode == 0 {
+			mode = 0644
+		}
+		user, group := file.User, file.Group
+		if user == "" {
+			user = "root"
+		}
+		if group == "" {
+			group = "root"
+		}
+		flags := int64(0)
+		if file.Type == pkg.ConfigurationFile {
+			flags = rpmFileConfig | rpmFileNoReplace
+		}
+		dir := path.Dir(file.Path) + "/"
+		if dir == "//" {
+			dir = "/"
+		}
+		if _, found := dirs[dir]; !found {
+			dirs[dir] = int64(len(dirNames))
+			dirNames = append(dirNames, dir)
+		}
+
+		for tag, value := range map[uint32]int64{
+			rpmTagFileSizes:       int64(len(contents)),
+			rpmTagFileModes:       0100000 | mode,
+			rpmTagFileRDevs:       0,
+			rpmTagFileMTimes:      m.Created.Unix(),
+			rpmTagFileFlags:       flags,
+			rpmTagFileVerifyFlags: 0xffffffff,
+			rpmTagFileDevices:     1,
+			rpmTagFileInodes:      int64(j + 1),
+			rpmTagDirIndexes:      dirs[dir],
+		} {
+			tags[tag] = append(tags[tag], value)
+		}
+		for tag, value := range map[uint32]string{
+			rpmTagFileDigests:   file.SHA256,
+			rpmTagFileLinkTos:   "",
+			rpmTagFileUserName:  user,
+			rpmTagFileGroupName: group,
+			rpmTagFileLangs:     "",
+			rpmTagBaseNames:     path.Base(file.Path),
+		} {
+			strs[tag] = append(strs[tag], value)
+		}
+
+		header := &cpioHeader{Name: "." + file.Path, Inode: int64(j + 1), Mode: 0100000 | mode, Links: 1, ModTime: m.Created}
+		if err = c.WriteEntry(header, contents); err != nil {
+			return err
+		}
+	}
+	if err = c.Close(); err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		for tag, values := range tags {
+			typ := uint32(rpmInt32)
+			if tag == rpmTagFileModes || tag == rpmTagFileRDevs {
+				typ = rpmInt16
+			}
+			h.SetInts(tag, typ, values...)
+		}
+		for tag, values := range strs {
+			h.SetStrings(tag, rpmStringArray, values...)
+		}
+		h.SetStrings(rpmTagDirNames, rpmStringArray, dirNames...)
+		h.SetInts(rpmTagFileDigestAlgo, rpmInt32, rpmDigestSHA256)
+	}
+	h.SetInts(rpmTagSize, rpmInt32, size)
+
+	codec, err := pkg.LookupCodec(pkg.GzipCompression)
+	if err != nil {
+		return err
+	}
+	var payload bytes.Buffer
+	compressed, err := codec.NewWriter(&payload)
+	if err != nil {
+		return err
+	}
+	if _, err = compressed.Write(cpio.Bytes()); err != nil {
+		return err
+	}
+	if err = compressed.Close(); err != nil {
+		return err
+	}
+
+	header := h.encode(rpmTagHeaderImmutable)
+	if int64(len(header)+payload.Len()) > 0xffffffff || int64(cpio.Len()) > 0xffffffff {
+		return fmt.Errorf("rpm packages larger than 4GiB are not supported")
+	}
+	signature := rpmHeader{}
+	signature.SetInts(rpmSigTagSize, rpmInt32, int64(len(header)+payload.Len()))
+	signature.SetInts(rpmSigTagPayloadSize, rpmInt32, int64(cpio.Len()))
+	sum := md5.New()
+	sum.Write(header)
+	sum.Write(payload.Bytes())
+	signature.SetBin(rpmSigTagMD5, sum.Sum(nil))
+	sha1Sum, sha256Sum := sha1.Sum(header), sha256.Sum256(header)
+	signature.SetStrings(rpmSigTagSHA1, rpmString, hex.EncodeToString(sha1Sum[:]))
+	signature.SetStrings(rpmSigTagSHA256, rpmString, hex.EncodeToString(sha256Sum[:]))
+	encodedSignature := signature.encode(rpmTagHeaderSignatures)
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	lead[4] = 3
+	binary.BigEndian.PutUint16(lead[8:10], 1)
+	copy(lead[10:75], fmt.Sprintf("%s-%s-%s", m.Name, h.String(rpmTagVersion), h.String(rpmTagRelease)))
+	binary.BigEndian.PutUint16(lead[76:78], 1)
+	binary.BigEndian.PutUint16(lead[78:80], 5)
+
+	for _, part := range [][]byte{lead, encodedSignature, make([]byte, (8-len(encodedSignature)%8)%8), header, payload.Bytes()} {
+		if _, err = w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
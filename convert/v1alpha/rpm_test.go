@@ -0,0 +1,324 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os/exec"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRPMEntry is a payload entry of a test rpm package
+type testRPMEntry struct {
+	name     string
+	mode     int64
+	flags    int64
+	inode    int64
+	links    int64
+	contents string
+}
+
+func testRPM(t *testing.T, h rpmHeader, entries ...testRPMEntry) []byte {
+	var cpio bytes.Buffer
+	c := newCpioWriter(&cpio)
+	var dirIndexes, modes, flags []int64
+	var baseNames, digests, users []string
+	for _, e := range entries {
+		contents := []byte(e.contents)
+		if e.links > 1 && e.contents == "" {
+			contents = nil
+		}
+		if e.flags&rpmFileGhost == 0 {
+			assert.NoError(t, c.WriteEntry(&cpioHeader{Name: "." + e.name, Inode: e.inode, Mode: e.mode, Links: e.links}, contents))
+		}
+		if e.links > 1 && e.contents == "" {
+			for _, other := range entries {
+				if other.inode == e.inode && other.contents != "" {
+					contents = []byte(other.contents)
+				}
+			}
+		}
+		sum := sha256.Sum256(contents)
+		dirIndexes = append(dirIndexes, 0)
+		baseNames = append(baseNames, e.name[1:])
+		modes = append(modes, e.mode)
+		flags = append(flags, e.flags)
+		digests = append(digests, hex.EncodeToString(sum[:]))
+		users = append(users, "root")
+	}
+	assert.NoError(t, c.Close())
+	if len(entries) > 0 {
+		h.SetStrings(rpmTagDirNames, rpmStringArray, "/")
+		h.SetInts(rpmTagDirIndexes, rpmInt32, dirIndexes...)
+		h.SetStrings(rpmTagBaseNames, rpmStringArray, baseNames...)
+		h.SetInts(rpmTagFileModes, rpmInt16, modes...)
+		h.SetInts(rpmTagFileFlags, rpmInt32, flags...)
+		h.SetStrings(rpmTagFileDigests, rpmStringArray, digests...)
+		h.SetStrings(rpmTagFileUserName, rpmStringArray, users...)
+		h.SetStrings(rpmTagFileGroupName, rpmStringArray, users...)
+		h.SetInts(rpmTagFileDigestAlgo, rpmInt32, rpmDigestSHA256)
+	}
+
+	codec, _ := pkg.LookupCodec(pkg.XZCompression)
+	var payload bytes.Buffer
+	w, _ := codec.NewWriter(&payload)
+	w.Write(cpio.Bytes())
+	assert.NoError(t, w.Close())
+	h.SetStrings(rpmTagPayloadCompressor, rpmString, "xz")
+
+	header := h.encode(rpmTagHeaderImmutable)
+	signature := rpmHeader{}
+	sum := sha256.Sum256(header)
+	signature.SetStrings(rpmSigTagSHA256, rpmString, hex.EncodeToString(sum[:]))
+	encodedSignature := signature.encode(rpmTagHeaderSignatures)
+
+	out := make([]byte, rpmLeadSize)
+	copy(out, rpmLeadMagic)
+	out = append(out, encodedSignature...)
+	out = append(out, make([]byte, (8-len(encodedSignature)%8)%8)...)
+	out = append(out, header...)
+	return append(out, payload.Bytes()...)
+}
+
+func testRPMHeader() rpmHeader {
+	h := rpmHeader{}
+	h.SetStrings(rpmTagName, rpmString, "foo-libs")
+	h.SetInts(rpmTagEpoch, rpmInt32, 1)
+	h.SetStrings(rpmTagVersion, rpmString, "2.3")
+	h.SetStrings(rpmTagRelease, rpmString, "4.el8_3")
+	h.SetStrings(rpmTagSummary, rpmI18NString, "foo library")
+	h.SetStrings(rpmTagDescription, rpmI18NString, "The foo library does things.")
+	h.SetInts(rpmTagBuildTime, rpmInt32, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC).Unix())
+	h.SetStrings(rpmTagLicense, rpmString, "MIT")
+	h.SetStrings(rpmTagArch, rpmString, "x86_64")
+	h.SetStrings(rpmTagSourceRPM, rpmString, "foo-2.3-4.el8_3.src.rpm")
+	h.SetStrings(rpmTagRequireName, rpmStringArray, "/bin/sh", "bar", "glibc", "glibc", "libc.so.6()(64bit)", "rpmlib(FileDigests)")
+	h.SetStrings(rpmTagRequireVersion, rpmStringArray, "", "", "2.28", "2.28", "", "4.6.0-1")
+	h.SetInts(rpmTagRequireFlags, rpmInt32, rpmSenseScriptPre, rpmSensePrereq, rpmSenseGreater|rpmSenseEqual,
+		rpmSenseGreater|rpmSenseEqual, 0, rpmSenseRPMLib|rpmSenseLess|rpmSenseEqual)
+	h.SetStrings(rpmTagProvideName, rpmStringArray, "foo-libs", "foo-libs(x86-64)", "foo")
+	h.SetStrings(rpmTagProvideVersion, rpmStringArray, "1:2.3-4.el8_3", "1:2.3-4.el8_3", "2.3")
+	h.SetInts(rpmTagProvideFlags, rpmInt32, rpmSenseEqual, rpmSenseEqual, rpmSenseEqual)
+	h.SetStrings(rpmTagObsoleteName, rpmStringArray, "oldfoo")
+	h.SetStrings(rpmTagObsoleteVersion, rpmStringArray, "2.0")
+	h.SetInts(rpmTagObsoleteFlags, rpmInt32, rpmSenseLess)
+	h.SetStrings(rpmTagPreIn, rpmString, "getent group foo || groupadd -r foo")
+	h.SetStrings(rpmTagPostIn, rpmString, "")
+	h.SetStrings(rpmTagPostInProg, rpmString, "/sbin/ldconfig")
+	h.SetStrings(rpmTagPostUn, rpmString, "print('bye')")
+	h.SetStrings(rpmTagPostUnProg, rpmString, "<lua>")
+	return h
+}
+
+func testRPMEntries() []testRPMEntry {
+	return []testRPMEntry{
+		{name: "/etc/foo.conf", mode: 0100644, flags: rpmFileConfig | rpmFileNoReplace, inode: 1, links: 1, contents: "key=value\n"},
+		{name: "/usr/lib64/libfoo.so.2.3", mode: 0100755, inode: 2, links: 2},
+		{name: "/usr/lib64/libfoo.so.2", mode: 0100755, inode: 2, links: 2, contents: "ELF"},
+		{name: "/usr/lib64/libfoo.so", mode: 0120777, inode: 3, links: 1, contents: "libfoo.so.2"},
+		{name: "/var/log/foo.log", mode: 0100644, flags: rpmFileGhost, inode: 4, links: 1},
+	}
+}
+
+func TestImportRPM(t *testing.T) {
+	entries := testRPMEntries()
+	result, err := ImportRPM(bytes.NewReader(testRPM(t, testRPMHeader(), entries[:4]...)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"/usr/lib64/libfoo.so", "%postun"}, result.Skipped)
+	assert.Equal(t, []string{"/bin/sh", "libc.so.6()(64bit)"}, result.Unmapped)
+
+	m := result.Package.Manifest()
+	assert.Equal(t, pkg.PackageName("foo-libs"), m.Name)
+	assert.Equal(t, "1:2.3-4.el8_3", m.Version.String())
+	assert.Equal(t, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), m.Created)
+	assert.Equal(t, common.Architectures{common.AMD64}, m.Metadata.Architectures)
+	assert.Equal(t, "foo library\nThe foo library does things.", m.Metadata.Description)
+	assert.Equal(t, []*pkg.MetadataItem{{Key: "license", Value: "MIT"}}, m.Metadata.Items)
+
+	var deps []string
+	for _, dep := range m.Dependencies {
+		deps = append(deps, dep.Relationship.String()+" "+dep.String())
+	}
+	assert.Equal(t, []string{
+		"predepends bar",
+		"depends glibc (>= 2.28)",
+		"provides foo (== 2.3)",
+		"replaces oldfoo (<< 2.0)",
+	}, deps)
+
+	if assert.Len(t, m.Files, 5) {
+		assert.Equal(t, pkg.ConfigurationFile, m.Files.Find("/etc/foo.conf").Type)
+		assert.Equal(t, pkg.ExecutableFile, m.Files.Find("/usr/lib64/libfoo.so.2").Type)
+		assert.Equal(t, 0755, m.Files.Find("/usr/lib64/libfoo.so.2").Mode)
+		assert.Equal(t, m.Files.Find("/usr/lib64/libfoo.so.2").SHA256, m.Files.Find("/usr/lib64/libfoo.so.2.3").SHA256)
+		assert.NotNil(t, m.Files.Find("/var/lib/lime/scripts/foo-libs.pre"))
+		assert.NotNil(t, m.Files.Find("/var/lib/lime/scripts/foo-libs.post"))
+	}
+	for _, slot := range []struct {
+		actionType pkg.ActionType
+		argument   string
+	}{{pkg.Install, "1"}, {pkg.Upgrade, "2"}} {
+		action := m.Actions.Find(slot.actionType)
+		if assert.NotNil(t, action) && assert.Len(t, action.Before, 1) && assert.Len(t, action.After, 1) {
+			assert.Equal(t, []string{"/bin/sh", "/var/lib/lime/scripts/foo-libs.pre", slot.argument}, action.Before[0].Values.(*pkg.CommandAction).Command)
+			assert.Equal(t, []string{"/sbin/ldconfig", "/var/lib/lime/scripts/foo-libs.post", slot.argument}, action.After[0].Values.(*pkg.CommandAction).Command)
+		}
+	}
+	assert.Nil(t, m.Actions.Find(pkg.Remove))
+
+	// ghost files are listed in the header only
+	h := testRPMHeader()
+	result, err = ImportRPM(bytes.NewReader(testRPM(t, h, entries...)))
+	if assert.NoError(t, err) {
+		assert.Contains(t, result.Skipped, "/var/log/foo.log")
+		assert.Nil(t, result.Package.Manifest().Files.Find("/var/log/foo.log"))
+	}
+
+	raw := testRPM(t, testRPMHeader(), entries[0])
+	raw[len(raw)-200] ^= 0xff
+	_, err = ImportRPM(bytes.NewReader(raw))
+	assert.Error(t, err)
+
+	for _, tag := range []uint32{rpmTagRequireFlags, rpmTagRequireVersion} {
+		h = testRPMHeader()
+		delete(h, tag)
+		_, err = ImportRPM(bytes.NewReader(testRPM(t, h)))
+		assert.Error(t, err)
+	}
+	h = testRPMHeader()
+	h.SetInts(rpmTagProvideFlags, rpmInt32, rpmSenseEqual)
+	_, err = ImportRPM(bytes.NewReader(testRPM(t, h)))
+	assert.Error(t, err)
+	h = testRPMHeader()
+	h.SetStrings(rpmTagVersion, rpmString, "2.3^git1")
+	_, err = ImportRPM(bytes.NewReader(testRPM(t, h)))
+	assert.Error(t, err)
+
+	h = testRPMHeader()
+	delete(h, rpmTagSourceRPM)
+	_, err = ImportRPM(bytes.NewReader(testRPM(t, h)))
+	assert.Error(t, err)
+
+	_, err = ImportRPM(bytes.NewReader([]byte("not an rpm")))
+	assert.Error(t, err)
+}
+
+func TestExportRPM(t *testing.T) {
+	result, err := ImportRPM(bytes.NewReader(testRPM(t, testRPMHeader(), testRPMEntries()[:3]...)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	imported := testBuild(t, result.Package)
+	remove := &pkg.Action{Type: pkg.Remove, After: pkg.ActionItems{{Values: &pkg.CommandAction{Command: []string{"rm", "-rf", "/var/cache/foo"}}}}}
+	imported.Manifest().Actions = append(imported.Manifest().Actions, remove)
+
+	var out bytes.Buffer
+	if !assert.NoError(t, ExportRPM(imported, &out)) {
+		return
+	}
+	reimported, err := ImportRPM(bytes.NewReader(out.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, reimported.Skipped)
+	assert.Empty(t, reimported.Unmapped)
+
+	p := testBuild(t, reimported.Package)
+	m := p.Manifest()
+	assert.Equal(t, imported.Manifest().Name, m.Name)
+	assert.Equal(t, imported.Manifest().Version, m.Version)
+	assert.Equal(t, imported.Manifest().Created, m.Created)
+	assert.Equal(t, imported.Manifest().Metadata.Description, m.Metadata.Description)
+	assert.Contains(t, m.Metadata.Items, &pkg.MetadataItem{Key: "license", Value: "MIT"})
+	assert.Equal(t, imported.Manifest().Dependencies, m.Dependencies)
+	assert.Len(t, m.Files, 6)
+	for _, file := range imported.Manifest().Files {
+		assert.Equal(t, file, m.Files.Find(file.Path))
+	}
+	assert.Equal(t, imported.Manifest().Actions.Find(pkg.Install), m.Actions.Find(pkg.Install))
+
+	r, err := p.Open("/var/lib/lime/scripts/foo-libs.postun")
+	if assert.NoError(t, err) {
+		postun, _ := ioutil.ReadAll(r)
+		assert.Equal(t, "#!/bin/sh\nset -e\n\ncase \"$1\" in\n0)\n\trm -rf /var/cache/foo\n\t;;\nesac\n", string(postun))
+	}
+
+	// the payload is readable by other rpm implementations
+	if bsdtar, err := exec.LookPath("bsdtar"); err == nil {
+		cmd := exec.Command(bsdtar, "-tf", "-")
+		cmd.Stdin = bytes.NewReader(out.Bytes())
+		listing, err := cmd.Output()
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(listing), "./usr/lib64/libfoo.so.2.3")
+		}
+	}
+
+	remove.After = append(remove.After, &pkg.ActionItem{Values: &pkg.SysctlAction{Key: "vm.swappiness", Value: "10"}})
+	assert.Error(t, ExportRPM(imported, &out))
+}
+
+func TestRPMVersionRoundTrip(t *testing.T) {
+	h := testRPMHeader()
+	delete(h, rpmTagEpoch)
+	h.SetStrings(rpmTagVersion, rpmString, "1.2_3")
+	h.SetStrings(rpmTagRelease, rpmString, "1.fc32")
+	h.SetStrings(rpmTagRequireName, rpmStringArray, "glibc", "glibc", "zlib")
+	h.SetStrings(rpmTagRequireVersion, rpmStringArray, "2.28", "2.28.0", "1.2-1")
+	h.SetInts(rpmTagRequireFlags, rpmInt32, rpmSenseGreater|rpmSenseEqual, rpmSenseGreater|rpmSenseEqual, rpmSenseGreater|rpmSenseEqual)
+	result, err := ImportRPM(bytes.NewReader(testRPM(t, h)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	imported := testBuild(t, result.Package)
+	m := imported.Manifest()
+	assert.Equal(t, "1.2_3-1.fc32", m.Version.String())
+	var deps []string
+	for _, dep := range m.Dependencies {
+		deps = append(deps, dep.Relationship.String()+" "+dep.String())
+	}
+	assert.Equal(t, []string{"depends glibc (>= 2.28)", "depends glibc (>= 2.28.0)", "depends zlib (>= 1.2-1)",
+		"provides foo (== 2.3)", "replaces oldfoo (<< 2.0)"}, deps)
+
+	exported, err := rpmMainHeader(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "1.2_3", exported.String(rpmTagVersion))
+	assert.Equal(t, "1.fc32", exported.String(rpmTagRelease))
+	_, found := exported.Int(rpmTagEpoch)
+	assert.False(t, found)
+	assert.Subset(t, exported.Strings(rpmTagRequireVersion), []string{"2.28", "2.28.0", "1.2-1"})
+
+	var out bytes.Buffer
+	if !assert.NoError(t, ExportRPM(imported, &out)) {
+		return
+	}
+	reimported, err := ImportRPM(bytes.NewReader(out.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, m.Version, reimported.Package.Manifest().Version)
+		assert.Equal(t, m.Dependencies, reimported.Package.Manifest().Dependencies)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+// An rpm package starts with a 96 byte lead followed by the signature header, padded to a multiple of eight bytes,
+// the main header and the compressed cpio payload. A header starts with eight magic bytes followed by the number of
+// index entries and the length of the data store, both as big endian 32 bit integers. Each 16 byte index entry
+// holds the tag, type, offset in the store and count of a value.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	rpmLeadSize       = 96
+	rpmMaxHeaderIndex = 1 << 16
+	rpmMaxHeaderStore = 64 << 20
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+)
+
+// rpm header value types
+const (
+	rpmNull        = 0
+	rpmChar        = 1
+	rpmInt8        = 2
+	rpmInt16       = 3
+	rpmInt32       = 4
+	rpmInt64       = 5
+	rpmString      = 6
+	rpmBin         = 7
+	rpmStringArray = 8
+	rpmI18NString  = 9
+)
+
+// rpm header and signature tags
+const (
+	rpmTagHeaderSignatures  = 62
+	rpmTagHeaderImmutable   = 63
+	rpmSigTagSHA1           = 269
+	rpmSigTagSHA256         = 273
+	rpmSigTagSize           = 1000
+	rpmSigTagMD5            = 1004
+	rpmSigTagPayloadSize    = 1007
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagEpoch             = 1003
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildTime         = 1006
+	rpmTagSize              = 1009
+	rpmTagLicense           = 1014
+	rpmTagPackager          = 1015
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagOS                = 1021
+	rpmTagArch              = 1022
+	rpmTagPreIn             = 1023
+	rpmTagPostIn            = 1024
+	rpmTagPreUn             = 1025
+	rpmTagPostUn            = 1026
+	rpmTagOldFileNames      = 1027
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileRDevs         = 1033
+	rpmTagFileMTimes        = 1034
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinkTos       = 1036
+	rpmTagFileFlags         = 1037
+	rpmTagFileUserName      = 1039
+	rpmTagFileGroupName     = 1040
+	rpmTagSourceRPM         = 1044
+	rpmTagFileVerifyFlags   = 1045
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagConflictFlags     = 1053
+	rpmTagConflictName      = 1054
+	rpmTagConflictVersion   = 1055
+	rpmTagPreInProg         = 1085
+	rpmTagPostInProg        = 1086
+	rpmTagPreUnProg         = 1087
+	rpmTagPostUnProg        = 1088
+	rpmTagObsoleteName      = 1090
+	rpmTagFileDevices       = 1095
+	rpmTagFileInodes        = 1096
+	rpmTagFileLangs         = 1097
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagObsoleteFlags     = 1114
+	rpmTagObsoleteVersion   = 1115
+	rpmTagDirIndexes        = 1116
+	rpmTagBaseNames         = 1117
+	rpmTagDirNames          = 1118
+	rpmTagPayloadFormat     = 1124
+	rpmTagPayloadCompressor = 1125
+	rpmTagPayloadFlags      = 1126
+	rpmTagFileDigestAlgo    = 5011
+	rpmTagRecommendName     = 5046
+	rpmTagRecommendVersion  = 5047
+	rpmTagRecommendFlags    = 5048
+	rpmTagSuggestName       = 5049
+	rpmTagSuggestVersion    = 5050
+	rpmTagSuggestFlags      = 5051
+)
+
+// rpmValue is a decoded header value
+type rpmValue struct {
+	typ     uint32
+	ints    []int64
+	strings []string
+	bin     []byte
+}
+
+// rpmHeader is a decoded rpm header
+type rpmHeader map[uint32]*rpmValue
+
+// String returns the first string value of tag
+func (h rpmHeader) String(tag uint32) string {
+	if v, found := h[tag]; found && len(v.strings) > 0 {
+		return v.strings[0]
+	}
+	return ""
+}
+
+// Strings returns the string values of tag
+func (h rpmHeader) Strings(tag uint32) []string {
+	if v, found := h[tag]; found {
+		return v.strings
+	}
+	return nil
+}
+
+// Ints returns the integer values of tag
+func (h rpmHeader) Ints(tag uint32) []int64 {
+	if v, found := h[tag]; found {
+		return v.ints
+	}
+	return nil
+}
+
+// Int returns the first integer value of tag and whether it exists
+func (h rpmHeader) Int(tag uint32) (int64, bool) {
+	if ints := h.Ints(tag); len(ints) > 0 {
+		return ints[0], true
+	}
+	return 0, false
+}
+
+// SetStrings sets a string or string array value
+func (h rpmHeader) SetStrings(tag, typ uint32, values ...string) {
+	h[tag] = &rpmValue{typ: typ, strings: values}
+}
+
+// SetInts sets an integer value
+func (h rpmHeader) SetInts(tag, typ uint32, values ...int64) {
+	h[tag] = &rpmValue{typ: typ, ints: values}
+}
+
+// SetBin sets a binary value
+func (h rpmHeader) SetBin(tag uint32, value []byte) {
+	h[tag] = &rpmValue{typ: rpmBin, bin: value}
+}
+
+// rpmIntSize returns the size of an integer type
+func rpmIntSize(typ uint32) int {
+	switch typ {
+	case rpmChar, rpmInt8:
+		return 1
+	case rpmInt16:
+		return 2
+	case rpmInt32:
+		return 4
+	case rpmInt64:
+		return 8
+	}
+	return 0
+}
+
+// readRPMHeader reads a header, returning it and its encoded bytes
+func readRPMHeader(r io.Reader) (rpmHeader, []byte, error) {
+	var intro [16]byte
+	if _, err := io.ReadFull(r, intro[:]); err != nil {
+		return nil, nil, fmt.Errorf("cannot read rpm header: %s", err)
+	}
+	if !bytes.Equal(intro[:8], rpmHeaderMagic) {
+		return nil, nil, fmt.Errorf("invalid rpm header magic")
+	}
+	count, size := binary.BigEndian.Uint32(intro[8:12]), binary.BigEndian.Uint32(intro[12:16])
+	if count > rpmMaxHeaderIndex || size > rpmMaxHeaderStore {
+		return nil, nil, fmt.Errorf("rpm header is too large")
+	}
+
+	index := make([]byte, 16*count)
+	store := make([]byte, size)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, nil, fmt.Errorf("cannot read rpm header index: %s", err)
+	}
+	if _, err := io.ReadFull(r, store); err != nil {
+		return nil, nil, fmt.Errorf("cannot read rpm header store: %s", err)
+	}
+
+	h := rpmHeader{}
+	for i := 0; i < int(count); i++ {
+		entry := index[16*i : 16*i+16]
+		tag, typ := binary.BigEndian.Uint32(entry[0:4]), binary.BigEndian.Uint32(entry[4:8])
+		offset, n := binary.BigEndian.Uint32(entry[8:12]), binary.BigEndian.Uint32(entry[12:16])
+		if offset > size || n > size {
+			return nil, nil, fmt.Errorf("invalid rpm header entry for tag %d", tag)
+		}
+		data := store[offset:]
+
+		v := &rpmValue{typ: typ}
+		switch typ {
+		case rpmNull:
+		case rpmChar, rpmInt8, rpmInt16, rpmInt32, rpmInt64:
+			width := rpmIntSize(typ)
+			if uint64(n)*uint64(width) > uint64(len(data)) {
+				return nil, nil, fmt.Errorf("invalid rpm header entry for tag %d", tag)
+			}
+			for j := 0; j < int(n); j++ {
+				field := data[j*width : (j+1)*width]
+				switch width {
+				case 1:
+					v.ints = append(v.ints, int64(field[0]))
+				case 2:
+					v.ints = append(v.ints, int64(binary.BigEndian.Uint16(field)))
+				case 4:
+					v.ints = append(v.ints, int64(binary.BigEndian.Uint32(field)))
+				default:
+					v.ints = append(v.ints, int64(binary.BigEndian.Uint64(field)))
+				}
+			}
+		case rpmBin:
+			if n > uint32(len(data)) {
+				return nil, nil, fmt.Errorf("invalid rpm header entry for tag %d", tag)
+			}
+			v.bin = data[:n]
+		case rpmString, rpmStringArray, rpmI18NString:
+			if typ == rpmString {
+				n = 1
+			}
+			for j := 0; j < int(n); j++ {
+				end := bytes.IndexByte(data, 0)
+				if end < 0 {
+					return nil, nil, fmt.Errorf("invalid rpm header string for tag %d", tag)
+				}
+				v.strings = append(v.strings, string(data[:end]))
+				data = data[end+1:]
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown rpm header type %d for tag %d", typ, tag)
+		}
+		h[tag] = v
+	}
+	return h, append(append(intro[:], index...), store...), nil
+}
+
+// encode encodes the header with a region trailer for regionTag
+func (h rpmHeader) encode(regionTag uint32) []byte {
+	tags := make([]int, 0, len(h))
+	for tag := range h {
+		tags = append(tags, int(tag))
+	}
+	sort.Ints(tags)
+
+	var index, store bytes.Buffer
+	writeEntry := func(tag, typ, offset, count uint32) {
+		binary.Write(&index, binary.BigEndian, [4]uint32{tag, typ, offset, count})
+	}
+
+	// the region tag comes first and its trailer is stored after all other values
+	count := uint32(len(tags) + 1)
+	for _, tag := range tags {
+		v := h[uint32(tag)]
+		if width := rpmIntSize(v.typ); width > 1 {
+			for store.Len()%width != 0 {
+				store.WriteByte(0)
+			}
+		}
+		offset := uint32(store.Len())
+		n := uint32(0)
+		switch v.typ {
+		case rpmChar, rpmInt8, rpmInt16, rpmInt32, rpmInt64:
+			for _, x := range v.ints {
+				switch rpmIntSize(v.typ) {
+				case 1:
+					store.WriteByte(byte(x))
+				case 2:
+					binary.Write(&store, binary.BigEndian, uint16(x))
+				case 4:
+					binary.Write(&store, binary.BigEndian, uint32(x))
+				default:
+					binary.Write(&store, binary.BigEndian, uint64(x))
+				}
+			}
+			n = uint32(len(v.ints))
+		case rpmBin:
+			store.Write(v.bin)
+			n = uint32(len(v.bin))
+		default:
+			for _, s := range v.strings {
+				store.WriteString(s)
+				store.WriteByte(0)
+			}
+			n = uint32(len(v.strings))
+		}
+		writeEntry(uint32(tag), v.typ, offset, n)
+	}
+
+	trailerOffset := uint32(store.Len())
+	binary.Write(&store, binary.BigEndian, [4]uint32{regionTag, rpmBin, uint32(-int32(count * 16)), 16})
+
+	var out bytes.Buffer
+	out.Write(rpmHeaderMagic)
+	binary.Write(&out, binary.BigEndian, [2]uint32{count, uint32(store.Len())})
+	binary.Write(&out, binary.BigEndian, [4]uint32{regionTag, rpmBin, trailerOffset, 16})
+	out.Write(index.Bytes())
+	out.Write(store.Bytes())
+	return out.Bytes()
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPMHeader(t *testing.T) {
+	h := rpmHeader{}
+	h.SetStrings(rpmTagName, rpmString, "foo")
+	h.SetStrings(rpmTagBaseNames, rpmStringArray, "a", "", "c")
+	h.SetInts(rpmTagFileModes, rpmInt16, 0100644, 0100755)
+	h.SetInts(rpmTagFileSizes, rpmInt32, 1, 0xffffffff)
+	h.SetInts(rpmTagEpoch, rpmInt8, 7)
+	h.SetBin(rpmSigTagMD5, []byte{1, 2, 3})
+
+	encoded := h.encode(rpmTagHeaderImmutable)
+	assert.Equal(t, uint32(len(h)+1), binary.BigEndian.Uint32(encoded[8:12]))
+	assert.Equal(t, uint32(rpmTagHeaderImmutable), binary.BigEndian.Uint32(encoded[16:20]))
+
+	decoded, raw, err := readRPMHeader(bytes.NewReader(append(encoded, "payload"...)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, encoded, raw)
+	assert.Equal(t, "foo", decoded.String(rpmTagName))
+	assert.Equal(t, []string{"a", "", "c"}, decoded.Strings(rpmTagBaseNames))
+	assert.Equal(t, []int64{0100644, 0100755}, decoded.Ints(rpmTagFileModes))
+	assert.Equal(t, []int64{1, 0xffffffff}, decoded.Ints(rpmTagFileSizes))
+	epoch, found := decoded.Int(rpmTagEpoch)
+	assert.True(t, found)
+	assert.Equal(t, int64(7), epoch)
+	assert.Equal(t, []byte{1, 2, 3}, decoded[rpmSigTagMD5].bin)
+	_, found = decoded.Int(rpmTagRelease)
+	assert.False(t, found)
+
+	// the region trailer points back at the start of the index
+	region := decoded[rpmTagHeaderImmutable].bin
+	if assert.Len(t, region, 16) {
+		assert.Equal(t, uint32(rpmTagHeaderImmutable), binary.BigEndian.Uint32(region[0:4]))
+		assert.Equal(t, -int32(16*(len(h)+1)), int32(binary.BigEndian.Uint32(region[8:12])))
+	}
+
+	_, _, err = readRPMHeader(bytes.NewReader(encoded[:len(encoded)-1]))
+	assert.Error(t, err)
+	_, _, err = readRPMHeader(bytes.NewReader([]byte("not an rpm header")))
+	assert.Error(t, err)
+
+	corrupt := append([]byte{}, encoded...)
+	binary.BigEndian.PutUint32(corrupt[16+16+8:], 0xffff)
+	_, _, err = readRPMHeader(bytes.NewReader(corrupt))
+	assert.Error(t, err)
+}
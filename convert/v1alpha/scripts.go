@@ -0,0 +1,168 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// scriptSlot is an action a maintainer script is run for and the argument it is run with
+type scriptSlot struct {
+	actionType pkg.ActionType
+	after      bool
+	argument   string
+}
+
+// script maps a maintainer script to the actions it is run for
+type script struct {
+	name  string
+	slots []scriptSlot
+}
+
+// importScript installs a maintainer script below ScriptDir and adds command actions running it with interpreter
+// for each of its slots. Scripts without an interpreter are executed directly.
+func importScript(w *pkg.PackageWriter, s script, interpreter []string, contents []byte) error {
+	manifest := w.Manifest()
+	p := scriptPath(manifest.Name, s.name)
+	if err := w.AddFile(&pkg.File{Path: p, Type: pkg.ExecutableFile, Mode: 0755}, bytes.NewReader(contents)); err != nil {
+		return err
+	}
+	for _, slot := range s.slots {
+		action := manifest.Actions.Find(slot.actionType)
+		if action == nil {
+			action = &pkg.Action{Type: slot.actionType}
+			manifest.Actions = append(manifest.Actions, action)
+		}
+		command := append(append([]string{}, interpreter...), p, slot.argument)
+		item := &pkg.ActionItem{Values: &pkg.CommandAction{Command: command}}
+		if slot.after {
+			action.After = append(action.After, item)
+		} else {
+			action.Before = append(action.Before, item)
+		}
+	}
+	return nil
+}
+
+// shellQuote quotes a word for a POSIX shell
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./=:") == "" {
+		return word
+	}
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
+
+// shellCommand formats a command action as a shell command line
+func shellCommand(c *pkg.CommandAction) string {
+	var words []string
+	if c.User != "" {
+		words = append(words, "runuser", "-u", c.User, "--")
+	}
+	if len(c.Env) > 0 {
+		words = append(words, "env")
+		var keys []string
+		for key := range c.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			words = append(words, key+"="+c.Env[key])
+		}
+	}
+	words = append(words, c.Command...)
+	for i, word := range words {
+		words[i] = shellQuote(word)
+	}
+	line := strings.Join(words, " ")
+	if c.Dir != "" {
+		line = fmt.Sprintf("(cd %s && %s)", shellQuote(c.Dir), line)
+	}
+	return line
+}
+
+// exportScript returns the maintainer script running the command actions of the slots of s and its interpreter.
+// A script imported by importScript is exported unchanged if no other action items run for the script, provided it
+// was imported with an interpreter if and only if interpreted is set. Otherwise a shell script running the commands
+// depending on its first argument is generated. Only command actions can be exported, an argument shared by several
+// slots runs the items of the first slot that has any.
+func exportScript(p *pkg.PackageReader, s script, interpreted bool, exported map[string]bool) ([]byte, []string, error) {
+	manifest := p.Manifest()
+	imported := scriptPath(manifest.Name, s.name)
+
+	var arguments []string
+	commands := map[string][]*pkg.CommandAction{}
+	var interpreter []string
+	verbatim := manifest.Files.Find(imported) != nil
+	for _, slot := range s.slots {
+		action := manifest.Actions.Find(slot.actionType)
+		if action == nil || len(commands[slot.argument]) > 0 {
+			continue
+		}
+		items := action.Before
+		if slot.after {
+			items = action.After
+		}
+		for _, item := range items {
+			command, ok := item.Values.(*pkg.CommandAction)
+			if !ok {
+				return nil, nil, fmt.Errorf("cannot export %s action item of kind %s", slot.actionType, item.Values.Kind())
+			}
+			if len(commands[slot.argument]) == 0 {
+				arguments = append(arguments, slot.argument)
+			}
+			commands[slot.argument] = append(commands[slot.argument], command)
+
+			n := len(command.Command)
+			if n < 2 || command.Command[n-2] != imported || command.Command[n-1] != slot.argument ||
+				command.Dir != "" || len(command.Env) > 0 || command.User != "" ||
+				(interpreter != nil && strings.Join(interpreter, " ") != strings.Join(command.Command[:n-2], " ")) {
+				verbatim = false
+			} else {
+				interpreter = command.Command[:n-2]
+			}
+		}
+	}
+	if len(arguments) == 0 {
+		return nil, nil, nil
+	}
+	if verbatim && interpreted == (len(interpreter) > 0) {
+		r, err := p.Open(imported)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer r.Close()
+		contents, err := ioutil.ReadAll(r)
+		exported[imported] = true
+		return contents, interpreter, err
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nset -e\n\ncase \"$1\" in\n")
+	for _, argument := range arguments {
+		fmt.Fprintf(&b, "%s)\n", argument)
+		for _, command := range commands[argument] {
+			fmt.Fprintf(&b, "\t%s\n", shellCommand(command))
+		}
+		b.WriteString("\t;;\n")
+	}
+	b.WriteString("esac\n")
+	return []byte(b.String()), []string{"/bin/sh"}, nil
+}
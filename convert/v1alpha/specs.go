@@ -0,0 +1,46 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"path"
+	"strings"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+const (
+	// ScriptDir is the directory imported maintainer scripts are installed to
+	ScriptDir = "/var/lib/lime/scripts"
+)
+
+// ImportResult is the result of importing a foreign package
+type ImportResult struct {
+	Package  *pkg.PackageWriter // Package writes the imported lime package
+	Skipped  []string           // Skipped are entries that cannot be represented, such as symbolic links or lua scriptlets
+	Unmapped []string           // Unmapped are dependencies that cannot be represented, such as alternatives
+}
+
+// packageName converts the name of a foreign package to a lime package name. Lime package names are lower case and
+// cannot contain plus signs or periods, so they are replaced by "plus" and a hyphen.
+func packageName(name string) (pkg.PackageName, error) {
+	converted := pkg.PackageName(strings.NewReplacer("+", "plus", ".", "-").Replace(strings.ToLower(name)))
+	return converted, converted.Valid()
+}
+
+// scriptPath returns the path an imported maintainer script of a package is installed to
+func scriptPath(name pkg.PackageName, script string) string {
+	return path.Join(ScriptDir, string(name)+"."+script)
+}
@@ -17,6 +17,7 @@ package v1alpha
 import (
 	"crypto"
 	"crypto/x509"
+	"encoding/json"
 	"math/big"
 	"net"
 	"net/url"
@@ -25,37 +26,71 @@ import (
 
 // CertificateName contains subject fields
 type CertificateName struct {
-	C            string `yaml:"C"`                      // Country
-	ST           string `yaml:"ST"`                     // Province
-	L            string `yaml:"L"`                      // Locality
-	O            string `yaml:"O"`                      // OrganizationName
-	OU           string `yaml:"OU,omitempty"`           // OrganizationalUnitName
-	SerialNumber string `yaml:"serialNumber,omitempty"` // SerialNumber
+	C            string `yaml:"C" json:"C"`                                           // Country
+	ST           string `yaml:"ST" json:"ST"`                                         // Province
+	L            string `yaml:"L" json:"L"`                                           // Locality
+	O            string `yaml:"O" json:"O"`                                           // OrganizationName
+	OU           string `yaml:"OU,omitempty" json:"OU,omitempty"`                     // OrganizationalUnitName
+	SerialNumber string `yaml:"serialNumber,omitempty" json:"serialNumber,omitempty"` // SerialNumber
 }
 
 // CertificateKeyRequest represents a certificate key
 type CertificateKeyRequest struct {
-	Algorithm KeyAlgorithm `yaml:"algorithm"` // Algorithm
-	Size      int          `yaml:"size"`      // Size
+	Algorithm KeyAlgorithm `yaml:"algorithm" json:"algorithm"` // Algorithm
+	Size      int          `yaml:"size" json:"size"`           // Size
 }
 
 // CertificatePath represents the the full paths for the requested certificate
 type CertificatePath struct {
-	Certificate string `yaml:"cert"` // Certificate is full path of the certificate
-	Key         string `yaml:"key"`  // Key is full path of the private key
+	Certificate string `yaml:"cert" json:"cert"` // Certificate is full path of the certificate
+	Key         string `yaml:"key" json:"key"`   // Key is full path of the private key
 }
 
 // CertificateRequest represents a certificate request
 type CertificateRequest struct {
-	Key          CertificateKeyRequest `yaml:"key"`                    // Key
-	CommonName   string                `yaml:"commonName,omitempty"`   // CommonName
-	Names        []CertificateName     `yaml:"names,omitempty"`        // Names
-	Hosts        []string              `yaml:"hosts,omitempty"`        // Hosts
-	SerialNumber string                `yaml:"serialNumber,omitempty"` // SerialNumber
-	Usage        []string              `yaml:"usage,omitempty"`        // Usage
-	Expires      time.Duration         `yaml:"expires,omitempty"`      // Expires
-	IsCA         bool                  `yaml:"ca,omitempty"`           // Certificate Authority
-	Path         CertificatePath       `yaml:"path"`                   // Path
+	Key          CertificateKeyRequest `yaml:"key" json:"key"`                                       // Key
+	CommonName   string                `yaml:"commonName,omitempty" json:"commonName,omitempty"`     // CommonName
+	Names        []CertificateName     `yaml:"names,omitempty" json:"names,omitempty"`               // Names
+	Hosts        []string              `yaml:"hosts,omitempty" json:"hosts,omitempty"`               // Hosts
+	SerialNumber string                `yaml:"serialNumber,omitempty" json:"serialNumber,omitempty"` // SerialNumber
+	Usage        []string              `yaml:"usage,omitempty" json:"usage,omitempty"`               // Usage
+	Expires      time.Duration         `yaml:"expires,omitempty" json:"expires,omitempty"`           // Expires
+	IsCA         bool                  `yaml:"ca,omitempty" json:"ca,omitempty"`                     // Certificate Authority
+	Path         CertificatePath       `yaml:"path" json:"path"`                                     // Path
+}
+
+// certificateRequestJSON is the json encoding of a CertificateRequest, its expiry is a duration string like in yaml
+// documents
+type certificateRequestJSON struct {
+	*plainCertificateRequest
+	Expires string `json:"expires,omitempty"`
+}
+
+type plainCertificateRequest CertificateRequest
+
+// MarshalJSON implements custom marshalling for CertificateRequest
+func (r CertificateRequest) MarshalJSON() ([]byte, error) {
+	encoded := certificateRequestJSON{plainCertificateRequest: (*plainCertificateRequest)(&r)}
+	if r.Expires != 0 {
+		encoded.Expires = r.Expires.String()
+	}
+	return json.Marshal(&encoded)
+}
+
+// UnmarshalJSON implements custom unmarshal for CertificateRequest
+func (r *CertificateRequest) UnmarshalJSON(data []byte) error {
+	decoded := certificateRequestJSON{plainCertificateRequest: (*plainCertificateRequest)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Expires != "" {
+		expires, err := time.ParseDuration(decoded.Expires)
+		if err != nil {
+			return err
+		}
+		r.Expires = expires
+	}
+	return nil
 }
 
 // CertificateRequests is a list of certificate requests
@@ -63,10 +98,10 @@ type CertificateRequests []*CertificateKeyRequest
 
 // CertificatePackage represents a package of certificates
 type CertificatePackage struct {
-	CertificateAuthorityRequest *CertificateRequest `yaml:"caRequest,omitempty"` // CertificateAuthorityRequest is the certificate authority request
-	CertificateAuthority        string              `yaml:"ca,omitempty"`        // CertificateAuthority is the pem encoded certificate authority
-	CertificateAuthorityKey     string              `yaml:"caKey,omitempty"`     // CertificateAuthorityKey is the pem encoded private key of the certificate authority
-	Requests                    CertificateRequests `yaml:"requests,omitempty"`  // Requests is a list of certificates to use the CA
+	CertificateAuthorityRequest *CertificateRequest `yaml:"caRequest,omitempty" json:"caRequest,omitempty"` // CertificateAuthorityRequest is the certificate authority request
+	CertificateAuthority        string              `yaml:"ca,omitempty" json:"ca,omitempty"`               // CertificateAuthority is the pem encoded certificate authority
+	CertificateAuthorityKey     string              `yaml:"caKey,omitempty" json:"caKey,omitempty"`         // CertificateAuthorityKey is the pem encoded private key of the certificate authority
+	Requests                    CertificateRequests `yaml:"requests,omitempty" json:"requests,omitempty"`   // Requests is a list of certificates to use the CA
 }
 
 // CertificateHosts is a generic interface for hosts
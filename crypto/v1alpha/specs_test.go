@@ -15,8 +15,11 @@
 package v1alpha
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/limejuice-cc/api/helper"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
@@ -62,3 +65,41 @@ func TestParseCertificateKeyRequest(t *testing.T) {
 		assert.NoError(t, yaml.Unmarshal(out, &k))
 	}
 }
+
+func TestCertificateRequestEncodings(t *testing.T) {
+	request := CertificateRequest{
+		Key:        CertificateKeyRequest{RSAKey, RSAKey.DefaultSize()},
+		CommonName: "test",
+		Names:      []CertificateName{{C: "US", ST: "CA", L: "San Francisco", O: "Test"}},
+		Hosts:      []string{"localhost", "127.0.0.1"},
+		Expires:    time.Hour,
+		IsCA:       true,
+		Path:       CertificatePath{Certificate: "/etc/test.crt", Key: "/etc/test.key"},
+	}
+
+	out, err := json.Marshal(&request)
+	if assert.NoError(t, err) {
+		var document map[string]interface{}
+		if assert.NoError(t, json.Unmarshal(out, &document)) {
+			assert.Equal(t, "1h0m0s", document["expires"])
+			assert.Equal(t, true, document["ca"])
+		}
+		var decoded CertificateRequest
+		if assert.NoError(t, json.Unmarshal(out, &decoded)) {
+			assert.Equal(t, request, decoded)
+		}
+	}
+
+	out, err = helper.MarshalTOML(&request)
+	if assert.NoError(t, err) {
+		var decoded CertificateRequest
+		if assert.NoError(t, helper.UnmarshalTOML(out, &decoded)) {
+			assert.Equal(t, request, decoded)
+		}
+	}
+
+	var decoded CertificateRequest
+	assert.Error(t, json.Unmarshal([]byte(`{"expires": "soon"}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"key": {"algorithm": "unknown"}}`), &decoded))
+	assert.Error(t, helper.UnmarshalTOML([]byte(`expires = "soon"`), &decoded))
+}
@@ -3,6 +3,9 @@ module github.com/limejuice-cc/api
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.0
+	github.com/klauspost/compress v1.11.13
 	github.com/stretchr/testify v1.6.1
+	github.com/ulikunitz/xz v0.5.10
 	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,92 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MarshalTOML encodes v as a TOML document. The document is derived from the json encoding of v, so that TOML
+// documents have the same field names as json and yaml documents. v must encode as a json object.
+func MarshalTOML(v interface{}) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(encoded))
+	d.UseNumber()
+	var document interface{}
+	if err = d.Decode(&document); err != nil {
+		return nil, err
+	}
+	table, ok := tomlValue(document).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T as a TOML table", v)
+	}
+
+	var out bytes.Buffer
+	if err = toml.NewEncoder(&out).Encode(table); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// UnmarshalTOML decodes a TOML document into v. The document is decoded through the json decoding of v, so that
+// TOML documents are validated like json and yaml documents.
+func UnmarshalTOML(data []byte, v interface{}) error {
+	var document map[string]interface{}
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// tomlValue converts a decoded json value to a value the TOML encoder accepts. Numbers become integers where
+// possible and null values are dropped, TOML has no null.
+func tomlValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, field := range value {
+			if field == nil {
+				delete(value, k)
+			} else {
+				value[k] = tomlValue(field)
+			}
+		}
+	case []interface{}:
+		elements := value[:0]
+		for _, element := range value {
+			if element != nil {
+				elements = append(elements, tomlValue(element))
+			}
+		}
+		return elements
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+const (
+	// newConfigFileExtension is the file extension of a new configuration file version that was not installed
+	newConfigFileExtension = ".lime-new"
+	// localConfigFileExtension is the file extension of a locally modified configuration file that was replaced
+	localConfigFileExtension = ".lime-local"
+)
+
+// ConfigFilePrompter decides whether a locally modified configuration file is replaced by the new version of a
+// package. It is used by the AskConfigFile policy.
+type ConfigFilePrompter interface {
+	ReplaceConfigFile(manifest *pkg.Manifest, file *pkg.File, path string) (bool, error)
+}
+
+// hashFile returns the SHA256 hash of a file and whether it exists
+func hashFile(path string) (string, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", true, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// installConfigFile installs a staged configuration file using a three-way comparison of the hash the previous
+// package listed, the hash of the file on disk and the hash of the new version. An unmodified or missing file is
+// replaced and a modified file is kept if the new package does not change it. Otherwise the configuration file
+// policy decides whether the modified file is kept, writing the new version with the .lime-new extension, or
+// replaced, keeping the modified file with the .lime-local extension.
+func (t *transaction) installConfigFile(manifest *pkg.Manifest, file *pkg.File, original string, target, staged string) error {
+	current, exists, err := hashFile(target)
+	if err != nil {
+		return err
+	}
+	if !exists || current == original || current == file.SHA256 {
+		return t.replace(target, staged)
+	}
+	if original == file.SHA256 {
+		return os.Remove(staged)
+	}
+
+	replace, err := t.replaceModifiedConfigFile(manifest, file, target)
+	if err != nil {
+		return err
+	}
+	if !replace {
+		return t.replace(target+newConfigFileExtension, staged)
+	}
+
+	local := target + localConfigFileExtension
+	if err = copyFile(target, local+stagedFileExtension); err != nil {
+		return err
+	}
+	if err = t.replace(local, local+stagedFileExtension); err != nil {
+		return err
+	}
+	return t.replace(target, staged)
+}
+
+// removeConfigFile removes a purged configuration file together with the new and locally modified versions kept
+// next to it
+func (t *transaction) removeConfigFile(target string) error {
+	for _, path := range []string{target, target + newConfigFileExtension, target + localConfigFileExtension} {
+		if err := t.removeFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceModifiedConfigFile applies the configuration file policy of the engine to a modified configuration file
+func (t *transaction) replaceModifiedConfigFile(manifest *pkg.Manifest, file *pkg.File, target string) (bool, error) {
+	switch t.engine.configFilePolicy {
+	case ReplaceConfigFile:
+		return true, nil
+	case AskConfigFile:
+		if t.engine.configFilePrompter == nil {
+			return false, fmt.Errorf("no configuration file prompter")
+		}
+		return t.engine.configFilePrompter.ReplaceConfigFile(manifest, file, target)
+	default:
+		return false, nil
+	}
+}
+
+// copyFile copies the contents and mode of a file
+func copyFile(source, dest string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
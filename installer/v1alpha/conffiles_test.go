@@ -0,0 +1,97 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPrompter struct {
+	replace bool
+	asked   []string
+}
+
+func (p *testPrompter) ReplaceConfigFile(manifest *pkg.Manifest, file *pkg.File, path string) (bool, error) {
+	p.asked = append(p.asked, file.Path)
+	return p.replace, nil
+}
+
+func testConfigPackage(t *testing.T, version, contents string) *pkg.PackageReader {
+	return testPackageReader(t, "app", version, nil, testFile{&pkg.File{Path: "/etc/app.conf", Type: pkg.ConfigurationFile}, contents})
+}
+
+func TestEngineConfigFiles(t *testing.T) {
+	dir, _, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "root", "etc", "app.conf")
+	upgrade := func(version, contents string) error {
+		return engine.Apply(&Operation{Type: pkg.Upgrade, Package: testConfigPackage(t, version, contents)})
+	}
+
+	if !assert.NoError(t, upgrade("1.0.0", "v1")) || !assert.NoError(t, upgrade("2.0.0", "v2")) {
+		return
+	}
+	assert.Equal(t, "v2", readFile(t, conf))
+
+	assert.NoError(t, ioutil.WriteFile(conf, []byte("local"), 0644))
+	assert.NoError(t, upgrade("2.0.1", "v2"))
+	assert.Equal(t, "local", readFile(t, conf))
+	assert.Equal(t, "", readFile(t, conf+newConfigFileExtension))
+
+	assert.NoError(t, upgrade("3.0.0", "v3"))
+	assert.Equal(t, "local", readFile(t, conf))
+	assert.Equal(t, "v3", readFile(t, conf+newConfigFileExtension))
+
+	engine.SetConfigFilePolicy(ReplaceConfigFile, nil)
+	assert.NoError(t, upgrade("4.0.0", "v4"))
+	assert.Equal(t, "v4", readFile(t, conf))
+	assert.Equal(t, "local", readFile(t, conf+localConfigFileExtension))
+
+	assert.NoError(t, ioutil.WriteFile(conf, []byte("edited"), 0644))
+	engine.SetConfigFilePolicy(AskConfigFile, nil)
+	assert.Error(t, upgrade("5.0.0", "v5"))
+	assert.Equal(t, "edited", readFile(t, conf))
+
+	prompter := &testPrompter{}
+	engine.SetConfigFilePolicy(AskConfigFile, prompter)
+	assert.NoError(t, upgrade("5.0.0", "v5"))
+	assert.Equal(t, "edited", readFile(t, conf))
+	assert.Equal(t, "v5", readFile(t, conf+newConfigFileExtension))
+
+	prompter.replace = true
+	assert.NoError(t, upgrade("6.0.0", "v6"))
+	assert.Equal(t, "v6", readFile(t, conf))
+	assert.Equal(t, "edited", readFile(t, conf+localConfigFileExtension))
+	assert.Equal(t, []string{"/etc/app.conf", "/etc/app.conf"}, prompter.asked)
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "root", "etc", "*.lime-old*"))
+	assert.Empty(t, matches)
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "app"}))
+	assert.Equal(t, "v6", readFile(t, conf))
+	assert.Equal(t, "v5", readFile(t, conf+newConfigFileExtension))
+	assert.Equal(t, "edited", readFile(t, conf+localConfigFileExtension))
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Purge, Name: "app"}))
+	matches, _ = filepath.Glob(filepath.Join(dir, "root", "etc", "*"))
+	assert.Empty(t, matches)
+}
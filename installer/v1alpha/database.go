@@ -0,0 +1,184 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/limejuice-cc/api/helper"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// databaseRecordExtension is the file extension of installed package records
+	databaseRecordExtension = ".yaml"
+)
+
+// Database is the database of installed packages. Each package is recorded in its own file which is replaced
+// atomically, so the database remains consistent if the process crashes while it is being updated.
+type Database struct {
+	dir      string
+	mutex    sync.RWMutex
+	packages map[pkg.PackageName]*InstalledPackage
+}
+
+// OpenDatabase opens the installed package database stored in dir, creating it if it does not exist
+func OpenDatabase(dir string) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Database{dir: dir, packages: map[pkg.PackageName]*InstalledPackage{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, databaseRecordExtension) {
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		p := &InstalledPackage{}
+		if err = yaml.Unmarshal(raw, p); err != nil {
+			return nil, fmt.Errorf("cannot decode installed package %s: %s", name, err)
+		}
+		if p.Manifest == nil {
+			return nil, fmt.Errorf("installed package %s has no manifest", name)
+		}
+		d.packages[p.Name()] = p
+	}
+	return d, nil
+}
+
+func (d *Database) recordPath(name pkg.PackageName) string {
+	return filepath.Join(d.dir, string(name)+databaseRecordExtension)
+}
+
+// Get returns the installed package with the given name
+func (d *Database) Get(name pkg.PackageName) (*InstalledPackage, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	p, found := d.packages[name]
+	return p, found
+}
+
+// List returns all installed packages ordered by name
+func (d *Database) List() []*InstalledPackage {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	out := make([]*InstalledPackage, 0, len(d.packages))
+	for _, p := range d.packages {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out
+}
+
+// Manifests returns the manifests of all installed packages ordered by name
+func (d *Database) Manifests() []*pkg.Manifest {
+	installed := d.List()
+	out := make([]*pkg.Manifest, 0, len(installed))
+	for _, p := range installed {
+		out = append(out, p.Manifest)
+	}
+	return out
+}
+
+// Put records an installed package, replacing any existing record
+func (d *Database) Put(p *InstalledPackage) error {
+	if p.Manifest == nil {
+		return fmt.Errorf("installed package has no manifest")
+	}
+	if p.Name() == "" {
+		return fmt.Errorf("installed package has no name")
+	}
+	if err := p.Name().Valid(); err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err = helper.WriteFileAtomic(d.recordPath(p.Name()), raw, 0644); err != nil {
+		return err
+	}
+	d.packages[p.Name()] = p
+	return nil
+}
+
+// Delete removes the record of an installed package
+func (d *Database) Delete(name pkg.PackageName) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if err := os.Remove(d.recordPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(d.packages, name)
+	return nil
+}
+
+// Owners returns the installed packages that own the file at path
+func (d *Database) Owners(path string) []*InstalledPackage {
+	var out []*InstalledPackage
+	for _, p := range d.List() {
+		if p.Files.Find(path) != nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ReverseDependencies returns the installed packages that depend or predepend on the named package, either directly
+// or through a virtual package that it provides
+func (d *Database) ReverseDependencies(name pkg.PackageName) []*InstalledPackage {
+	target, found := d.Get(name)
+
+	provided := map[pkg.PackageName]bool{name: true}
+	if found {
+		for _, dep := range target.Manifest.Dependencies {
+			if dep.Relationship == pkg.Provides {
+				provided[dep.Name] = true
+			}
+		}
+	}
+
+	var out []*InstalledPackage
+	for _, p := range d.List() {
+		if p.Name() == name {
+			continue
+		}
+		for _, dep := range p.Manifest.Dependencies {
+			if (dep.Relationship == pkg.Depends || dep.Relationship == pkg.Predepends) && provided[dep.Name] {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testInstalledPackage(name string, files []string, deps ...*pkg.Dependency) *InstalledPackage {
+	p := &InstalledPackage{
+		Manifest:  &pkg.Manifest{Name: pkg.PackageName(name), Version: common.Version{Major: 1}, Dependencies: deps},
+		State:     Configured,
+		Installed: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, path := range files {
+		p.Files = append(p.Files, &pkg.File{Path: path, Type: pkg.DataFile, SHA256: "0000", Mode: 0644})
+	}
+	p.Manifest.Files = p.Files
+	return p
+}
+
+func TestDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "database")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := OpenDatabase(filepath.Join(dir, "db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, d.List())
+
+	assert.NoError(t, d.Put(testInstalledPackage("libc", []string{"/lib/libc.so"})))
+	assert.NoError(t, d.Put(testInstalledPackage("postfix", []string{"/etc/postfix/main.cf", "/usr/share/doc/common"},
+		&pkg.Dependency{Name: "mta", Relationship: pkg.Provides})))
+	assert.NoError(t, d.Put(testInstalledPackage("app", []string{"/usr/bin/app", "/usr/share/doc/common"},
+		&pkg.Dependency{Name: "libc", Relationship: pkg.Depends},
+		&pkg.Dependency{Name: "mta", Relationship: pkg.Predepends})))
+	assert.Error(t, d.Put(&InstalledPackage{}))
+	assert.Error(t, d.Put(testInstalledPackage("Invalid Name", nil)))
+	assert.Error(t, d.Put(testInstalledPackage("", nil)))
+	_, err = os.Stat(filepath.Join(dir, "db", databaseRecordExtension))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "db", ".app.yaml123"), []byte("partial"), 0644))
+
+	d, err = OpenDatabase(filepath.Join(dir, "db"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, d.List(), 3)
+	assert.Len(t, d.Manifests(), 3)
+
+	app, found := d.Get("app")
+	if assert.True(t, found) {
+		assert.Equal(t, Configured, app.State)
+		assert.Equal(t, 0644, app.Files[0].Mode)
+		assert.Equal(t, time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), app.Installed)
+	}
+
+	owners := d.Owners("/etc/postfix/main.cf")
+	if assert.Len(t, owners, 1) {
+		assert.Equal(t, pkg.PackageName("postfix"), owners[0].Name())
+	}
+	assert.Len(t, d.Owners("/usr/share/doc/common"), 2)
+	assert.Empty(t, d.Owners("/etc/missing"))
+
+	for _, name := range []pkg.PackageName{"libc", "postfix"} {
+		reverse := d.ReverseDependencies(name)
+		if assert.Len(t, reverse, 1) {
+			assert.Equal(t, pkg.PackageName("app"), reverse[0].Name())
+		}
+	}
+	assert.Empty(t, d.ReverseDependencies("app"))
+
+	app.State = HalfInstalled
+	assert.NoError(t, d.Put(app))
+	assert.NoError(t, d.Delete("libc"))
+	assert.NoError(t, d.Delete("libc"))
+
+	d, err = OpenDatabase(filepath.Join(dir, "db"))
+	if assert.NoError(t, err) {
+		assert.Len(t, d.List(), 2)
+		app, _ = d.Get("app")
+		assert.Equal(t, HalfInstalled, app.State)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "db", "broken.yaml"), []byte("[1,2,3]"), 0644))
+	_, err = OpenDatabase(filepath.Join(dir, "db"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"github.com/limejuice-cc/api/helper"
+)
+
+// *** PackageState ***
+
+// PackageState specifies the installation state of a package
+type PackageState int
+
+const (
+	_ PackageState = iota
+	// HalfInstalled indicates that the installation of the package was started but not completed
+	HalfInstalled
+	// Unpacked indicates that the package files are installed but the package is not configured
+	Unpacked
+	// Configured indicates that the package is fully installed and configured
+	Configured
+	// ConfigFiles indicates that the package was removed but its configuration files remain
+	ConfigFiles
+)
+
+var packageStateValues = helper.EnumeratorValues{
+	"half-installed": HalfInstalled,
+	"unpacked":       Unpacked,
+	"configured":     Configured,
+	"config-files":   ConfigFiles,
+}
+
+// String implements the Stringer interface.
+func (s PackageState) String() string {
+	return packageStateValues.AsString(s)
+}
+
+// ParsePackageState attempts to convert a string to a PackageState
+func ParsePackageState(name string) (PackageState, error) {
+	x, err := packageStateValues.Parse(name)
+	if err != nil {
+		return PackageState(0), err
+	}
+	return x.(PackageState), nil
+}
+
+// MarshalText implements the text marshaller method
+func (s PackageState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (s *PackageState) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParsePackageState(name)
+	if err != nil {
+		return err
+	}
+	*s = tmp
+	return nil
+}
+
+// *** ConfigFilePolicy ***
+
+// ConfigFilePolicy specifies how a locally modified configuration file is handled when an upgrade changes it
+type ConfigFilePolicy int
+
+const (
+	_ ConfigFilePolicy = iota
+	// KeepConfigFile indicates that the local file is kept and the new version is written alongside it
+	KeepConfigFile
+	// ReplaceConfigFile indicates that the local file is replaced and kept alongside the new version
+	ReplaceConfigFile
+	// AskConfigFile indicates that a ConfigFilePrompter decides whether to keep or replace the local file
+	AskConfigFile
+)
+
+var configFilePolicyValues = helper.EnumeratorValues{
+	"keep":    KeepConfigFile,
+	"replace": ReplaceConfigFile,
+	"ask":     AskConfigFile,
+}
+
+// String implements the Stringer interface.
+func (p ConfigFilePolicy) String() string {
+	return configFilePolicyValues.AsString(p)
+}
+
+// ParseConfigFilePolicy attempts to convert a string to a ConfigFilePolicy
+func ParseConfigFilePolicy(name string) (ConfigFilePolicy, error) {
+	x, err := configFilePolicyValues.Parse(name)
+	if err != nil {
+		return ConfigFilePolicy(0), err
+	}
+	return x.(ConfigFilePolicy), nil
+}
+
+// MarshalText implements the text marshaller method
+func (p ConfigFilePolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (p *ConfigFilePolicy) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseConfigFilePolicy(name)
+	if err != nil {
+		return err
+	}
+	*p = tmp
+	return nil
+}
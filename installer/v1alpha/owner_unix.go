@@ -0,0 +1,75 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package v1alpha
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// chown sets the owner of an installed file to the user and group of file, which are looked up by name or given as
+// numeric ids. The owner is left unchanged if file has no user and group. Setting another owner requires root
+// privileges.
+func chown(f *os.File, file *pkg.File) error {
+	uid, err := lookupOwnerID(file.User, func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	})
+	if err != nil {
+		return err
+	}
+	gid, err := lookupOwnerID(file.Group, func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	})
+	if err != nil {
+		return err
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	if err = f.Chown(uid, gid); err != nil {
+		return fmt.Errorf("cannot set owner of %s to %s:%s, which requires root privileges: %s", file.Path, file.User, file.Group, err)
+	}
+	return nil
+}
+
+// lookupOwnerID returns the numeric id of a user or group name, or -1 if name is empty
+func lookupOwnerID(name string, lookup func(string) (string, error)) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"time"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// InstalledPackage is a package recorded in the installed package database
+type InstalledPackage struct {
+	Manifest  *pkg.Manifest `yaml:"manifest" json:"manifest"`               // Manifest is the manifest of the installed package
+	State     PackageState  `yaml:"state" json:"state"`                     // State is the installation state of the package
+	Installed time.Time     `yaml:"installed" json:"installed"`             // Installed is the datetime that the package was installed
+	Files     pkg.Files     `yaml:"files,omitempty" json:"files,omitempty"` // Files are the files owned by the package as installed
+}
+
+// Name returns the name of the installed package
+func (p *InstalledPackage) Name() pkg.PackageName {
+	return p.Manifest.Name
+}
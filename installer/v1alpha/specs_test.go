@@ -0,0 +1,73 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParsePackageState(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome PackageState
+	}{
+		{"half-installed", HalfInstalled},
+		{"unpacked", Unpacked},
+		{"configured", Configured},
+		{"config-files", ConfigFiles},
+	}
+
+	for _, v := range testValues {
+		s, err := ParsePackageState(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, s)
+			assert.Equal(t, v.value, s.String())
+		}
+	}
+
+	_, err := ParsePackageState("")
+	assert.Error(t, err)
+	assert.Equal(t, "", PackageState(0).String())
+
+	var ps PackageState
+	assert.Error(t, yaml.Unmarshal([]byte("[1,2,3]"), &ps))
+	assert.Error(t, yaml.Unmarshal([]byte("unknown"), &ps))
+}
+
+func TestParseConfigFilePolicy(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome ConfigFilePolicy
+	}{
+		{"keep", KeepConfigFile},
+		{"replace", ReplaceConfigFile},
+		{"ask", AskConfigFile},
+	}
+
+	for _, v := range testValues {
+		p, err := ParseConfigFilePolicy(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, p)
+			assert.Equal(t, v.value, p.String())
+		}
+	}
+
+	_, err := ParseConfigFilePolicy("")
+	assert.Error(t, err)
+	assert.Equal(t, "", ConfigFilePolicy(0).String())
+}
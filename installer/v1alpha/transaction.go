@@ -0,0 +1,629 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+const (
+	// stagedFileExtension is the file extension of files staged for installation
+	stagedFileExtension = ".lime-stage"
+	// backupFileExtension is the file extension of files replaced or removed by a transaction
+	backupFileExtension = ".lime-old"
+	// defaultFileMode is the mode of installed files that do not specify a mode
+	defaultFileMode = 0644
+)
+
+// ActionExecutor executes package action items
+type ActionExecutor interface {
+	Execute(manifest *pkg.Manifest, actionType pkg.ActionType, item *pkg.ActionItem) error
+}
+
+// Operation is a package operation within a transaction
+type Operation struct {
+	Type    pkg.ActionType     // Type is the type of operation
+	Name    pkg.PackageName    // Name is the name of the package to reconfigure, remove or purge
+	Package *pkg.PackageReader // Package is the package to install or upgrade to
+}
+
+// packageName returns the name of the package the operation applies to
+func (o *Operation) packageName() pkg.PackageName {
+	if o.Package != nil {
+		return o.Package.Manifest().Name
+	}
+	return o.Name
+}
+
+// Engine applies transactions of package operations to a root filesystem
+type Engine struct {
+	root               string
+	db                 *Database
+	executor           ActionExecutor
+	configFilePolicy   ConfigFilePolicy
+	configFilePrompter ConfigFilePrompter
+}
+
+// NewEngine creates a new Engine that installs packages below root, records them in db and executes action items
+// using executor
+func NewEngine(root string, db *Database, executor ActionExecutor) *Engine {
+	return &Engine{root: root, db: db, executor: executor, configFilePolicy: KeepConfigFile}
+}
+
+// SetConfigFilePolicy sets how locally modified configuration files are handled when a package changes them. The
+// prompter is only used by the AskConfigFile policy.
+func (e *Engine) SetConfigFilePolicy(policy ConfigFilePolicy, prompter ConfigFilePrompter) {
+	e.configFilePolicy = policy
+	e.configFilePrompter = prompter
+}
+
+// Apply applies the operations in order as a single transaction. The files of all installed packages are staged
+// before any operation is applied. An upgrade runs the remove action items of the installed version around those of
+// the upgrade action of the new version. Triggers activated by the operations fire once after all operations are
+// applied. If any step fails the filesystem and the installed package database are rolled back to their state before
+// the transaction, action items that have already been executed are not undone. Once all steps succeeded the
+// transaction is committed and is no longer rolled back, even if backups of replaced files cannot be removed.
+func (e *Engine) Apply(operations ...*Operation) (err error) {
+	t := &transaction{
+		engine:    e,
+		snapshots: map[pkg.PackageName]*InstalledPackage{},
+		staged:    map[string]string{},
+		triggers:  NewTriggerCollector(),
+	}
+	committed := false
+	defer func() {
+		if err != nil && !committed {
+			if rollbackErr := t.rollback(); rollbackErr != nil {
+				err = fmt.Errorf("%s, rollback failed: %s", err, rollbackErr)
+			}
+		}
+	}()
+
+	for _, op := range operations {
+		if err = t.validate(op); err != nil {
+			return
+		}
+	}
+	if err = t.checkConflicts(operations); err != nil {
+		return
+	}
+	if err = t.checkFileConflicts(operations); err != nil {
+		return
+	}
+	for _, op := range operations {
+		if op.Package != nil {
+			if err = t.stage(op.Package); err != nil {
+				return
+			}
+		}
+	}
+	for _, op := range operations {
+		if err = t.apply(op); err != nil {
+			return fmt.Errorf("cannot %s %s: %s", op.Type, op.packageName(), err)
+		}
+	}
+	if err = t.runTriggers(); err != nil {
+		return
+	}
+	committed = true
+	return t.commit()
+}
+
+// journalEntry records a filesystem change that can be undone
+type journalEntry struct {
+	path   string // path is the changed path
+	backup string // backup is the path of the previous contents or empty if the path did not exist
+	dir    bool   // dir indicates that the path is a created directory
+}
+
+// transaction is the state of a transaction being applied
+type transaction struct {
+	engine    *Engine
+	journal   []journalEntry
+	snapshots map[pkg.PackageName]*InstalledPackage
+	staged    map[string]string
+	triggers  *TriggerCollector
+}
+
+func (t *transaction) path(path string) string {
+	return filepath.Join(t.engine.root, filepath.FromSlash(path))
+}
+
+// validate checks that an operation can be applied
+func (t *transaction) validate(op *Operation) error {
+	switch op.Type {
+	case pkg.Install, pkg.Upgrade:
+		if op.Package == nil {
+			return fmt.Errorf("%s operation requires a package", op.Type)
+		}
+	case pkg.Reconfigure, pkg.Remove, pkg.Purge:
+		if _, found := t.engine.db.Get(op.Name); !found {
+			return fmt.Errorf("cannot %s %s: package is not installed", op.Type, op.Name)
+		}
+	default:
+		return fmt.Errorf("unknown operation %d", op.Type)
+	}
+	return nil
+}
+
+// changes returns the manifests of the packages installed by the operations and the names of the removed packages
+func changes(operations []*Operation) ([]*pkg.Manifest, map[pkg.PackageName]bool) {
+	removed := map[pkg.PackageName]bool{}
+	var installing []*pkg.Manifest
+	for _, op := range operations {
+		switch op.Type {
+		case pkg.Install, pkg.Upgrade:
+			installing = append(installing, op.Package.Manifest())
+		case pkg.Remove, pkg.Purge:
+			removed[op.Name] = true
+		}
+	}
+	return installing, removed
+}
+
+// checkConflicts checks that the packages installed by the operations do not conflict with each other or with
+// installed packages. Installed packages that are removed or upgraded by the operations or of which only
+// configuration files remain do not conflict.
+func (t *transaction) checkConflicts(operations []*Operation) error {
+	installing, removed := changes(operations)
+	for _, manifest := range installing {
+		removed[manifest.Name] = true
+	}
+	for i, manifest := range installing {
+		for _, installed := range t.engine.db.List() {
+			if removed[installed.Name()] || installed.State == ConfigFiles {
+				continue
+			}
+			if conflict := pkg.PackageConflict(manifest, installed.Manifest); conflict != "" {
+				return fmt.Errorf("cannot install %s: %s, which is installed", manifest.Name, conflict)
+			}
+		}
+		for _, other := range installing[i+1:] {
+			if conflict := pkg.PackageConflict(manifest, other); conflict != "" {
+				return fmt.Errorf("cannot install %s: %s in the same transaction", manifest.Name, conflict)
+			}
+		}
+	}
+	return nil
+}
+
+// checkFileConflicts checks that the packages installed by the operations do not list files owned by other
+// packages. Packages removed by the operations no longer own their files.
+func (t *transaction) checkFileConflicts(operations []*Operation) error {
+	installing, removed := changes(operations)
+
+	var owners []*pkg.Manifest
+	for _, installed := range t.engine.db.List() {
+		if !removed[installed.Name()] {
+			owner := *installed.Manifest
+			owner.Files = installed.Files
+			owners = append(owners, &owner)
+		}
+	}
+
+	checker := pkg.NewFileConflictChecker(owners...)
+	for i, manifest := range installing {
+		others := append(append([]*pkg.Manifest{}, installing[:i]...), installing[i+1:]...)
+		if err := checker.Check(manifest, others...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stage writes the files of a package next to their targets. Existing files at the staged paths are never
+// overwritten.
+func (t *transaction) stage(p *pkg.PackageReader) error {
+	for _, file := range p.Manifest().Files {
+		target := t.path(file.Path)
+		if err := t.mkdirAll(filepath.Dir(target)); err != nil {
+			return err
+		}
+		staged := target + stagedFileExtension
+		if _, err := os.Lstat(staged); err == nil {
+			return fmt.Errorf("cannot stage %s: %s already exists", file.Path, staged)
+		}
+		t.staged[target] = staged
+		if err := t.writeStaged(p, file, staged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStaged writes a file to its staged path with the owner and mode listed in the manifest
+func (t *transaction) writeStaged(p *pkg.PackageReader, file *pkg.File, staged string) error {
+	r, err := p.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	mode := fileMode(file.Mode)
+	if mode == 0 {
+		mode = defaultFileMode
+	}
+	f, err := os.OpenFile(staged, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err = chown(f, file); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fileMode returns the file mode of the unix permission bits mode listed in a manifest, including the setuid, setgid
+// and sticky bits
+func fileMode(mode int) os.FileMode {
+	m := os.FileMode(mode) & os.ModePerm
+	for _, bit := range []struct {
+		unix int
+		mode os.FileMode
+	}{{04000, os.ModeSetuid}, {02000, os.ModeSetgid}, {01000, os.ModeSticky}} {
+		if mode&bit.unix != 0 {
+			m |= bit.mode
+		}
+	}
+	return m
+}
+
+// snapshot records the installed state of a package before it is first changed
+func (t *transaction) snapshot(name pkg.PackageName) {
+	if _, found := t.snapshots[name]; found {
+		return
+	}
+	installed, _ := t.engine.db.Get(name)
+	t.snapshots[name] = installed
+}
+
+// put records the installed state of a package
+func (t *transaction) put(installed *InstalledPackage) error {
+	t.snapshot(installed.Name())
+	return t.engine.db.Put(installed)
+}
+
+// delete removes the installed state of a package
+func (t *transaction) delete(name pkg.PackageName) error {
+	t.snapshot(name)
+	return t.engine.db.Delete(name)
+}
+
+// execute executes the before or after action items of an action
+func (t *transaction) execute(manifest *pkg.Manifest, actionType pkg.ActionType, after bool) error {
+	action := manifest.Actions.Find(actionType)
+	if action == nil {
+		return nil
+	}
+	items := action.Before
+	if after {
+		items = action.After
+	}
+	for _, item := range items {
+		if t.engine.executor == nil {
+			return fmt.Errorf("no action executor")
+		}
+		if err := t.engine.executor.Execute(manifest, actionType, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply applies a single operation
+func (t *transaction) apply(op *Operation) error {
+	switch op.Type {
+	case pkg.Install, pkg.Upgrade:
+		return t.install(op)
+	case pkg.Reconfigure:
+		return t.reconfigure(op.Name)
+	default:
+		return t.remove(op.Name, op.Type == pkg.Purge)
+	}
+}
+
+func (t *transaction) install(op *Operation) error {
+	manifest := op.Package.Manifest()
+	previous, upgrade := t.engine.db.Get(manifest.Name)
+	actionType := pkg.Install
+	if upgrade && previous.State != ConfigFiles {
+		actionType = pkg.Upgrade
+	}
+
+	installed := &InstalledPackage{Manifest: manifest, State: HalfInstalled, Installed: time.Now().UTC()}
+	if upgrade {
+		installed.Files = previous.Files
+	}
+	if err := t.put(installed); err != nil {
+		return err
+	}
+	if actionType == pkg.Upgrade {
+		if err := t.execute(previous.Manifest, pkg.Remove, false); err != nil {
+			return err
+		}
+	}
+	if err := t.execute(manifest, actionType, false); err != nil {
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		target := t.path(file.Path)
+		if file.Type == pkg.ConfigurationFile {
+			var original string
+			if upgrade {
+				if previousFile := previous.Files.Find(file.Path); previousFile != nil {
+					original = previousFile.SHA256
+				}
+			}
+			if err := t.installConfigFile(manifest, file, original, target, t.staged[target]); err != nil {
+				return err
+			}
+		} else if err := t.replace(target, t.staged[target]); err != nil {
+			return err
+		}
+		delete(t.staged, target)
+	}
+	t.triggers.ActivatePackage(manifest, manifest.Files)
+	if err := t.takeOver(manifest); err != nil {
+		return err
+	}
+	if upgrade {
+		for _, file := range previous.Files {
+			if manifest.Files.Find(file.Path) == nil && !t.ownedByOther(manifest.Name, file.Path) {
+				if err := t.removeFile(t.path(file.Path)); err != nil {
+					return err
+				}
+				t.triggers.ActivatePath(file.Path)
+			}
+		}
+	}
+
+	installed = &InstalledPackage{Manifest: manifest, State: Unpacked, Installed: installed.Installed, Files: manifest.Files}
+	if err := t.put(installed); err != nil {
+		return err
+	}
+	if actionType == pkg.Upgrade {
+		if err := t.execute(previous.Manifest, pkg.Remove, true); err != nil {
+			return err
+		}
+	}
+	if err := t.execute(manifest, actionType, true); err != nil {
+		return err
+	}
+	installed = &InstalledPackage{Manifest: manifest, State: Configured, Installed: installed.Installed, Files: manifest.Files}
+	return t.put(installed)
+}
+
+// takeOver removes the files of manifest from the installed packages it replaces, so that removing a replaced
+// package does not remove them
+func (t *transaction) takeOver(manifest *pkg.Manifest) error {
+	for _, installed := range t.engine.db.List() {
+		if installed.Name() == manifest.Name || !pkg.ReplacesPackage(manifest, installed.Manifest) {
+			continue
+		}
+		var remaining pkg.Files
+		for _, file := range installed.Files {
+			if manifest.Files.Find(file.Path) == nil {
+				remaining = append(remaining, file)
+			}
+		}
+		if len(remaining) == len(installed.Files) {
+			continue
+		}
+		replaced := *installed
+		replaced.Files = remaining
+		if err := t.put(&replaced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transaction) reconfigure(name pkg.PackageName) error {
+	installed, _ := t.engine.db.Get(name)
+	if err := t.execute(installed.Manifest, pkg.Reconfigure, false); err != nil {
+		return err
+	}
+	if err := t.execute(installed.Manifest, pkg.Reconfigure, true); err != nil {
+		return err
+	}
+	configured := *installed
+	configured.State = Configured
+	return t.put(&configured)
+}
+
+func (t *transaction) remove(name pkg.PackageName, purge bool) error {
+	installed, _ := t.engine.db.Get(name)
+	actionType := pkg.Remove
+	if purge {
+		actionType = pkg.Purge
+	}
+	if err := t.execute(installed.Manifest, actionType, false); err != nil {
+		return err
+	}
+
+	var remaining pkg.Files
+	for _, file := range installed.Files {
+		if file.Type == pkg.ConfigurationFile && !purge {
+			remaining = append(remaining, file)
+			continue
+		}
+		if t.ownedByOther(name, file.Path) {
+			continue
+		}
+		remove := t.removeFile
+		if file.Type == pkg.ConfigurationFile {
+			remove = t.removeConfigFile
+		}
+		if err := remove(t.path(file.Path)); err != nil {
+			return err
+		}
+		t.triggers.ActivatePath(file.Path)
+	}
+	t.triggers.ActivatePackage(installed.Manifest, nil)
+
+	if len(remaining) > 0 {
+		removed := *installed
+		removed.State = ConfigFiles
+		removed.Files = remaining
+		if err := t.put(&removed); err != nil {
+			return err
+		}
+	} else if err := t.delete(name); err != nil {
+		return err
+	}
+	return t.execute(installed.Manifest, actionType, true)
+}
+
+// runTriggers runs the action items of the triggers activated by the transaction
+func (t *transaction) runTriggers() error {
+	for _, pending := range t.triggers.Pending(t.engine.db.List()) {
+		for _, item := range pending.Trigger.Items {
+			if t.engine.executor == nil {
+				return fmt.Errorf("no action executor")
+			}
+			if err := t.engine.executor.Execute(pending.Package.Manifest, pkg.Triggered, item); err != nil {
+				return fmt.Errorf("trigger of %s failed: %s", pending.Package.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// ownedByOther checks if a file is owned by an installed package other than name
+func (t *transaction) ownedByOther(name pkg.PackageName, path string) bool {
+	for _, owner := range t.engine.db.Owners(path) {
+		if owner.Name() != name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *transaction) backupPath(path string) string {
+	return path + backupFileExtension + "." + strconv.Itoa(len(t.journal))
+}
+
+// mkdirAll creates a directory and any missing parents, journaling each created directory
+func (t *transaction) mkdirAll(dir string) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", dir)
+		}
+		return nil
+	}
+	if err := t.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	t.journal = append(t.journal, journalEntry{path: dir, dir: true})
+	return nil
+}
+
+// replace moves a staged file into place, backing up any existing file
+func (t *transaction) replace(target, staged string) error {
+	entry := journalEntry{path: target}
+	if _, err := os.Lstat(target); err == nil {
+		entry.backup = t.backupPath(target)
+		if err = os.Rename(target, entry.backup); err != nil {
+			return err
+		}
+	}
+	t.journal = append(t.journal, entry)
+	return os.Rename(staged, target)
+}
+
+// removeFile removes a file by moving it to a backup
+func (t *transaction) removeFile(target string) error {
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return nil
+	}
+	backup := t.backupPath(target)
+	if err := os.Rename(target, backup); err != nil {
+		return err
+	}
+	t.journal = append(t.journal, journalEntry{path: target, backup: backup})
+	return nil
+}
+
+// commit removes backups of replaced and removed files. All backups are removed even if removing one fails, the
+// first failure is returned.
+func (t *transaction) commit() error {
+	var failed error
+	for _, entry := range t.journal {
+		if entry.backup != "" {
+			if err := os.Remove(entry.backup); err != nil && !os.IsNotExist(err) && failed == nil {
+				failed = fmt.Errorf("cannot remove backup %s: %s", entry.backup, err)
+			}
+		}
+	}
+	t.journal = nil
+	return failed
+}
+
+// rollback undoes all journaled filesystem changes and restores the installed package database
+func (t *transaction) rollback() error {
+	var failed error
+	fail := func(err error) {
+		if err != nil && !os.IsNotExist(err) && failed == nil {
+			failed = err
+		}
+	}
+
+	for _, staged := range t.staged {
+		fail(os.Remove(staged))
+	}
+	for i := len(t.journal) - 1; i >= 0; i-- {
+		entry := t.journal[i]
+		switch {
+		case entry.dir:
+			os.Remove(entry.path)
+		case entry.backup != "":
+			fail(os.Rename(entry.backup, entry.path))
+		default:
+			fail(os.Remove(entry.path))
+		}
+	}
+	for name, installed := range t.snapshots {
+		if installed == nil {
+			fail(t.engine.db.Delete(name))
+		} else {
+			fail(t.engine.db.Put(installed))
+		}
+	}
+	return failed
+}
@@ -0,0 +1,359 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testExecutor struct {
+	executed []string
+	fail     string
+}
+
+func (e *testExecutor) Execute(manifest *pkg.Manifest, actionType pkg.ActionType, item *pkg.ActionItem) error {
+	value := fmt.Sprintf("%s %s %s", manifest.Name, actionType, item.Values.(*pkg.CommandAction).Command[0])
+	e.executed = append(e.executed, value)
+	if value == e.fail {
+		return fmt.Errorf("failed %s", value)
+	}
+	return nil
+}
+
+type testFile struct {
+	file     *pkg.File
+	contents string
+}
+
+func testPackageReader(t *testing.T, name string, version string, actions pkg.Actions, files ...testFile) *pkg.PackageReader {
+	v, err := common.ParseVersion(version)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return testManifestPackageReader(t, &pkg.Manifest{Name: pkg.PackageName(name), Version: *v, Created: time.Now(), Actions: actions}, files...)
+}
+
+func testManifestPackageReader(t *testing.T, manifest *pkg.Manifest, files ...testFile) *pkg.PackageReader {
+	w := pkg.NewPackageWriter(manifest)
+	for _, f := range files {
+		file := *f.file
+		assert.NoError(t, w.AddFile(&file, strings.NewReader(f.contents)))
+	}
+	var out bytes.Buffer
+	_, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	p, err := pkg.OpenPackage(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return p
+}
+
+func testActions(actionTypes ...pkg.ActionType) pkg.Actions {
+	var actions pkg.Actions
+	for _, actionType := range actionTypes {
+		actions = append(actions, &pkg.Action{
+			Type:   actionType,
+			Before: pkg.ActionItems{&pkg.ActionItem{Values: &pkg.CommandAction{Command: []string{"before"}}}},
+			After:  pkg.ActionItems{&pkg.ActionItem{Values: &pkg.CommandAction{Command: []string{"after"}}}},
+		})
+	}
+	return actions
+}
+
+func readFile(t *testing.T, path string) string {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(contents)
+}
+
+func newTestEngine(t *testing.T) (string, *Database, *testExecutor, *Engine) {
+	dir, err := ioutil.TempDir("", "installer")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	db, err := OpenDatabase(filepath.Join(dir, "db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	root := filepath.Join(dir, "root")
+	executor := &testExecutor{}
+	return dir, db, executor, NewEngine(root, db, executor)
+}
+
+func TestEngine(t *testing.T) {
+	dir, db, executor, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	v1 := testPackageReader(t, "app", "1.0.0", testActions(pkg.Install, pkg.Upgrade, pkg.Remove, pkg.Purge, pkg.Reconfigure),
+		testFile{&pkg.File{Path: "/etc/app.conf", Type: pkg.ConfigurationFile}, "config v1"},
+		testFile{&pkg.File{Path: "/usr/bin/app", Type: pkg.ExecutableFile, Mode: 0755}, "app v1"},
+		testFile{&pkg.File{Path: "/usr/share/app/old", Type: pkg.DataFile}, "old data"})
+	v2 := testPackageReader(t, "app", "2.0.0", testActions(pkg.Install, pkg.Upgrade, pkg.Remove, pkg.Purge),
+		testFile{&pkg.File{Path: "/etc/app.conf", Type: pkg.ConfigurationFile}, "config v2"},
+		testFile{&pkg.File{Path: "/usr/bin/app", Type: pkg.ExecutableFile, Mode: 0755}, "app v2"})
+
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "app"}))
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install}))
+
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: v1})) {
+		return
+	}
+	assert.Equal(t, []string{"app install before", "app install after"}, executor.executed)
+	assert.Equal(t, "app v1", readFile(t, filepath.Join(root, "usr/bin/app")))
+	info, err := os.Stat(filepath.Join(root, "usr/bin/app"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+	}
+	installed, found := db.Get("app")
+	if assert.True(t, found) {
+		assert.Equal(t, Configured, installed.State)
+		assert.Len(t, installed.Files, 3)
+	}
+
+	executor.executed = nil
+	executor.fail = "app upgrade after"
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Upgrade, Package: v2}))
+	assert.Equal(t, "app v1", readFile(t, filepath.Join(root, "usr/bin/app")))
+	assert.Equal(t, "old data", readFile(t, filepath.Join(root, "usr/share/app/old")))
+	installed, _ = db.Get("app")
+	assert.Equal(t, "v1.0.0", installed.Manifest.Version.String())
+	assert.Equal(t, Configured, installed.State)
+	matches, _ := filepath.Glob(filepath.Join(root, "*/*/*.lime-*"))
+	assert.Empty(t, matches)
+
+	executor.executed = nil
+	executor.fail = ""
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Reconfigure, Name: "app"}))
+	assert.Equal(t, []string{"app reconfigure before", "app reconfigure after"}, executor.executed)
+
+	executor.executed = nil
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Upgrade, Package: v2})) {
+		return
+	}
+	assert.Equal(t, []string{"app remove before", "app upgrade before", "app remove after", "app upgrade after"}, executor.executed)
+	assert.Equal(t, "app v2", readFile(t, filepath.Join(root, "usr/bin/app")))
+	_, err = os.Stat(filepath.Join(root, "usr/share/app/old"))
+	assert.True(t, os.IsNotExist(err))
+	matches, _ = filepath.Glob(filepath.Join(root, "*/*/*.lime-*"))
+	assert.Empty(t, matches)
+
+	executor.executed = nil
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "app"}))
+	assert.Equal(t, []string{"app remove before", "app remove after"}, executor.executed)
+	assert.Equal(t, "", readFile(t, filepath.Join(root, "usr/bin/app")))
+	assert.Equal(t, "config v2", readFile(t, filepath.Join(root, "etc/app.conf")))
+	installed, _ = db.Get("app")
+	assert.Equal(t, ConfigFiles, installed.State)
+	assert.Len(t, installed.Files, 1)
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Purge, Name: "app"}))
+	assert.Equal(t, "", readFile(t, filepath.Join(root, "etc/app.conf")))
+	_, found = db.Get("app")
+	assert.False(t, found)
+}
+
+func TestEngineRollbackNewInstall(t *testing.T) {
+	dir, db, executor, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	lib := testPackageReader(t, "lib", "1.0.0", nil, testFile{&pkg.File{Path: "/usr/lib/lib.so"}, "lib"})
+	app := testPackageReader(t, "app", "1.0.0", testActions(pkg.Install), testFile{&pkg.File{Path: "/opt/app/bin/app"}, "app"})
+
+	executor.fail = "app install before"
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install, Package: lib}, &Operation{Type: pkg.Install, Package: app}))
+	assert.Empty(t, db.List())
+	_, err := os.Stat(filepath.Join(root, "usr"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "opt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEngineRollbackCorruptPackage(t *testing.T) {
+	dir, db, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	contents := strings.Repeat("lib contents ", 100)
+	w := pkg.NewPackageWriter(&pkg.Manifest{Name: "lib", Version: common.Version{Major: 1}, Created: time.Now()})
+	assert.NoError(t, w.AddFile(&pkg.File{Path: "/usr/lib/lib.so"}, strings.NewReader(contents)))
+	var out bytes.Buffer
+	_, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw := out.Bytes()
+	raw[len(raw)-len(contents)/2] ^= 0xff
+	lib, err := pkg.OpenPackage(bytes.NewReader(raw), int64(len(raw)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.IsType(t, &pkg.InvalidPackageError{}, engine.Apply(&Operation{Type: pkg.Install, Package: lib}))
+	assert.Empty(t, db.List())
+	_, err = os.Stat(filepath.Join(root, "usr"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEngineFileModeAndOwner(t *testing.T) {
+	dir, _, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	app := testPackageReader(t, "app", "1.0.0", nil,
+		testFile{&pkg.File{Path: "/usr/bin/app", Mode: 04755, User: uid, Group: gid}, "app"},
+		testFile{&pkg.File{Path: "/var/tmp/shared", Mode: 01777}, "shared"})
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: app})) {
+		return
+	}
+	info, err := os.Stat(filepath.Join(root, "usr/bin/app"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0755)|os.ModeSetuid, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	}
+	info, err = os.Stat(filepath.Join(root, "var/tmp/shared"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0777)|os.ModeSticky, info.Mode()&(os.ModePerm|os.ModeSticky))
+	}
+
+	unknown := testPackageReader(t, "unknown", "1.0.0", nil,
+		testFile{&pkg.File{Path: "/usr/bin/unknown", User: "no-such-lime-user"}, "unknown"})
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install, Package: unknown}))
+	_, err = os.Stat(filepath.Join(root, "usr/bin/unknown.lime-stage"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEngineExistingStagedFile(t *testing.T) {
+	dir, db, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	staged := filepath.Join(root, "usr/bin/app.lime-stage")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(staged), 0755))
+	assert.NoError(t, ioutil.WriteFile(staged, []byte("not ours"), 0644))
+
+	app := testPackageReader(t, "app", "1.0.0", nil, testFile{&pkg.File{Path: "/usr/bin/app"}, "app"})
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install, Package: app}))
+	assert.Equal(t, "not ours", readFile(t, staged))
+	assert.Empty(t, db.List())
+}
+
+func TestEngineFileConflicts(t *testing.T) {
+	dir, db, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	tool := testPackageReader(t, "tool", "1.0.0", nil, testFile{&pkg.File{Path: "/usr/bin/tool"}, "tool"})
+	other := testPackageReader(t, "other", "1.0.0", nil, testFile{&pkg.File{Path: "/usr/bin/tool"}, "other"})
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: tool})) {
+		return
+	}
+
+	err := engine.Apply(&Operation{Type: pkg.Install, Package: other})
+	assert.IsType(t, &pkg.FileConflictError{}, err)
+	assert.Equal(t, "tool", readFile(t, filepath.Join(root, "usr/bin/tool")))
+	_, found := db.Get("other")
+	assert.False(t, found)
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "tool"}, &Operation{Type: pkg.Install, Package: other}))
+	assert.Equal(t, "other", readFile(t, filepath.Join(root, "usr/bin/tool")))
+}
+
+func TestEngineConflicts(t *testing.T) {
+	dir, db, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	conflicting := func(name string, other string, path string) *pkg.PackageReader {
+		return testManifestPackageReader(t, &pkg.Manifest{
+			Name:         pkg.PackageName(name),
+			Version:      common.Version{Major: 1},
+			Created:      time.Now(),
+			Dependencies: pkg.Dependencies{{Name: pkg.PackageName(other), Relationship: pkg.Conflicts}},
+		}, testFile{&pkg.File{Path: path}, name})
+	}
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: conflicting("postfix", "exim", "/usr/sbin/sendmail")})) {
+		return
+	}
+
+	exim := conflicting("exim", "postfix", "/usr/sbin/sendmail")
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install, Package: exim}))
+	_, found := db.Get("exim")
+	assert.False(t, found)
+	assert.Equal(t, "postfix", readFile(t, filepath.Join(root, "usr/sbin/sendmail")))
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Install, Package: testPackageReader(t, "sendmail", "1.0.0", nil)},
+		&Operation{Type: pkg.Install, Package: conflicting("other", "sendmail", "/usr/bin/other")}))
+	_, err := os.Stat(filepath.Join(root, "usr/bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "postfix"}, &Operation{Type: pkg.Install, Package: exim}))
+	assert.Equal(t, "exim", readFile(t, filepath.Join(root, "usr/sbin/sendmail")))
+	_, found = db.Get("postfix")
+	assert.False(t, found)
+}
+
+func TestEngineReplaces(t *testing.T) {
+	dir, db, _, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	tool := testPackageReader(t, "tool", "1.0.0", nil,
+		testFile{&pkg.File{Path: "/usr/bin/tool"}, "tool"}, testFile{&pkg.File{Path: "/usr/share/tool/doc"}, "doc"})
+	newTool := testManifestPackageReader(t, &pkg.Manifest{
+		Name:         "newtool",
+		Version:      common.Version{Major: 1},
+		Created:      time.Now(),
+		Dependencies: pkg.Dependencies{{Name: "tool", Relationship: pkg.Replaces}},
+	}, testFile{&pkg.File{Path: "/usr/bin/tool"}, "new tool"})
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: tool})) ||
+		!assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: newTool})) {
+		return
+	}
+
+	installed, found := db.Get("tool")
+	if assert.True(t, found) {
+		assert.Nil(t, installed.Files.Find("/usr/bin/tool"))
+		assert.NotNil(t, installed.Files.Find("/usr/share/tool/doc"))
+	}
+	if owners := db.Owners("/usr/bin/tool"); assert.Len(t, owners, 1) {
+		assert.Equal(t, pkg.PackageName("newtool"), owners[0].Name())
+	}
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "tool"}))
+	assert.Equal(t, "new tool", readFile(t, filepath.Join(root, "usr/bin/tool")))
+	assert.Empty(t, readFile(t, filepath.Join(root, "usr/share/tool/doc")))
+
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "newtool"}))
+	assert.Empty(t, readFile(t, filepath.Join(root, "usr/bin/tool")))
+}
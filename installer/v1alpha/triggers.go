@@ -0,0 +1,98 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+// PendingTrigger is a trigger of an installed package that has been activated
+type PendingTrigger struct {
+	Package *InstalledPackage // Package is the installed package declaring the trigger
+	Trigger *pkg.Trigger      // Trigger is the activated trigger
+	Causes  []string          // Causes are the events and file paths that activated the trigger
+}
+
+// TriggerCollector collects the file paths and named events activated by the operations of a transaction. Each
+// activation is recorded once and each trigger fires at most once, however often it is activated.
+type TriggerCollector struct {
+	events []string
+	paths  []string
+	seen   map[string]bool
+}
+
+// NewTriggerCollector creates an empty TriggerCollector
+func NewTriggerCollector() *TriggerCollector {
+	return &TriggerCollector{seen: map[string]bool{}}
+}
+
+// ActivateEvent records the activation of a named event
+func (c *TriggerCollector) ActivateEvent(event string) {
+	if key := "event:" + event; !c.seen[key] {
+		c.seen[key] = true
+		c.events = append(c.events, event)
+	}
+}
+
+// ActivatePath records a change to the file at path
+func (c *TriggerCollector) ActivatePath(path string) {
+	if key := "path:" + path; !c.seen[key] {
+		c.seen[key] = true
+		c.paths = append(c.paths, path)
+	}
+}
+
+// ActivatePackage records the named events activated by manifest and changes to each of files
+func (c *TriggerCollector) ActivatePackage(manifest *pkg.Manifest, files pkg.Files) {
+	for _, event := range manifest.Activates {
+		c.ActivateEvent(event)
+	}
+	for _, file := range files {
+		c.ActivatePath(file.Path)
+	}
+}
+
+// Pending returns the triggers of the installed packages that have been activated. Only triggers of configured
+// packages are returned, in the order of the packages and their triggers.
+func (c *TriggerCollector) Pending(installed []*InstalledPackage) []*PendingTrigger {
+	var pending []*PendingTrigger
+	for _, p := range installed {
+		if p.State != Configured {
+			continue
+		}
+		for _, trigger := range p.Manifest.Triggers {
+			var causes []string
+			for _, event := range c.events {
+				if trigger.MatchesEvent(event) {
+					causes = append(causes, event)
+				}
+			}
+			for _, path := range c.paths {
+				if trigger.MatchesPath(path) {
+					causes = append(causes, path)
+				}
+			}
+			if len(causes) > 0 {
+				pending = append(pending, &PendingTrigger{Package: p, Trigger: trigger, Causes: causes})
+			}
+		}
+	}
+	return pending
+}
+
+// Reset discards all recorded activations
+func (c *TriggerCollector) Reset() {
+	c.events, c.paths, c.seen = nil, nil, map[string]bool{}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTriggerItem(command string) *pkg.ActionItem {
+	return &pkg.ActionItem{Values: &pkg.CommandAction{Command: []string{command}}}
+}
+
+func TestTriggerCollector(t *testing.T) {
+	ldconfig := &pkg.Trigger{Events: []string{"ldconfig"}, Paths: []string{"/usr/lib"}}
+	reload := &pkg.Trigger{Events: []string{"systemd-reload"}}
+	installed := []*InstalledPackage{
+		{Manifest: &pkg.Manifest{Name: "libc", Triggers: pkg.Triggers{ldconfig}}, State: Configured},
+		{Manifest: &pkg.Manifest{Name: "systemd", Triggers: pkg.Triggers{reload}}, State: Configured},
+		{Manifest: &pkg.Manifest{Name: "broken", Triggers: pkg.Triggers{ldconfig}}, State: Unpacked},
+	}
+
+	c := NewTriggerCollector()
+	assert.Empty(t, c.Pending(installed))
+
+	c.ActivatePackage(&pkg.Manifest{Activates: []string{"ldconfig"}}, pkg.Files{{Path: "/usr/lib/a.so"}, {Path: "/usr/libexec/b"}})
+	c.ActivatePath("/usr/lib/a.so")
+	c.ActivateEvent("ldconfig")
+
+	pending := c.Pending(installed)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, pkg.PackageName("libc"), pending[0].Package.Name())
+		assert.Equal(t, ldconfig, pending[0].Trigger)
+		assert.Equal(t, []string{"ldconfig", "/usr/lib/a.so"}, pending[0].Causes)
+	}
+
+	c.Reset()
+	assert.Empty(t, c.Pending(installed))
+}
+
+func TestEngineTriggers(t *testing.T) {
+	dir, _, executor, engine := newTestEngine(t)
+	defer os.RemoveAll(dir)
+
+	libc := testManifestPackageReader(t, &pkg.Manifest{
+		Name:     "libc",
+		Version:  common.Version{Major: 1},
+		Created:  time.Now(),
+		Triggers: pkg.Triggers{{Events: []string{"ldconfig"}, Paths: []string{"/usr/lib"}, Items: pkg.ActionItems{testTriggerItem("ldconfig")}}},
+	}, testFile{&pkg.File{Path: "/usr/lib/libc.so"}, "libc"})
+	libA := testManifestPackageReader(t, &pkg.Manifest{Name: "liba", Version: common.Version{Major: 1}, Created: time.Now()},
+		testFile{&pkg.File{Path: "/usr/lib/liba.so"}, "liba"})
+	libB := testManifestPackageReader(t, &pkg.Manifest{Name: "libb", Version: common.Version{Major: 1}, Created: time.Now(), Activates: []string{"ldconfig"}},
+		testFile{&pkg.File{Path: "/opt/libb/libb.so"}, "libb"})
+
+	if !assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: libc})) {
+		return
+	}
+	assert.Equal(t, []string{"libc trigger ldconfig"}, executor.executed)
+
+	executor.executed = nil
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Install, Package: libA}, &Operation{Type: pkg.Install, Package: libB}))
+	assert.Equal(t, []string{"libc trigger ldconfig"}, executor.executed)
+
+	executor.executed = nil
+	assert.NoError(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "libb"}))
+	assert.Equal(t, []string{"libc trigger ldconfig"}, executor.executed)
+
+	executor.executed = nil
+	executor.fail = "libc trigger ldconfig"
+	assert.Error(t, engine.Apply(&Operation{Type: pkg.Remove, Name: "liba"}))
+	_, found := engine.db.Get("liba")
+	assert.True(t, found)
+}
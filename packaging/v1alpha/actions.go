@@ -0,0 +1,411 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// CommandActionKind is the kind of a CommandAction
+	CommandActionKind = "command"
+	// CreateUserActionKind is the kind of a CreateUserAction
+	CreateUserActionKind = "user"
+	// CreateGroupActionKind is the kind of a CreateGroupAction
+	CreateGroupActionKind = "group"
+	// CreateDirectoryActionKind is the kind of a CreateDirectoryAction
+	CreateDirectoryActionKind = "directory"
+	// TemplateActionKind is the kind of a TemplateAction
+	TemplateActionKind = "template"
+	// SystemdUnitActionKind is the kind of a SystemdUnitAction
+	SystemdUnitActionKind = "systemd"
+	// SysctlActionKind is the kind of a SysctlAction
+	SysctlActionKind = "sysctl"
+)
+
+// ActionValues are the typed values of an action item
+type ActionValues interface {
+	Kind() string
+	Validate() error
+}
+
+var (
+	actionKindsMutex sync.RWMutex
+	actionKinds      = map[string]func() ActionValues{
+		CommandActionKind:         func() ActionValues { return &CommandAction{} },
+		CreateUserActionKind:      func() ActionValues { return &CreateUserAction{} },
+		CreateGroupActionKind:     func() ActionValues { return &CreateGroupAction{} },
+		CreateDirectoryActionKind: func() ActionValues { return &CreateDirectoryAction{} },
+		TemplateActionKind:        func() ActionValues { return &TemplateAction{} },
+		SystemdUnitActionKind:     func() ActionValues { return &SystemdUnitAction{} },
+		SysctlActionKind:          func() ActionValues { return &SysctlAction{} },
+	}
+)
+
+// RegisterActionKind registers a factory creating the action values of a kind of action, replacing any existing
+// factory. The values are decoded from the fields of the action item other than its kind.
+func RegisterActionKind(kind string, factory func() ActionValues) {
+	actionKindsMutex.Lock()
+	defer actionKindsMutex.Unlock()
+	actionKinds[kind] = factory
+}
+
+// ActionKinds returns the registered kinds of action
+func ActionKinds() []string {
+	actionKindsMutex.RLock()
+	defer actionKindsMutex.RUnlock()
+	kinds := make([]string, 0, len(actionKinds))
+	for kind := range actionKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// NewActionValues creates empty action values of a registered kind
+func NewActionValues(kind string) (ActionValues, error) {
+	actionKindsMutex.RLock()
+	defer actionKindsMutex.RUnlock()
+	factory, found := actionKinds[kind]
+	if !found {
+		return nil, fmt.Errorf("unknown action kind %s", kind)
+	}
+	return factory(), nil
+}
+
+// Validate checks that the action item is valid
+func (i *ActionItem) Validate() error {
+	if i.Values == nil {
+		return fmt.Errorf("action item has no values")
+	}
+	return i.Values.Validate()
+}
+
+// UnmarshalYAML implements custom unmarshal for ActionItem
+func (i *ActionItem) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var raw struct {
+		Action yaml.Node `yaml:"action"`
+	}
+	if err = unmarshal(&raw); err != nil {
+		return
+	}
+	var header struct {
+		Kind string `yaml:"kind"`
+	}
+	if err = raw.Action.Decode(&header); err != nil {
+		return
+	}
+
+	values, err := NewActionValues(header.Kind)
+	if err != nil {
+		return
+	}
+
+	fields := raw.Action
+	fields.Content = nil
+	for n := 0; n+1 < len(raw.Action.Content); n += 2 {
+		if raw.Action.Content[n].Value != "kind" {
+			fields.Content = append(fields.Content, raw.Action.Content[n], raw.Action.Content[n+1])
+		}
+	}
+	if err = fields.Decode(values); err != nil {
+		return
+	}
+	if err = values.Validate(); err != nil {
+		return
+	}
+	i.Values = values
+	return
+}
+
+// MarshalYAML implements custom marshalling for ActionItem
+func (i ActionItem) MarshalYAML() (interface{}, error) {
+	if i.Values == nil {
+		return nil, fmt.Errorf("action item has no values")
+	}
+	encoded, err := yaml.Marshal(i.Values)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err = yaml.Unmarshal(encoded, &document); err != nil {
+		return nil, err
+	}
+	fields := document.Content[0]
+	if fields.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("action %s must encode as a mapping", i.Values.Kind())
+	}
+	kind := []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "kind"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: i.Values.Kind()},
+	}
+	fields.Content = append(kind, fields.Content...)
+	return map[string]*yaml.Node{"action": fields}, nil
+}
+
+// UnmarshalJSON implements custom unmarshal for ActionItem
+func (i *ActionItem) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Action json.RawMessage `json:"action"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	var header struct {
+		Kind string `json:"kind"`
+	}
+	if len(raw.Action) > 0 {
+		if err := json.Unmarshal(raw.Action, &header); err != nil {
+			return err
+		}
+	}
+
+	values, err := NewActionValues(header.Kind)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(raw.Action, values); err != nil {
+		return err
+	}
+	if err = values.Validate(); err != nil {
+		return err
+	}
+	i.Values = values
+	return nil
+}
+
+// MarshalJSON implements custom marshalling for ActionItem
+func (i ActionItem) MarshalJSON() ([]byte, error) {
+	if i.Values == nil {
+		return nil, fmt.Errorf("action item has no values")
+	}
+	fields, err := json.Marshal(i.Values)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 || fields[0] != '{' {
+		return nil, fmt.Errorf("action %s must encode as an object", i.Values.Kind())
+	}
+	kind, err := json.Marshal(i.Values.Kind())
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"action":{"kind":`)
+	b.Write(kind)
+	if len(fields) > 2 {
+		b.WriteByte(',')
+	}
+	b.Write(fields[1:])
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Validate checks that the action and its items are valid
+func (a *Action) Validate() error {
+	if a.Type == ActionType(0) {
+		return fmt.Errorf("action has no type")
+	}
+	for _, items := range []ActionItems{a.Before, a.After} {
+		for _, item := range items {
+			if err := item.Validate(); err != nil {
+				return fmt.Errorf("invalid %s action: %s", a.Type, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validAbsolutePath(p string) error {
+	if !path.IsAbs(p) || path.Clean(p) != p {
+		return fmt.Errorf("path %s must be absolute and clean", p)
+	}
+	return nil
+}
+
+var (
+	accountNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*\$?$`)
+	sysctlKeyPattern   = regexp.MustCompile(`^[a-zA-Z0-9_-]+([./][a-zA-Z0-9_-]+)*$`)
+	systemdUnitSuffix  = []string{".service", ".socket", ".timer", ".target", ".mount", ".path", ".slice"}
+)
+
+// CommandAction runs a command
+type CommandAction struct {
+	Command []string          `yaml:"command" json:"command"`               // Command is the command and its arguments
+	Dir     string            `yaml:"dir,omitempty" json:"dir,omitempty"`   // Dir is the working directory of the command
+	Env     map[string]string `yaml:"env,omitempty" json:"env,omitempty"`   // Env are additional environment variables
+	User    string            `yaml:"user,omitempty" json:"user,omitempty"` // User is the user that runs the command
+}
+
+// Kind implements ActionValues
+func (a *CommandAction) Kind() string {
+	return CommandActionKind
+}
+
+// Validate implements ActionValues
+func (a *CommandAction) Validate() error {
+	if len(a.Command) == 0 || a.Command[0] == "" {
+		return fmt.Errorf("command action requires a command")
+	}
+	if a.Dir != "" {
+		return validAbsolutePath(a.Dir)
+	}
+	return nil
+}
+
+// CreateUserAction creates a user account
+type CreateUserAction struct {
+	Name   string `yaml:"name" json:"name"`                         // Name is the name of the user
+	Group  string `yaml:"group,omitempty" json:"group,omitempty"`   // Group is the primary group of the user
+	Home   string `yaml:"home,omitempty" json:"home,omitempty"`     // Home is the home directory of the user
+	Shell  string `yaml:"shell,omitempty" json:"shell,omitempty"`   // Shell is the login shell of the user
+	System bool   `yaml:"system,omitempty" json:"system,omitempty"` // System indicates that the user is a system account
+}
+
+// Kind implements ActionValues
+func (a *CreateUserAction) Kind() string {
+	return CreateUserActionKind
+}
+
+// Validate implements ActionValues
+func (a *CreateUserAction) Validate() error {
+	if !accountNamePattern.MatchString(a.Name) {
+		return fmt.Errorf("invalid user name %s", a.Name)
+	}
+	if a.Group != "" && !accountNamePattern.MatchString(a.Group) {
+		return fmt.Errorf("invalid group name %s", a.Group)
+	}
+	if a.Home != "" {
+		return validAbsolutePath(a.Home)
+	}
+	return nil
+}
+
+// CreateGroupAction creates a group
+type CreateGroupAction struct {
+	Name   string `yaml:"name" json:"name"`                         // Name is the name of the group
+	System bool   `yaml:"system,omitempty" json:"system,omitempty"` // System indicates that the group is a system group
+}
+
+// Kind implements ActionValues
+func (a *CreateGroupAction) Kind() string {
+	return CreateGroupActionKind
+}
+
+// Validate implements ActionValues
+func (a *CreateGroupAction) Validate() error {
+	if !accountNamePattern.MatchString(a.Name) {
+		return fmt.Errorf("invalid group name %s", a.Name)
+	}
+	return nil
+}
+
+// CreateDirectoryAction creates a directory
+type CreateDirectoryAction struct {
+	Path  string `yaml:"path" json:"path"`                       // Path is the full path of the directory
+	User  string `yaml:"user,omitempty" json:"user,omitempty"`   // User is the user who owns the directory
+	Group string `yaml:"group,omitempty" json:"group,omitempty"` // Group is the group that owns the directory
+	Mode  int    `yaml:"mode,omitempty" json:"mode,omitempty"`   // Mode is the mode of the directory
+}
+
+// Kind implements ActionValues
+func (a *CreateDirectoryAction) Kind() string {
+	return CreateDirectoryActionKind
+}
+
+// Validate implements ActionValues
+func (a *CreateDirectoryAction) Validate() error {
+	if a.Mode < 0 || a.Mode > 07777 {
+		return fmt.Errorf("invalid directory mode %o", a.Mode)
+	}
+	return validAbsolutePath(a.Path)
+}
+
+// TemplateAction renders a text/template to a file
+type TemplateAction struct {
+	Template    string            `yaml:"template" json:"template"`                 // Template is the text/template to render
+	Destination string            `yaml:"destination" json:"destination"`           // Destination is the full path of the rendered file
+	Values      map[string]string `yaml:"values,omitempty" json:"values,omitempty"` // Values are the values available to the template
+	Mode        int               `yaml:"mode,omitempty" json:"mode,omitempty"`     // Mode is the mode of the rendered file
+}
+
+// Kind implements ActionValues
+func (a *TemplateAction) Kind() string {
+	return TemplateActionKind
+}
+
+// Validate implements ActionValues
+func (a *TemplateAction) Validate() error {
+	if _, err := template.New(a.Destination).Parse(a.Template); err != nil {
+		return err
+	}
+	if a.Mode < 0 || a.Mode > 07777 {
+		return fmt.Errorf("invalid file mode %o", a.Mode)
+	}
+	return validAbsolutePath(a.Destination)
+}
+
+// SystemdUnitAction enables and optionally starts a systemd unit
+type SystemdUnitAction struct {
+	Unit    string `yaml:"unit" json:"unit"`                           // Unit is the name of the unit
+	Disable bool   `yaml:"disable,omitempty" json:"disable,omitempty"` // Disable indicates that the unit is disabled instead of enabled
+	Now     bool   `yaml:"now,omitempty" json:"now,omitempty"`         // Now indicates that the unit is also started or stopped
+}
+
+// Kind implements ActionValues
+func (a *SystemdUnitAction) Kind() string {
+	return SystemdUnitActionKind
+}
+
+// Validate implements ActionValues
+func (a *SystemdUnitAction) Validate() error {
+	for _, suffix := range systemdUnitSuffix {
+		if strings.HasSuffix(a.Unit, suffix) && len(a.Unit) > len(suffix) && !strings.Contains(a.Unit, "/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid systemd unit %s", a.Unit)
+}
+
+// SysctlAction sets a kernel parameter
+type SysctlAction struct {
+	Key     string `yaml:"key" json:"key"`                             // Key is the name of the kernel parameter
+	Value   string `yaml:"value" json:"value"`                         // Value is the value of the kernel parameter
+	Persist bool   `yaml:"persist,omitempty" json:"persist,omitempty"` // Persist indicates that the parameter is persisted across reboots
+}
+
+// Kind implements ActionValues
+func (a *SysctlAction) Kind() string {
+	return SysctlActionKind
+}
+
+// Validate implements ActionValues
+func (a *SysctlAction) Validate() error {
+	if !sysctlKeyPattern.MatchString(a.Key) {
+		return fmt.Errorf("invalid sysctl key %s", a.Key)
+	}
+	return nil
+}
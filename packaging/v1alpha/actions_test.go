@@ -0,0 +1,97 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testActionValues struct {
+	Message string `yaml:"message"`
+}
+
+func (a *testActionValues) Kind() string {
+	return "test"
+}
+
+func (a *testActionValues) Validate() error {
+	if a.Message == "" {
+		return fmt.Errorf("test action requires a message")
+	}
+	return nil
+}
+
+func TestActionItemYAML(t *testing.T) {
+	actions := Actions{&Action{
+		Type: Install,
+		Before: ActionItems{
+			&ActionItem{Values: &CreateGroupAction{Name: "app", System: true}},
+			&ActionItem{Values: &CreateUserAction{Name: "app", Group: "app", Home: "/var/lib/app", System: true}},
+			&ActionItem{Values: &CreateDirectoryAction{Path: "/var/lib/app", User: "app", Mode: 0750}},
+		},
+		After: ActionItems{
+			&ActionItem{Values: &TemplateAction{Template: "port={{.port}}\n", Destination: "/etc/app/port", Values: map[string]string{"port": "80"}}},
+			&ActionItem{Values: &SysctlAction{Key: "net.ipv4.ip_forward", Value: "1"}},
+			&ActionItem{Values: &SystemdUnitAction{Unit: "app.service", Now: true}},
+			&ActionItem{Values: &CommandAction{Command: []string{"/usr/bin/app", "--init"}, Env: map[string]string{"HOME": "/var/lib/app"}}},
+		},
+	}}
+	assert.NoError(t, actions[0].Validate())
+
+	out, err := yaml.Marshal(actions)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(out), "kind: systemd")
+
+	var decoded Actions
+	if assert.NoError(t, yaml.Unmarshal(out, &decoded)) {
+		assert.Equal(t, actions, decoded)
+	}
+
+	for _, invalid := range []string{
+		"- action: {kind: unknown}",
+		"- action: {kind: command}",
+		"- action: {kind: user, name: Root}",
+		"- action: {kind: directory, path: relative}",
+		"- action: {kind: template, template: '{{', destination: /etc/x}",
+		"- action: {kind: systemd, unit: app}",
+		"- action: {kind: sysctl, key: 'bad key'}",
+	} {
+		var items ActionItems
+		assert.Error(t, yaml.Unmarshal([]byte(invalid), &items), invalid)
+	}
+
+	assert.Error(t, (&Action{Type: Install, After: ActionItems{&ActionItem{}}}).Validate())
+	assert.Error(t, (&Action{}).Validate())
+}
+
+func TestRegisterActionKind(t *testing.T) {
+	RegisterActionKind("test", func() ActionValues { return &testActionValues{} })
+	assert.Contains(t, ActionKinds(), "test")
+
+	var items ActionItems
+	if assert.NoError(t, yaml.Unmarshal([]byte("- action: {kind: test, message: hello}"), &items)) && assert.Len(t, items, 1) {
+		assert.Equal(t, &testActionValues{Message: "hello"}, items[0].Values)
+	}
+	assert.Error(t, yaml.Unmarshal([]byte("- action: {kind: test}"), &items))
+
+	_, err := NewActionValues("missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Codec compresses and decompresses package files. The built-in codecs use fixed compression settings, so that
+// compressing the same contents always yields the same output.
+type Codec interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var builtinCodecs = map[Compression]Codec{
+	NoCompression:   noCodec{},
+	GzipCompression: gzipCodec{},
+	ZstdCompression: zstdCodec{},
+	XZCompression:   xzCodec{},
+}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[Compression]Codec{}
+	codecNames  = map[Compression]string{}
+)
+
+// RegisterCodec registers the codec used for compression under name, replacing any existing codec. The name is
+// written to the file index of packages using the compression, it may not be empty or name another compression.
+// Built-in compressions keep their names.
+func RegisterCodec(compression Compression, name string, codec Codec) error {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	if name == "" {
+		return fmt.Errorf("no name for compression %d", compression)
+	}
+	if n, found := compressionName(compression); found && n != name {
+		return fmt.Errorf("compression %d is already named %s", compression, n)
+	}
+	if c, err := parseCompressionName(name); err == nil && c != compression {
+		return fmt.Errorf("compression name %s is already registered", name)
+	}
+	if _, builtin := builtinCodecs[compression]; !builtin {
+		codecNames[compression] = name
+	}
+	codecs[compression] = codec
+	return nil
+}
+
+// UnregisterCodec removes the codec registered for compression. Built-in compressions revert to their built-in codec.
+func UnregisterCodec(compression Compression) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+	delete(codecs, compression)
+	delete(codecNames, compression)
+}
+
+// LookupCodec returns the codec registered for compression
+func LookupCodec(compression Compression) (Codec, error) {
+	if compression == Compression(0) {
+		compression = NoCompression
+	}
+
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	if codec, found := codecs[compression]; found {
+		return codec, nil
+	}
+	if codec, found := builtinCodecs[compression]; found {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("no codec registered for compression %d", compression)
+}
+
+// compressionName returns the name of a built-in or registered compression, codecsMutex must be held
+func compressionName(compression Compression) (string, bool) {
+	if name, found := codecNames[compression]; found {
+		return name, true
+	}
+	name := compressionValues.AsString(compression)
+	return name, name != ""
+}
+
+// parseCompressionName returns the built-in or registered compression named name, codecsMutex must be held
+func parseCompressionName(name string) (Compression, error) {
+	for c, n := range codecNames {
+		if strings.EqualFold(n, name) {
+			return c, nil
+		}
+	}
+	x, err := compressionValues.Parse(name)
+	if err != nil {
+		return Compression(0), err
+	}
+	return x.(Compression), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// noCodec stores files uncompressed
+type noCodec struct{}
+
+func (noCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (noCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(r), nil
+}
+
+// gzipCodec compresses files with gzip
+type gzipCodec struct{}
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, gzip.BestCompression)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// zstdCodec compresses files with zstd
+type zstdCodec struct{}
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReadCloser{d}, nil
+}
+
+// xzCodec compresses files with xz
+type xzCodec struct{}
+
+func (xzCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return xz.NewWriter(w)
+}
+
+func (xzCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	x, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(x), nil
+}
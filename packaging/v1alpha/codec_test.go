@@ -0,0 +1,146 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageCompression(t *testing.T) {
+	contents := strings.Repeat("compressible contents ", 100)
+	w := NewPackageWriter(testManifest())
+	w.SetDefaultCompression(GzipCompression)
+	w.SetCompression(ConfigurationFile, ZstdCompression)
+	w.SetCompression(ExecutableFile, XZCompression)
+	w.SetCompression(DataFile, NoCompression)
+	assert.NoError(t, w.AddFile(&File{Path: "/config", Type: ConfigurationFile}, strings.NewReader(contents)))
+	assert.NoError(t, w.AddFile(&File{Path: "/exec", Type: ExecutableFile}, strings.NewReader(contents)))
+	assert.NoError(t, w.AddFile(&File{Path: "/data", Type: DataFile}, strings.NewReader(contents)))
+	assert.NoError(t, w.AddFile(&File{Path: "/other"}, strings.NewReader(contents)))
+
+	var out bytes.Buffer
+	_, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw := out.Bytes()
+
+	p, err := OpenPackage(bytes.NewReader(raw), int64(len(raw)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected := map[string]Compression{"/config": ZstdCompression, "/exec": XZCompression, "/data": NoCompression, "/other": GzipCompression}
+	for path, compression := range expected {
+		entry, found := p.Lookup(path)
+		if assert.True(t, found) {
+			assert.Equal(t, compression, entry.Compression)
+			assert.Equal(t, int64(len(contents)), entry.Size)
+			if compression != NoCompression {
+				assert.True(t, entry.CompressedSize < entry.Size)
+			}
+		}
+		r, err := p.Open(path)
+		if assert.NoError(t, err) {
+			actual, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, contents, string(actual))
+			assert.NoError(t, r.Close())
+		}
+	}
+
+	d, err := NewPackageDecoder(bytes.NewReader(raw))
+	if !assert.NoError(t, err) {
+		return
+	}
+	count := 0
+	for {
+		entry, r, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		count++
+		if entry.Path == "/exec" {
+			continue
+		}
+		actual, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, contents, string(actual))
+	}
+	assert.Equal(t, 4, count)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	_, err := LookupCodec(Compression(100))
+	assert.Error(t, err)
+	assert.Error(t, RegisterCodec(Compression(100), "", noCodec{}))
+	assert.Error(t, RegisterCodec(Compression(100), "GZIP", noCodec{}))
+	assert.Error(t, RegisterCodec(GzipCompression, "gz", noCodec{}))
+	_, err = LookupCodec(Compression(100))
+	assert.Error(t, err)
+	assert.NoError(t, RegisterCodec(Compression(100), "custom", gzipCodec{}))
+	t.Cleanup(func() { UnregisterCodec(Compression(100)) })
+	_, err = LookupCodec(Compression(100))
+	assert.NoError(t, err)
+	assert.Equal(t, "custom", Compression(100).String())
+	c, err := ParseCompression("Custom")
+	assert.NoError(t, err)
+	assert.Equal(t, Compression(100), c)
+	assert.Error(t, RegisterCodec(Compression(101), "custom", gzipCodec{}))
+	assert.Error(t, RegisterCodec(Compression(100), "other", gzipCodec{}))
+	_, found := compressionValues["custom"]
+	assert.False(t, found)
+
+	w := NewPackageWriter(testManifest())
+	w.SetDefaultCompression(Compression(100))
+	contents := strings.Repeat("custom", 100)
+	assert.NoError(t, w.AddFile(&File{Path: "/a"}, strings.NewReader(contents)))
+	var out bytes.Buffer
+	if _, err = w.WriteTo(&out); assert.NoError(t, err) {
+		p, err := OpenPackage(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if assert.NoError(t, err) {
+			r, err := p.Open("/a")
+			if assert.NoError(t, err) {
+				actual, err := ioutil.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equal(t, contents, string(actual))
+			}
+		}
+	}
+
+	UnregisterCodec(Compression(100))
+	_, err = LookupCodec(Compression(100))
+	assert.Error(t, err)
+	assert.Equal(t, "", Compression(100).String())
+	_, err = ParseCompression("custom")
+	assert.Error(t, err)
+
+	assert.NoError(t, RegisterCodec(GzipCompression, "gzip", noCodec{}))
+	codec, err := LookupCodec(GzipCompression)
+	assert.NoError(t, err)
+	assert.Equal(t, noCodec{}, codec)
+	UnregisterCodec(GzipCompression)
+	codec, err = LookupCodec(GzipCompression)
+	assert.NoError(t, err)
+	assert.Equal(t, gzipCodec{}, codec)
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+)
+
+// FileConflict is a file listed by two packages that cannot both own it
+type FileConflict struct {
+	Path      string    // Path is the full path of the file
+	Package   *Manifest // Package is the package being checked
+	Owner     *Manifest // Owner is the other package listing the file
+	Installed bool      // Installed indicates that the owner is installed rather than part of the transaction
+}
+
+// String implements the Stringer interface.
+func (c *FileConflict) String() string {
+	where := "in the same transaction"
+	if c.Installed {
+		where = "installed"
+	}
+	return fmt.Sprintf("%s is listed by %s and by %s %s", c.Path, describe(c.Package), describe(c.Owner), where)
+}
+
+// FileConflictError is an error that occurs when packages list the same files
+type FileConflictError struct {
+	limejuiceerrors.LimeJuiceError
+	Conflicts []*FileConflict // Conflicts are all clashing files
+}
+
+func newFileConflictError(conflicts []*FileConflict) *FileConflictError {
+	err := &FileConflictError{Conflicts: conflicts}
+	var b strings.Builder
+	b.WriteString("file conflicts:")
+	for _, c := range conflicts {
+		fmt.Fprintf(&b, "\n  %s", c)
+	}
+	err.Message = b.String()
+	return err
+}
+
+// FileConflictChecker checks that packages do not list files owned by other packages. A package may list a file of
+// another package if it replaces the other package, which hands the file over, or if both list it as a common file
+// with the same SHA256 hash. Packages that conflict cannot be installed together at all, which is checked separately
+// with PackageConflict.
+type FileConflictChecker struct {
+	installed []*Manifest
+}
+
+// NewFileConflictChecker creates a new FileConflictChecker for the installed packages. The files of an installed
+// package are those it currently owns, which may be fewer than its manifest lists.
+func NewFileConflictChecker(installed ...*Manifest) *FileConflictChecker {
+	return &FileConflictChecker{installed: installed}
+}
+
+// Check checks candidate against the installed packages and the other packages installed by the same transaction.
+// Installed packages with the same name as the candidate or a transaction package are being upgraded and are
+// ignored. A *FileConflictError listing every clashing file is returned if there are conflicts.
+func (c *FileConflictChecker) Check(candidate *Manifest, transaction ...*Manifest) error {
+	upgraded := map[PackageName]bool{candidate.Name: true}
+	for _, m := range transaction {
+		upgraded[m.Name] = true
+	}
+
+	var conflicts []*FileConflict
+	for _, m := range c.installed {
+		if !upgraded[m.Name] {
+			conflicts = append(conflicts, fileConflicts(candidate, m, true)...)
+		}
+	}
+	for _, m := range transaction {
+		if m.Name != candidate.Name {
+			conflicts = append(conflicts, fileConflicts(candidate, m, false)...)
+		}
+	}
+	if len(conflicts) > 0 {
+		return newFileConflictError(conflicts)
+	}
+	return nil
+}
+
+// fileConflicts returns the files of candidate that clash with files of owner. Only a candidate that replaces owner
+// may take over its files.
+func fileConflicts(candidate, owner *Manifest, installed bool) []*FileConflict {
+	if ReplacesPackage(candidate, owner) {
+		return nil
+	}
+
+	var conflicts []*FileConflict
+	for _, file := range candidate.Files {
+		other := owner.Files.Find(file.Path)
+		if other == nil || (file.IsCommon && other.IsCommon && file.SHA256 == other.SHA256) {
+			continue
+		}
+		conflicts = append(conflicts, &FileConflict{Path: file.Path, Package: candidate, Owner: owner, Installed: installed})
+	}
+	return conflicts
+}
+
+// PackageConflict returns a description of the Conflicts relationship between two packages that cannot be installed
+// together, or an empty string if neither package conflicts with the other
+func PackageConflict(a, b *Manifest) string {
+	for _, pair := range [][2]*Manifest{{a, b}, {b, a}} {
+		for _, dep := range pair[0].Dependencies {
+			if dep.Relationship == Conflicts && providesDependency(pair[1], dep) {
+				return fmt.Sprintf("%s %s %s", describe(pair[0]), dep.Relationship, describe(pair[1]))
+			}
+		}
+	}
+	return ""
+}
+
+// ReplacesPackage checks if m replaces the files of other through a Replaces relationship
+func ReplacesPackage(m, other *Manifest) bool {
+	for _, dep := range m.Dependencies {
+		if dep.Relationship == Replaces && providesDependency(other, dep) {
+			return true
+		}
+	}
+	return false
+}
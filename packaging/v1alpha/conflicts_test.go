@@ -0,0 +1,90 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withFiles(m *Manifest, files ...*File) *Manifest {
+	m.Files = files
+	return m
+}
+
+func TestFileConflictChecker(t *testing.T) {
+	installed := []*Manifest{
+		withFiles(testPackageManifest("base", "1.0.0"),
+			&File{Path: "/usr/bin/tool"}, &File{Path: "/usr/share/doc/base"}, &File{Path: "/usr/share/common", IsCommon: true, SHA256: "a"}),
+		withFiles(testPackageManifest("legacy", "1.0.0"), &File{Path: "/usr/bin/legacy"}),
+		withFiles(testPackageManifest("app", "1.0.0"), &File{Path: "/usr/bin/app"}),
+	}
+	checker := NewFileConflictChecker(installed...)
+
+	clash := withFiles(testPackageManifest("clash", "1.0.0"),
+		&File{Path: "/usr/bin/tool"}, &File{Path: "/usr/share/doc/base"}, &File{Path: "/usr/bin/other"})
+	err := checker.Check(clash)
+	if assert.IsType(t, &FileConflictError{}, err) {
+		conflicts := err.(*FileConflictError).Conflicts
+		if assert.Len(t, conflicts, 2) {
+			assert.Equal(t, "/usr/bin/tool", conflicts[0].Path)
+			assert.Equal(t, "/usr/share/doc/base", conflicts[1].Path)
+			assert.True(t, conflicts[0].Installed)
+			assert.Equal(t, PackageName("base"), conflicts[0].Owner.Name)
+		}
+		assert.Contains(t, err.Error(), "/usr/bin/tool is listed by clash v1.0.0 and by base v1.0.0 installed")
+	}
+
+	assert.NoError(t, checker.Check(withFiles(testPackageManifest("app", "2.0.0"), &File{Path: "/usr/bin/app"})))
+	assert.NoError(t, checker.Check(withFiles(testPackageManifest("newlegacy", "1.0.0", testDependency("legacy", Replaces, Required(0), "")),
+		&File{Path: "/usr/bin/legacy"})))
+	assert.Error(t, checker.Check(withFiles(testPackageManifest("altbase", "1.0.0", testDependency("base", Conflicts, Required(0), "")),
+		&File{Path: "/usr/bin/tool"})))
+	replacing := withFiles(testPackageManifest("replacing", "1.0.0", testDependency("old", Replaces, Required(0), "")),
+		&File{Path: "/usr/bin/old"})
+	err = NewFileConflictChecker(replacing).Check(withFiles(testPackageManifest("old", "1.0.0"), &File{Path: "/usr/bin/old"}))
+	if assert.IsType(t, &FileConflictError{}, err) {
+		assert.Equal(t, "/usr/bin/old", err.(*FileConflictError).Conflicts[0].Path)
+	}
+	assert.NoError(t, checker.Check(withFiles(testPackageManifest("shared", "1.0.0"), &File{Path: "/usr/share/common", IsCommon: true, SHA256: "a"})))
+	assert.Error(t, checker.Check(withFiles(testPackageManifest("shared", "1.0.0"), &File{Path: "/usr/share/common", IsCommon: true, SHA256: "b"})))
+	assert.Error(t, checker.Check(withFiles(testPackageManifest("shared", "1.0.0"), &File{Path: "/usr/share/common", SHA256: "a"})))
+
+	first := withFiles(testPackageManifest("first", "1.0.0"), &File{Path: "/opt/file"})
+	second := withFiles(testPackageManifest("second", "1.0.0"), &File{Path: "/opt/file"})
+	err = checker.Check(first, second)
+	if assert.IsType(t, &FileConflictError{}, err) {
+		assert.False(t, err.(*FileConflictError).Conflicts[0].Installed)
+	}
+
+	upgrade := withFiles(testPackageManifest("base", "2.0.0"), &File{Path: "/opt/file"})
+	assert.NoError(t, checker.Check(withFiles(testPackageManifest("moved", "1.0.0"), &File{Path: "/usr/bin/tool"}), upgrade))
+}
+
+func TestPackageConflict(t *testing.T) {
+	base := testPackageManifest("base", "1.0.0")
+	alt := testPackageManifest("alt", "1.0.0", testDependency("base", Conflicts, RequiresLessThan, "2.0.0"))
+	replacing := testPackageManifest("replacing", "1.0.0", testDependency("base", Replaces, Required(0), ""))
+
+	assert.Equal(t, "alt v1.0.0 conflicts base v1.0.0", PackageConflict(alt, base))
+	assert.Equal(t, "alt v1.0.0 conflicts base v1.0.0", PackageConflict(base, alt))
+	assert.Empty(t, PackageConflict(alt, testPackageManifest("base", "2.0.0")))
+	assert.Empty(t, PackageConflict(replacing, base))
+
+	assert.True(t, ReplacesPackage(replacing, base))
+	assert.False(t, ReplacesPackage(base, replacing))
+	assert.False(t, ReplacesPackage(alt, base))
+}
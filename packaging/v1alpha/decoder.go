@@ -0,0 +1,185 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// verifyingReader verifies the size and SHA256 hash of a file as it is read
+type verifyingReader struct {
+	path   string
+	r      io.Reader
+	hash   hash.Hash
+	size   int64
+	read   int64
+	sha256 string
+	err    error
+}
+
+func newVerifyingReader(r io.Reader, path string, size int64, sha256Hash string) *verifyingReader {
+	return &verifyingReader{path: path, r: r, hash: sha256.New(), size: size, sha256: sha256Hash}
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	n, err := v.r.Read(p)
+	v.read += int64(n)
+	v.hash.Write(p[:n])
+	if v.read > v.size {
+		err = newInvalidPackageError("file %s exceeds expected size of %d", v.path, v.size)
+	} else if err == io.EOF {
+		err = v.verify()
+	}
+	if err != nil {
+		v.err = err
+	}
+	return n, err
+}
+
+func (v *verifyingReader) verify() error {
+	if v.read != v.size {
+		return newInvalidPackageError("file %s has size %d, expected %d", v.path, v.read, v.size)
+	}
+	if actual := hex.EncodeToString(v.hash.Sum(nil)); actual != v.sha256 {
+		return newInvalidPackageError("file %s has hash %s, expected %s", v.path, actual, v.sha256)
+	}
+	return io.EOF
+}
+
+// PackageDecoder sequentially decodes a lime package from a stream that does not support seeking. Files are
+// verified against their size and the SHA256 hash in the manifest while they are read.
+type PackageDecoder struct {
+	r          io.Reader
+	header     *packageHeader
+	position   int64
+	next       int
+	current    io.ReadCloser
+	compressed io.Reader
+}
+
+// NewPackageDecoder creates a new PackageDecoder that reads from r. The manifest and index are read immediately.
+func NewPackageDecoder(r io.Reader) (*PackageDecoder, error) {
+	header, err := readPackageHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var position int64
+	for _, entry := range header.index.Files {
+		if entry.FileOffset < position {
+			return nil, newInvalidPackageError("index entry for %s is out of order", entry.Path)
+		}
+		position = entry.FileOffset + entry.CompressedSize
+	}
+
+	return &PackageDecoder{r: r, header: header}, nil
+}
+
+// Manifest returns the package manifest
+func (d *PackageDecoder) Manifest() *Manifest {
+	return d.header.manifest
+}
+
+// Index returns the package file index
+func (d *PackageDecoder) Index() *LimePackageFileIndex {
+	return d.header.index
+}
+
+// Signature returns the embedded package signature or nil if the package is not signed
+func (d *PackageDecoder) Signature() *LimePackageSignature {
+	return d.header.signature
+}
+
+// SetVerifier sets the verifier that must verify the package signature before any file is extracted, replacing the
+// default verifier. Next verifies the embedded signature unless VerifyDetached already succeeded with verifier.
+func (d *PackageDecoder) SetVerifier(verifier *PackageVerifier) {
+	d.header.verifier = verifier
+	d.header.verified = false
+}
+
+// InsecureSkipVerify allows files to be extracted without verifying the package signature even if a verifier is
+// configured. InsecureSkipVerify should only be used for packages that are known to be trusted.
+func (d *PackageDecoder) InsecureSkipVerify() {
+	d.header.insecure = true
+}
+
+// Verify verifies the embedded package signature. Verify should be called before any file is extracted.
+func (d *PackageDecoder) Verify(verifier *PackageVerifier) error {
+	return d.header.verify(verifier, d.header.signature)
+}
+
+// VerifyDetached verifies a detached package signature
+func (d *PackageDecoder) VerifyDetached(verifier *PackageVerifier, signature *LimePackageSignature) error {
+	return d.header.verify(verifier, signature)
+}
+
+// Next advances to the next file in index order and returns its index entry and a reader for its contents. Any
+// unread contents of the previous file are verified and discarded. Next returns io.EOF when there are no more files.
+func (d *PackageDecoder) Next() (*LimePackageFileIndexEntry, io.Reader, error) {
+	if err := d.header.checkVerified(); err != nil {
+		return nil, nil, err
+	}
+	if d.current != nil {
+		current := d.current
+		d.current = nil
+		if _, err := io.Copy(ioutil.Discard, current); err != nil {
+			return nil, nil, err
+		}
+		if err := current.Close(); err != nil {
+			return nil, nil, err
+		}
+		if _, err := io.Copy(ioutil.Discard, d.compressed); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if d.next >= len(d.header.index.Files) {
+		return nil, nil, io.EOF
+	}
+	entry := &d.header.index.Files[d.next]
+	d.next++
+
+	if skip := entry.FileOffset - d.position; skip > 0 {
+		if _, err := io.CopyN(ioutil.Discard, d.r, skip); err != nil {
+			return nil, nil, newInvalidPackageError("cannot read file %s: %s", entry.Path, err)
+		}
+	}
+	d.position = entry.FileOffset + entry.CompressedSize
+
+	file := d.header.manifest.Files.Find(entry.Path)
+	if file == nil {
+		return nil, nil, newInvalidPackageError("file %s is not listed in the manifest", entry.Path)
+	}
+
+	codec, err := LookupCodec(entry.Compression)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.compressed = io.LimitReader(d.r, entry.CompressedSize)
+	r, err := codec.NewReader(d.compressed)
+	if err != nil {
+		return nil, nil, newInvalidPackageError("cannot decompress file %s: %s", entry.Path, err)
+	}
+	d.current = readCloser{newVerifyingReader(r, entry.Path, entry.Size, file.SHA256), r}
+	return entry, d.current, nil
+}
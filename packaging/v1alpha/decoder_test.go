@@ -0,0 +1,79 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageDecoder(t *testing.T) {
+	raw := testPackage(t, map[string]string{"/a": "contents of a", "/b": "contents of b", "/c": "contents of c"})
+
+	d, err := NewPackageDecoder(bytes.NewReader(raw))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, PackageName("test"), d.Manifest().Name)
+
+	var paths []string
+	for {
+		entry, r, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		paths = append(paths, entry.Path)
+		if entry.Path == "/b" {
+			continue
+		}
+		contents, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "contents of "+entry.Path[1:], string(contents))
+	}
+	assert.Len(t, paths, 3)
+
+	corrupt := append([]byte{}, raw...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	d, err = NewPackageDecoder(bytes.NewReader(corrupt))
+	if assert.NoError(t, err) {
+		var failed error
+		for failed == nil {
+			var r io.Reader
+			if _, r, failed = d.Next(); failed == nil {
+				_, failed = ioutil.ReadAll(r)
+			}
+		}
+		assert.IsType(t, &InvalidPackageError{}, failed)
+	}
+
+	d, err = NewPackageDecoder(bytes.NewReader(raw[:len(raw)-1]))
+	if assert.NoError(t, err) {
+		var failed error
+		for failed == nil {
+			var r io.Reader
+			if _, r, failed = d.Next(); failed == nil {
+				_, failed = ioutil.ReadAll(r)
+			}
+		}
+		assert.IsType(t, &InvalidPackageError{}, failed)
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+// A lime delta package reconstructs a lime package from an older version of the same package. It is laid out as
+// follows:
+//
+//	Magic           8 bytes  "LiMeDlta"
+//	HeaderLength    8 bytes  length of the header
+//	Header          yaml encoded DeltaHeader
+//	ManifestLength  8 bytes  length of the manifest
+//	Manifest        yaml encoded Manifest of the new package
+//	IndexLength     8 bytes  length of the index
+//	Index           yaml encoded LimePackageFileIndex of the new package
+//	SignatureLength 8 bytes  length of the signature, zero if the new package is not signed
+//	Signature       yaml encoded LimePackageSignature of the new package
+//	Data            the concatenated stored file contents and patches
+//
+// The manifest, index and signature are copied unchanged from the new package, so that the reconstructed package
+// verifies against the key of its publisher. The Offset of a DeltaFile is relative to the start of the Data section.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LimeDeltaMagic is the magic characters for a lime delta package
+	LimeDeltaMagic string = "LiMeDlta"
+)
+
+// DeltaFile describes how a file of the new package is reconstructed
+type DeltaFile struct {
+	Path        string      `yaml:"path" json:"path"`                                   // Path is the full path of the file in the new package
+	Method      DeltaMethod `yaml:"method" json:"method"`                               // Method is how the file is reconstructed
+	Base        string      `yaml:"base,omitempty" json:"base,omitempty"`               // Base is the path of the base package file that is copied or patched
+	BaseSHA256  string      `yaml:"baseHash,omitempty" json:"baseHash,omitempty"`       // BaseSHA256 is the SHA256 hash of the base package file
+	Compression Compression `yaml:"compression,omitempty" json:"compression,omitempty"` // Compression is the codec used to compress the stored data
+	Size        int64       `yaml:"size,omitempty" json:"size,omitempty"`               // Size is the length of the stored data
+	Offset      int64       `yaml:"offset,omitempty" json:"offset,omitempty"`           // Offset is the offset of the stored data in the Data section
+}
+
+// DeltaHeader describes a lime delta package
+type DeltaHeader struct {
+	Name  PackageName    `yaml:"name" json:"name"`      // Name is the name of the package
+	From  common.Version `yaml:"from,flow" json:"from"` // From is the version of the base package
+	To    common.Version `yaml:"to,flow" json:"to"`     // To is the version of the reconstructed package
+	Files []*DeltaFile   `yaml:"files" json:"files"`    // Files describe how each file of the new package is reconstructed
+}
+
+// DeltaBase provides the files of the base package a delta package is applied to. A *PackageReader of the old
+// package is a DeltaBase, installers may also provide the installed files.
+type DeltaBase interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+// DeltaPackage is a lime delta package
+type DeltaPackage struct {
+	header       *DeltaHeader
+	rawManifest  []byte
+	rawIndex     []byte
+	rawSignature []byte
+	manifest     *Manifest
+	index        *LimePackageFileIndex
+	data         []byte
+}
+
+// readVerified reads a file of a package and checks it against an expected SHA256 hash
+func readVerified(base DeltaBase, path, hash string) ([]byte, error) {
+	r, err := base.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(contents)
+	if hex.EncodeToString(sum[:]) != hash {
+		return nil, newInvalidPackageError("hash mismatch for %s", path)
+	}
+	return contents, nil
+}
+
+// NewDeltaPackage creates a delta package that reconstructs target from base. Files that are unchanged, possibly
+// at another path, are copied from base. Changed files are stored as a binary patch of the base file at the same
+// path if that is smaller than their contents, other files are stored in full. Stored data is compressed using
+// compression.
+func NewDeltaPackage(base, target *PackageReader, compression Compression) (*DeltaPackage, error) {
+	from, to := base.Manifest(), target.Manifest()
+	if from.Name != to.Name {
+		return nil, fmt.Errorf("cannot create delta from %s to %s", from.Name, to.Name)
+	}
+	codec, err := LookupCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	byHash := map[string]string{}
+	for _, f := range from.Files {
+		if _, found := byHash[f.SHA256]; !found {
+			byHash[f.SHA256] = f.Path
+		}
+	}
+
+	d := &DeltaPackage{
+		header:       &DeltaHeader{Name: to.Name, From: from.Version, To: to.Version},
+		rawManifest:  target.header.rawManifest,
+		rawIndex:     target.header.rawIndex,
+		rawSignature: target.header.rawSignature,
+		manifest:     to,
+		index:        target.Index(),
+	}
+	var data bytes.Buffer
+	for _, file := range to.Files {
+		previous := from.Files.Find(file.Path)
+		if previous != nil && previous.SHA256 == file.SHA256 {
+			d.header.Files = append(d.header.Files, &DeltaFile{Path: file.Path, Method: DeltaCopy, Base: file.Path, BaseSHA256: file.SHA256})
+			continue
+		}
+		if path, found := byHash[file.SHA256]; found {
+			d.header.Files = append(d.header.Files, &DeltaFile{Path: file.Path, Method: DeltaCopy, Base: path, BaseSHA256: file.SHA256})
+			continue
+		}
+
+		contents, err := readVerified(target, file.Path, file.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		entry := &DeltaFile{Path: file.Path, Method: DeltaFull, Compression: compression}
+		stored := contents
+		if previous != nil {
+			old, err := readVerified(base, previous.Path, previous.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			if patch := diffBytes(old, contents); len(patch) < len(contents) {
+				entry.Method, entry.Base, entry.BaseSHA256 = DeltaPatch, previous.Path, previous.SHA256
+				stored = patch
+			}
+		}
+
+		entry.Offset = int64(data.Len())
+		w, err := codec.NewWriter(&data)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(stored); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		entry.Size = int64(data.Len()) - entry.Offset
+		d.header.Files = append(d.header.Files, entry)
+	}
+	d.data = data.Bytes()
+	return d, nil
+}
+
+// ReadDeltaPackage reads a delta package from r
+func ReadDeltaPackage(r io.Reader) (*DeltaPackage, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != LimeDeltaMagic {
+		return nil, newInvalidPackageError("not a lime delta package")
+	}
+	rawHeader, err := readSection(r, "delta header")
+	if err != nil {
+		return nil, err
+	}
+	d := &DeltaPackage{header: &DeltaHeader{}, manifest: &Manifest{}, index: &LimePackageFileIndex{}}
+	if d.rawManifest, err = readSection(r, "manifest"); err != nil {
+		return nil, err
+	}
+	if d.rawIndex, err = readSection(r, "index"); err != nil {
+		return nil, err
+	}
+	if d.rawSignature, err = readSection(r, "signature"); err != nil {
+		return nil, err
+	}
+	if d.data, err = ioutil.ReadAll(r); err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(rawHeader, d.header); err != nil {
+		return nil, newInvalidPackageError("cannot decode delta header: %s", err)
+	}
+	if err = yaml.Unmarshal(d.rawManifest, d.manifest); err != nil {
+		return nil, newInvalidPackageError("cannot decode manifest: %s", err)
+	}
+	if err = yaml.Unmarshal(d.rawIndex, d.index); err != nil {
+		return nil, newInvalidPackageError("cannot decode index: %s", err)
+	}
+
+	for _, entry := range d.header.Files {
+		if entry.Offset < 0 || entry.Size < 0 || entry.Offset > int64(len(d.data)) || entry.Size > int64(len(d.data))-entry.Offset {
+			return nil, newInvalidPackageError("invalid delta entry for %s", entry.Path)
+		}
+	}
+	return d, nil
+}
+
+// Header returns the delta header
+func (d *DeltaPackage) Header() *DeltaHeader {
+	return d.header
+}
+
+// Manifest returns the manifest of the reconstructed package
+func (d *DeltaPackage) Manifest() *Manifest {
+	return d.manifest
+}
+
+// WriteTo writes the delta package to w
+func (d *DeltaPackage) WriteTo(w io.Writer) (int64, error) {
+	header, err := yaml.Marshal(d.header)
+	if err != nil {
+		return 0, err
+	}
+	headerLength, manifestLength := encodeLength(int64(len(header))), encodeLength(int64(len(d.rawManifest)))
+	indexLength, signatureLength := encodeLength(int64(len(d.rawIndex))), encodeLength(int64(len(d.rawSignature)))
+
+	var written int64
+	for _, part := range [][]byte{[]byte(LimeDeltaMagic), headerLength[:], header, manifestLength[:], d.rawManifest,
+		indexLength[:], d.rawIndex, signatureLength[:], d.rawSignature, d.data} {
+		n, err := w.Write(part)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// find returns the delta entry for the file at path
+func (d *DeltaPackage) find(path string) *DeltaFile {
+	for _, entry := range d.header.Files {
+		if entry.Path == path {
+			return entry
+		}
+	}
+	return nil
+}
+
+// stored returns the decompressed data stored for an entry
+func (d *DeltaPackage) stored(entry *DeltaFile) ([]byte, error) {
+	codec, err := LookupCodec(entry.Compression)
+	if err != nil {
+		return nil, err
+	}
+	r, err := codec.NewReader(bytes.NewReader(d.data[entry.Offset : entry.Offset+entry.Size]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// reconstruct returns the contents of a file of the new package
+func (d *DeltaPackage) reconstruct(base DeltaBase, entry *DeltaFile) ([]byte, error) {
+	switch entry.Method {
+	case DeltaCopy:
+		return readVerified(base, entry.Base, entry.BaseSHA256)
+	case DeltaFull:
+		return d.stored(entry)
+	case DeltaPatch:
+		old, err := readVerified(base, entry.Base, entry.BaseSHA256)
+		if err != nil {
+			return nil, err
+		}
+		patch, err := d.stored(entry)
+		if err != nil {
+			return nil, err
+		}
+		return patchBytes(old, patch)
+	}
+	return nil, newInvalidPackageError("invalid delta method for %s", entry.Path)
+}
+
+// Apply reconstructs the new package from the files of base. Every base file that is used is checked against the
+// hash recorded in the delta and every reconstructed file is verified against the SHA256 hash listed in the new
+// manifest. The index must list the files back to back in index order starting at offset zero. The reconstructed
+// package keeps the manifest, index and signature of the new package, so a signed package still verifies against the
+// key of its publisher. Files are compressed as listed in the index, which requires the codecs to be deterministic as
+// the built-in codecs are.
+func (d *DeltaPackage) Apply(base DeltaBase) (*RawLimePackage, error) {
+	var position int64
+	for _, indexed := range d.index.Files {
+		if indexed.FileOffset != position || indexed.CompressedSize < 0 {
+			return nil, newInvalidPackageError("index entry for %s does not follow the previous file", indexed.Path)
+		}
+		position += indexed.CompressedSize
+	}
+
+	var files []byte
+	for _, indexed := range d.index.Files {
+		file := d.manifest.Files.Find(indexed.Path)
+		if file == nil {
+			return nil, newInvalidPackageError("index entry for %s is not listed in the manifest", indexed.Path)
+		}
+		entry := d.find(file.Path)
+		if entry == nil {
+			return nil, newInvalidPackageError("delta package has no entry for %s", file.Path)
+		}
+		contents, err := d.reconstruct(base, entry)
+		if err != nil {
+			return nil, fmt.Errorf("cannot reconstruct %s: %s", file.Path, err)
+		}
+		sum := sha256.Sum256(contents)
+		if hex.EncodeToString(sum[:]) != file.SHA256 {
+			return nil, newInvalidPackageError("reconstructed %s does not match the manifest hash", file.Path)
+		}
+
+		codec, err := LookupCodec(indexed.Compression)
+		if err != nil {
+			return nil, err
+		}
+		var compressed bytes.Buffer
+		w, err := codec.NewWriter(&compressed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(contents); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		if indexed.Size != int64(len(contents)) || indexed.CompressedSize != int64(compressed.Len()) {
+			return nil, newInvalidPackageError("reconstructed %s does not match the index entry", file.Path)
+		}
+		files = append(files, compressed.Bytes()...)
+	}
+	for _, file := range d.manifest.Files {
+		if !d.indexed(file.Path) {
+			return nil, newInvalidPackageError("package file %s is missing from the index", file.Path)
+		}
+	}
+
+	raw := &RawLimePackage{
+		ManifestLength:  encodeLength(int64(len(d.rawManifest))),
+		Manifest:        d.rawManifest,
+		IndexLength:     encodeLength(int64(len(d.rawIndex))),
+		Index:           d.rawIndex,
+		SignatureLength: encodeLength(int64(len(d.rawSignature))),
+		Signature:       d.rawSignature,
+		Files:           files,
+	}
+	copy(raw.Magic[:], LimePackageMagic)
+	return raw, nil
+}
+
+// indexed returns whether the index of the new package has an entry for the file at path
+func (d *DeltaPackage) indexed(path string) bool {
+	for _, entry := range d.index.Files {
+		if entry.Path == path {
+			return true
+		}
+	}
+	return false
+}
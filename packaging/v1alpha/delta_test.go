@@ -0,0 +1,196 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testVersionedPackage(t *testing.T, version common.Version, files ...[2]string) *PackageReader {
+	manifest := testManifest()
+	manifest.Version = version
+	w := NewPackageWriter(manifest)
+	for _, f := range files {
+		if !assert.NoError(t, w.AddFile(&File{Path: f[0], Type: DataFile}, strings.NewReader(f[1]))) {
+			t.FailNow()
+		}
+	}
+	var out bytes.Buffer
+	if _, err := w.WriteTo(&out); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	p, err := OpenPackage(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return p
+}
+
+type testDeltaBase map[string]string
+
+func (b testDeltaBase) Open(path string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(b[path])), nil
+}
+
+func TestDeltaPackage(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	large := make([]byte, 8192)
+	random.Read(large)
+	changed := append(append([]byte{}, large[:4000]...), large[4100:]...)
+
+	base := testVersionedPackage(t, common.Version{Major: 1},
+		[2]string{"/same", "unchanged"}, [2]string{"/old/moved", "moved contents"},
+		[2]string{"/large", string(large)}, [2]string{"/small", "old small"}, [2]string{"/removed", "removed"})
+	target := testVersionedPackage(t, common.Version{Major: 2},
+		[2]string{"/same", "unchanged"}, [2]string{"/new/moved", "moved contents"},
+		[2]string{"/large", string(changed)}, [2]string{"/small", "new small"}, [2]string{"/added", "added"})
+
+	delta, err := NewDeltaPackage(base, target, GzipCompression)
+	if !assert.NoError(t, err) {
+		return
+	}
+	methods := map[string]DeltaMethod{}
+	for _, f := range delta.Header().Files {
+		methods[f.Path] = f.Method
+	}
+	assert.Equal(t, map[string]DeltaMethod{
+		"/same": DeltaCopy, "/new/moved": DeltaCopy, "/large": DeltaPatch, "/small": DeltaFull, "/added": DeltaFull,
+	}, methods)
+
+	var out bytes.Buffer
+	_, err = delta.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Less(t, out.Len(), len(large))
+
+	read, err := ReadDeltaPackage(bytes.NewReader(out.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "v1.0.0", read.Header().From.String())
+	assert.Equal(t, "v2.0.0", read.Manifest().Version.String())
+
+	raw, err := read.Apply(base)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var rebuilt bytes.Buffer
+	_, err = raw.WriteTo(&rebuilt)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p, err := OpenPackage(bytes.NewReader(rebuilt.Bytes()), int64(rebuilt.Len()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, target.Manifest().Files, p.Manifest().Files)
+		assert.True(t, p.VerifyContents().OK())
+		r, err := p.Open("/large")
+		if assert.NoError(t, err) {
+			contents, _ := ioutil.ReadAll(r)
+			assert.True(t, bytes.Equal(changed, contents))
+		}
+	}
+
+	installed := testDeltaBase{"/same": "unchanged", "/old/moved": "moved contents", "/large": string(large), "/small": "old small"}
+	_, err = read.Apply(installed)
+	assert.NoError(t, err)
+	installed["/large"] = "locally modified"
+	_, err = read.Apply(installed)
+	assert.Error(t, err)
+
+	files := read.index.Files
+	for _, offset := range []int64{files[1].FileOffset + 1, files[1].FileOffset - 1, 0, 1 << 62} {
+		read.index.Files = append([]LimePackageFileIndexEntry{}, files...)
+		read.index.Files[1].FileOffset = offset
+		_, err = read.Apply(base)
+		assert.IsType(t, &InvalidPackageError{}, err, "offset %d", offset)
+	}
+	read.index.Files = files
+
+	empty := testVersionedPackage(t, common.Version{Major: 2})
+	_, err = NewDeltaPackage(base, empty, NoCompression)
+	assert.NoError(t, err)
+	empty.Manifest().Name = "other"
+	_, err = NewDeltaPackage(base, empty, NoCompression)
+	assert.Error(t, err)
+	_, err = ReadDeltaPackage(bytes.NewReader(out.Bytes()[:20]))
+	assert.Error(t, err)
+	_, err = ReadDeltaPackage(strings.NewReader("LiMedPkg"))
+	assert.Error(t, err)
+}
+
+func TestDeltaPackageSignature(t *testing.T) {
+	root := newTestCertificate(t, "root", nil)
+	leaf := newTestCertificate(t, "leaf", root)
+
+	base := testVersionedPackage(t, common.Version{Major: 1}, [2]string{"/a", "old contents of a"}, [2]string{"/b", "b"})
+	manifest := testManifest()
+	manifest.Version = common.Version{Major: 2}
+	w := NewPackageWriter(manifest)
+	w.SetDefaultCompression(GzipCompression)
+	w.SetCompression(ExecutableFile, ZstdCompression)
+	w.SetSigner(NewPackageSigner(leaf))
+	assert.NoError(t, w.AddFile(&File{Path: "/a", Type: DataFile}, strings.NewReader("new contents of a")))
+	assert.NoError(t, w.AddFile(&File{Path: "/b", Type: ExecutableFile}, strings.NewReader("b")))
+	assert.NoError(t, w.AddFile(&File{Path: "/c", Type: DataFile}, strings.NewReader("contents of c")))
+	var signed bytes.Buffer
+	if _, err := w.WriteTo(&signed); !assert.NoError(t, err) {
+		return
+	}
+	target, err := OpenPackage(bytes.NewReader(signed.Bytes()), int64(signed.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	delta, err := NewDeltaPackage(base, target, XZCompression)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var out bytes.Buffer
+	if _, err = delta.WriteTo(&out); !assert.NoError(t, err) {
+		return
+	}
+	read, err := ReadDeltaPackage(bytes.NewReader(out.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw, err := read.Apply(base)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var rebuilt bytes.Buffer
+	if _, err = raw.WriteTo(&rebuilt); !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, bytes.Equal(signed.Bytes(), rebuilt.Bytes()))
+	p, err := OpenPackage(bytes.NewReader(rebuilt.Bytes()), int64(rebuilt.Len()))
+	if assert.NoError(t, err) {
+		assert.NoError(t, p.Verify(NewPackageVerifier(root)))
+		assert.True(t, p.VerifyContents().OK())
+	}
+
+	read.manifest.Files.Find("/c").SHA256 = hashOf("tampered")
+	_, err = read.Apply(base)
+	assert.IsType(t, &InvalidPackageError{}, err)
+}
@@ -0,0 +1,417 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	"gopkg.in/yaml.v3"
+)
+
+// FieldChange is a changed field of a manifest element
+type FieldChange struct {
+	Field string `json:"field"`         // Field is the name of the field
+	Old   string `json:"old,omitempty"` // Old is the value in the old manifest
+	New   string `json:"new,omitempty"` // New is the value in the new manifest
+}
+
+// String implements the Stringer interface.
+func (c *FieldChange) String() string {
+	return fmt.Sprintf("%s %s -> %s", c.Field, quoteEmpty(c.Old), quoteEmpty(c.New))
+}
+
+// FileChange is a file that differs between two manifests
+type FileChange struct {
+	Path   string         `json:"path"`             // Path is the full path of the file
+	Change ChangeType     `json:"change"`           // Change is how the file differs
+	Fields []*FieldChange `json:"fields,omitempty"` // Fields are the changed fields of a changed file
+}
+
+// DependencyChange is a dependency that differs between two manifests
+type DependencyChange struct {
+	Name         PackageName  `json:"name"`          // Name is the name of the dependant package
+	Relationship Relationship `json:"relation"`      // Relationship is the relationship to the dependant package
+	Change       ChangeType   `json:"change"`        // Change is how the dependency differs
+	Old          string       `json:"old,omitempty"` // Old is the dependency in the old manifest
+	New          string       `json:"new,omitempty"` // New is the dependency in the new manifest
+}
+
+// ActionChange is an action that differs between two manifests
+type ActionChange struct {
+	Type   ActionType     `json:"type"`             // Type is the type of the action
+	Change ChangeType     `json:"change"`           // Change is how the action differs
+	Fields []*FieldChange `json:"fields,omitempty"` // Fields are the changed before and after items of a changed action
+}
+
+// TriggerChange is a trigger that differs between two manifests. Triggers are identified by their events and paths.
+type TriggerChange struct {
+	Trigger string         `json:"trigger"`          // Trigger identifies the trigger by its events and paths
+	Change  ChangeType     `json:"change"`           // Change is how the trigger differs
+	Fields  []*FieldChange `json:"fields,omitempty"` // Fields are the changed items of a changed trigger
+}
+
+// ManifestDiff are the differences between two manifests
+type ManifestDiff struct {
+	Name         PackageName         `json:"name"`                   // Name is the name of the new package
+	OldVersion   common.Version      `json:"oldVersion"`             // OldVersion is the version of the old package
+	NewVersion   common.Version      `json:"newVersion"`             // NewVersion is the version of the new package
+	Metadata     []*FieldChange      `json:"metadata,omitempty"`     // Metadata are the changed package fields and metadata
+	Files        []*FileChange       `json:"files,omitempty"`        // Files are the changed files ordered by path
+	Dependencies []*DependencyChange `json:"dependencies,omitempty"` // Dependencies are the changed dependencies
+	Actions      []*ActionChange     `json:"actions,omitempty"`      // Actions are the changed actions
+	Triggers     []*TriggerChange    `json:"triggers,omitempty"`     // Triggers are the changed triggers
+}
+
+// DiffManifests computes the differences between an old and a new manifest
+func DiffManifests(old, new *Manifest) *ManifestDiff {
+	d := &ManifestDiff{Name: new.Name, OldVersion: old.Version, NewVersion: new.Version}
+	d.diffMetadata(old, new)
+	d.diffFiles(old.Files, new.Files)
+	d.diffDependencies(old.Dependencies, new.Dependencies)
+	d.diffActions(old.Actions, new.Actions)
+	d.diffTriggers(old.Triggers, new.Triggers)
+	return d
+}
+
+// DiffPackages computes the differences between the manifests of an old and a new package. File contents are
+// compared by the SHA256 hashes listed in the manifests.
+func DiffPackages(old, new *PackageReader) *ManifestDiff {
+	return DiffManifests(old.Manifest(), new.Manifest())
+}
+
+// Empty checks if the manifests do not differ
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Metadata) == 0 && len(d.Files) == 0 && len(d.Dependencies) == 0 && len(d.Actions) == 0 &&
+		len(d.Triggers) == 0
+}
+
+// manifestDiffJSON is the json encoding of a ManifestDiff, its versions are rendered as strings
+type manifestDiffJSON struct {
+	*plainManifestDiff
+	OldVersion string `json:"oldVersion"`
+	NewVersion string `json:"newVersion"`
+}
+
+type plainManifestDiff ManifestDiff
+
+// MarshalJSON implements the json marshaller method
+func (d *ManifestDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&manifestDiffJSON{(*plainManifestDiff)(d), d.OldVersion.String(), d.NewVersion.String()})
+}
+
+// JSON renders the differences as indented JSON
+func (d *ManifestDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// String renders the differences as text
+func (d *ManifestDiff) String() string {
+	var b strings.Builder
+	d.WriteText(&b)
+	return b.String()
+}
+
+// WriteText writes a readable rendering of the differences to w. Added elements are prefixed with +, removed
+// elements with - and changed elements with ~.
+func (d *ManifestDiff) WriteText(w io.Writer) (err error) {
+	printf := func(format string, a ...interface{}) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, a...)
+		}
+	}
+
+	printf("%s %s -> %s\n", d.Name, d.OldVersion.String(), d.NewVersion.String())
+	if len(d.Metadata) > 0 {
+		printf("metadata:\n")
+		for _, c := range d.Metadata {
+			printf("  ~ %s\n", c)
+		}
+	}
+	if len(d.Files) > 0 {
+		printf("files:\n")
+		for _, c := range d.Files {
+			printf("  %s %s%s\n", changeSymbol(c.Change), c.Path, describeFields(c.Fields))
+		}
+	}
+	if len(d.Dependencies) > 0 {
+		printf("dependencies:\n")
+		for _, c := range d.Dependencies {
+			switch c.Change {
+			case Added:
+				printf("  + %s %s\n", c.Relationship, c.New)
+			case Removed:
+				printf("  - %s %s\n", c.Relationship, c.Old)
+			default:
+				printf("  ~ %s %s -> %s\n", c.Relationship, c.Old, c.New)
+			}
+		}
+	}
+	if len(d.Actions) > 0 {
+		printf("actions:\n")
+		for _, c := range d.Actions {
+			printf("  %s %s%s\n", changeSymbol(c.Change), c.Type, describeFields(c.Fields))
+		}
+	}
+	if len(d.Triggers) > 0 {
+		printf("triggers:\n")
+		for _, c := range d.Triggers {
+			printf("  %s %s%s\n", changeSymbol(c.Change), c.Trigger, describeFields(c.Fields))
+		}
+	}
+	return
+}
+
+func changeSymbol(c ChangeType) string {
+	switch c {
+	case Added:
+		return "+"
+	case Removed:
+		return "-"
+	}
+	return "~"
+}
+
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
+}
+
+func describeFields(fields []*FieldChange) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	described := make([]string, 0, len(fields))
+	for _, f := range fields {
+		described = append(described, f.String())
+	}
+	return ": " + strings.Join(described, ", ")
+}
+
+// compareField appends a FieldChange to fields if old and new differ
+func compareField(fields []*FieldChange, field, old, new string) []*FieldChange {
+	if old != new {
+		fields = append(fields, &FieldChange{Field: field, Old: old, New: new})
+	}
+	return fields
+}
+
+func (d *ManifestDiff) diffMetadata(old, new *Manifest) {
+	d.Metadata = compareField(d.Metadata, "name", string(old.Name), string(new.Name))
+	d.Metadata = compareField(d.Metadata, "version", old.Version.String(), new.Version.String())
+	d.Metadata = compareField(d.Metadata, "versionScheme", old.VersionScheme.String(), new.VersionScheme.String())
+	d.Metadata = compareField(d.Metadata, "description", old.Metadata.Description, new.Metadata.Description)
+	d.Metadata = compareField(d.Metadata, "arch", joinArchitectures(old.Metadata.Architectures), joinArchitectures(new.Metadata.Architectures))
+	d.Metadata = compareField(d.Metadata, "plugins", joinPlugins(old.Plugins), joinPlugins(new.Plugins))
+	d.Metadata = compareField(d.Metadata, "activates", strings.Join(old.Activates, ","), strings.Join(new.Activates, ","))
+
+	oldItems, newItems := map[string]string{}, map[string]string{}
+	seen := map[string]bool{}
+	var keys []string
+	for _, item := range old.Metadata.Items {
+		oldItems[item.Key] = item.Value
+	}
+	for _, item := range new.Metadata.Items {
+		newItems[item.Key] = item.Value
+	}
+	for _, items := range [][]*MetadataItem{old.Metadata.Items, new.Metadata.Items} {
+		for _, item := range items {
+			if !seen[item.Key] {
+				seen[item.Key] = true
+				keys = append(keys, item.Key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d.Metadata = compareField(d.Metadata, "items."+key, oldItems[key], newItems[key])
+	}
+}
+
+func joinArchitectures(architectures common.Architectures) string {
+	names := make([]string, 0, len(architectures))
+	for _, a := range architectures {
+		names = append(names, a.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func joinPlugins(plugins Plugins) string {
+	names := make([]string, 0, len(plugins))
+	for _, p := range plugins {
+		names = append(names, string(p.Name))
+	}
+	return strings.Join(names, ",")
+}
+
+func (d *ManifestDiff) diffFiles(old, new Files) {
+	for _, f := range old {
+		if new.Find(f.Path) == nil {
+			d.Files = append(d.Files, &FileChange{Path: f.Path, Change: Removed})
+		}
+	}
+	for _, f := range new {
+		previous := old.Find(f.Path)
+		if previous == nil {
+			d.Files = append(d.Files, &FileChange{Path: f.Path, Change: Added})
+			continue
+		}
+		var fields []*FieldChange
+		fields = compareField(fields, "type", previous.Type.String(), f.Type.String())
+		fields = compareField(fields, "common", strconv.FormatBool(previous.IsCommon), strconv.FormatBool(f.IsCommon))
+		fields = compareField(fields, "hash", previous.SHA256, f.SHA256)
+		fields = compareField(fields, "user", previous.User, f.User)
+		fields = compareField(fields, "group", previous.Group, f.Group)
+		fields = compareField(fields, "mode", fmt.Sprintf("%o", previous.Mode), fmt.Sprintf("%o", f.Mode))
+		if len(fields) > 0 {
+			d.Files = append(d.Files, &FileChange{Path: f.Path, Change: Changed, Fields: fields})
+		}
+	}
+	sort.SliceStable(d.Files, func(i, j int) bool { return d.Files[i].Path < d.Files[j].Path })
+}
+
+// diffDependencies matches equal dependencies first, the remaining dependencies are paired by name and relationship
+// so that each constraint of a version range is reported separately
+func (d *ManifestDiff) diffDependencies(old, new Dependencies) {
+	matched := map[*Dependency]bool{}
+	find := func(deps Dependencies, dep *Dependency, equal bool) *Dependency {
+		for _, other := range deps {
+			if !matched[other] && other.Name == dep.Name && other.Relationship == dep.Relationship &&
+				(!equal || other.String() == dep.String()) {
+				return other
+			}
+		}
+		return nil
+	}
+
+	for _, dep := range old {
+		if other := find(new, dep, true); other != nil {
+			matched[dep], matched[other] = true, true
+		}
+	}
+	for _, dep := range old {
+		if matched[dep] {
+			continue
+		}
+		other := find(new, dep, false)
+		if other == nil {
+			d.Dependencies = append(d.Dependencies, &DependencyChange{Name: dep.Name, Relationship: dep.Relationship, Change: Removed, Old: dep.String()})
+			continue
+		}
+		matched[other] = true
+		d.Dependencies = append(d.Dependencies, &DependencyChange{
+			Name:         dep.Name,
+			Relationship: dep.Relationship,
+			Change:       Changed,
+			Old:          dep.String(),
+			New:          other.String(),
+		})
+	}
+	for _, dep := range new {
+		if !matched[dep] {
+			d.Dependencies = append(d.Dependencies, &DependencyChange{Name: dep.Name, Relationship: dep.Relationship, Change: Added, New: dep.String()})
+		}
+	}
+	sort.SliceStable(d.Dependencies, func(i, j int) bool {
+		a, b := d.Dependencies[i], d.Dependencies[j]
+		if a.Relationship != b.Relationship {
+			return a.Relationship < b.Relationship
+		}
+		return a.Name < b.Name
+	})
+}
+
+// describeItems renders action items as flow style YAML
+func describeItems(items ActionItems) string {
+	if len(items) == 0 {
+		return ""
+	}
+	encoded, err := yaml.Marshal(items)
+	if err != nil {
+		return err.Error()
+	}
+	var document yaml.Node
+	if err = yaml.Unmarshal(encoded, &document); err != nil {
+		return err.Error()
+	}
+	document.Content[0].Style = yaml.FlowStyle
+	if encoded, err = yaml.Marshal(document.Content[0]); err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(string(encoded))
+}
+
+func (d *ManifestDiff) diffActions(old, new Actions) {
+	for _, a := range old {
+		if new.Find(a.Type) == nil {
+			d.Actions = append(d.Actions, &ActionChange{Type: a.Type, Change: Removed})
+		}
+	}
+	for _, a := range new {
+		previous := old.Find(a.Type)
+		if previous == nil {
+			d.Actions = append(d.Actions, &ActionChange{Type: a.Type, Change: Added})
+			continue
+		}
+		var fields []*FieldChange
+		fields = compareField(fields, "before", describeItems(previous.Before), describeItems(a.Before))
+		fields = compareField(fields, "after", describeItems(previous.After), describeItems(a.After))
+		if len(fields) > 0 {
+			d.Actions = append(d.Actions, &ActionChange{Type: a.Type, Change: Changed, Fields: fields})
+		}
+	}
+	sort.SliceStable(d.Actions, func(i, j int) bool { return d.Actions[i].Type < d.Actions[j].Type })
+}
+
+// triggerKey identifies a trigger by its events and paths
+func triggerKey(t *Trigger) string {
+	return strings.Join(append(append([]string{}, t.Events...), t.Paths...), ",")
+}
+
+func (d *ManifestDiff) diffTriggers(old, new Triggers) {
+	find := func(triggers Triggers, key string) *Trigger {
+		for _, t := range triggers {
+			if triggerKey(t) == key {
+				return t
+			}
+		}
+		return nil
+	}
+
+	for _, t := range old {
+		if key := triggerKey(t); find(new, key) == nil {
+			d.Triggers = append(d.Triggers, &TriggerChange{Trigger: key, Change: Removed})
+		}
+	}
+	for _, t := range new {
+		key := triggerKey(t)
+		previous := find(old, key)
+		if previous == nil {
+			d.Triggers = append(d.Triggers, &TriggerChange{Trigger: key, Change: Added})
+			continue
+		}
+		if fields := compareField(nil, "items", describeItems(previous.Items), describeItems(t.Items)); len(fields) > 0 {
+			d.Triggers = append(d.Triggers, &TriggerChange{Trigger: key, Change: Changed, Fields: fields})
+		}
+	}
+	sort.SliceStable(d.Triggers, func(i, j int) bool { return d.Triggers[i].Trigger < d.Triggers[j].Trigger })
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"encoding/json"
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifests(t *testing.T) {
+	old := testManifest()
+	old.Metadata.Description = "test package"
+	old.Metadata.Items = []*MetadataItem{{Key: "homepage", Value: "http://example.com"}, {Key: "license", Value: "MIT"}}
+	old.Files = Files{
+		&File{Path: "/etc/test.conf", Type: ConfigurationFile, SHA256: "a", Mode: 0644},
+		&File{Path: "/usr/bin/test", Type: ExecutableFile, SHA256: "b", Mode: 0755},
+		&File{Path: "/usr/share/test/old", Type: DataFile, SHA256: "c"},
+	}
+	old.Dependencies = Dependencies{
+		testDependency("libc", Depends, RequiresGreaterThan|RequiresEqual, "1.0.0"),
+		testDependency("legacy", Conflicts, Required(0), ""),
+	}
+	old.Actions = Actions{
+		&Action{Type: Install, After: ActionItems{&ActionItem{Values: &CommandAction{Command: []string{"setup"}}}}},
+		&Action{Type: Remove},
+	}
+	old.Triggers = Triggers{&Trigger{Events: []string{"ldconfig"}}}
+	assert.True(t, DiffManifests(old, old).Empty())
+
+	new := testManifest()
+	new.Version = common.Version{Major: 2}
+	new.Metadata.Description = "test package"
+	new.Metadata.Items = []*MetadataItem{{Key: "license", Value: "Apache-2.0"}, {Key: "support", Value: "none"}}
+	new.Files = Files{
+		&File{Path: "/etc/test.conf", Type: ConfigurationFile, SHA256: "a", Mode: 0600, User: "test"},
+		&File{Path: "/usr/bin/test", Type: ExecutableFile, SHA256: "d", Mode: 0755},
+		&File{Path: "/usr/bin/helper", Type: ExecutableFile, SHA256: "e", Mode: 0755},
+	}
+	new.Dependencies = Dependencies{
+		testDependency("libc", Depends, RequiresGreaterThan|RequiresEqual, "2.0.0"),
+		testDependency("tool", Recommends, Required(0), ""),
+	}
+	new.Actions = Actions{
+		&Action{Type: Install, After: ActionItems{&ActionItem{Values: &CommandAction{Command: []string{"setup", "--force"}}}}},
+		&Action{Type: Purge},
+	}
+	new.Triggers = Triggers{&Trigger{Events: []string{"systemd-reload"}}}
+
+	d := DiffManifests(old, new)
+	assert.False(t, d.Empty())
+	assert.Equal(t, []*FieldChange{
+		{Field: "version", Old: "v1.0.0", New: "v2.0.0"},
+		{Field: "items.homepage", Old: "http://example.com"},
+		{Field: "items.license", Old: "MIT", New: "Apache-2.0"},
+		{Field: "items.support", New: "none"},
+	}, d.Metadata)
+	assert.Equal(t, []*FileChange{
+		{Path: "/etc/test.conf", Change: Changed, Fields: []*FieldChange{{Field: "user", New: "test"}, {Field: "mode", Old: "644", New: "600"}}},
+		{Path: "/usr/bin/helper", Change: Added},
+		{Path: "/usr/bin/test", Change: Changed, Fields: []*FieldChange{{Field: "hash", Old: "b", New: "d"}}},
+		{Path: "/usr/share/test/old", Change: Removed},
+	}, d.Files)
+	if assert.Len(t, d.Dependencies, 3) {
+		assert.Equal(t, &DependencyChange{Name: "tool", Relationship: Recommends, Change: Added, New: "tool"}, d.Dependencies[0])
+		assert.Equal(t, &DependencyChange{Name: "libc", Relationship: Depends, Change: Changed, Old: "libc (>= v1.0.0)", New: "libc (>= v2.0.0)"}, d.Dependencies[1])
+		assert.Equal(t, Removed, d.Dependencies[2].Change)
+	}
+	if assert.Len(t, d.Actions, 3) {
+		assert.Equal(t, Install, d.Actions[0].Type)
+		assert.Equal(t, []*FieldChange{{Field: "after", Old: "[{action: {kind: command, command: [setup]}}]", New: "[{action: {kind: command, command: [setup, --force]}}]"}}, d.Actions[0].Fields)
+		assert.Equal(t, &ActionChange{Type: Remove, Change: Removed}, d.Actions[1])
+		assert.Equal(t, &ActionChange{Type: Purge, Change: Added}, d.Actions[2])
+	}
+	assert.Equal(t, []*TriggerChange{{Trigger: "ldconfig", Change: Removed}, {Trigger: "systemd-reload", Change: Added}}, d.Triggers)
+
+	text := d.String()
+	assert.Contains(t, text, "test v1.0.0 -> v2.0.0\n")
+	assert.Contains(t, text, "  ~ /etc/test.conf: user \"\" -> test, mode 644 -> 600\n")
+	assert.Contains(t, text, "  + /usr/bin/helper\n")
+	assert.Contains(t, text, "  ~ depends libc (>= v1.0.0) -> libc (>= v2.0.0)\n")
+	assert.Contains(t, text, "  - remove\n")
+	assert.Contains(t, text, "  + systemd-reload\n")
+
+	encoded, err := d.JSON()
+	if assert.NoError(t, err) {
+		var decoded map[string]interface{}
+		assert.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, "v2.0.0", decoded["newVersion"])
+		assert.Equal(t, "changed", decoded["files"].([]interface{})[0].(map[string]interface{})["change"])
+		assert.Equal(t, "recommends", decoded["dependencies"].([]interface{})[0].(map[string]interface{})["relation"])
+	}
+}
+
+func TestDiffDependencyRanges(t *testing.T) {
+	old := testManifest()
+	old.Dependencies = Dependencies{
+		testDependency("foo", Depends, RequiresGreaterThanEqual, "1.0.0"),
+		testDependency("foo", Depends, RequiresLessThan, "2.0.0"),
+		testDependency("bar", Depends, RequiresGreaterThanEqual, "1.0.0"),
+	}
+	new := testManifest()
+	new.Dependencies = Dependencies{
+		testDependency("foo", Depends, RequiresGreaterThanEqual, "1.0.0"),
+		testDependency("foo", Depends, RequiresLessThan, "3.0.0"),
+		testDependency("bar", Depends, RequiresLessThan, "2.0.0"),
+		testDependency("bar", Depends, RequiresGreaterThanEqual, "1.0.0"),
+	}
+
+	d := DiffManifests(old, new)
+	assert.Equal(t, []*DependencyChange{
+		{Name: "bar", Relationship: Depends, Change: Added, New: "bar (<< v2.0.0)"},
+		{Name: "foo", Relationship: Depends, Change: Changed, Old: "foo (<< v2.0.0)", New: "foo (<< v3.0.0)"},
+	}, d.Dependencies)
+
+	new.Dependencies = new.Dependencies[:1]
+	d = DiffManifests(old, new)
+	assert.Equal(t, []*DependencyChange{
+		{Name: "bar", Relationship: Depends, Change: Removed, Old: "bar (>= v1.0.0)"},
+		{Name: "foo", Relationship: Depends, Change: Removed, Old: "foo (<< v2.0.0)"},
+	}, d.Dependencies)
+}
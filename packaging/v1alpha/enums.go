@@ -130,9 +130,14 @@ func (r Required) MarshalText() ([]byte, error) {
 	return []byte(r.String()), nil
 }
 
-// UnmarshalText implements the text unmarshaller method
+// UnmarshalText implements the text unmarshaller method, an empty text is an unversioned requirement as marshalled
+// by MarshalText
 func (r *Required) UnmarshalText(text []byte) error {
 	name := string(text)
+	if name == "" {
+		*r = Required(0)
+		return nil
+	}
 	tmp, err := ParseRequired(name)
 	if err != nil {
 		return err
@@ -218,6 +223,8 @@ const (
 	Remove
 	// Purge specifies the purge action
 	Purge
+	// Triggered specifies the action of a trigger activated by other packages
+	Triggered
 )
 
 var actionTypeValues = helper.EnumeratorValues{
@@ -226,6 +233,7 @@ var actionTypeValues = helper.EnumeratorValues{
 	"upgrade":     Upgrade,
 	"remove":      Remove,
 	"purge":       Purge,
+	"trigger":     Triggered,
 }
 
 // String implements the Stringer interface.
@@ -257,3 +265,229 @@ func (t *ActionType) UnmarshalText(text []byte) error {
 	*t = tmp
 	return nil
 }
+
+// *** Compression ***
+
+// Compression specifies the compression codec of a package file
+type Compression int
+
+const (
+	_ Compression = iota
+	// NoCompression indicates that the file is stored uncompressed
+	NoCompression
+	// GzipCompression indicates that the file is compressed with gzip
+	GzipCompression
+	// ZstdCompression indicates that the file is compressed with zstd
+	ZstdCompression
+	// XZCompression indicates that the file is compressed with xz
+	XZCompression
+)
+
+var compressionValues = helper.EnumeratorValues{
+	"none": NoCompression,
+	"gzip": GzipCompression,
+	"zstd": ZstdCompression,
+	"xz":   XZCompression,
+}
+
+// String implements the Stringer interface.
+func (c Compression) String() string {
+	if c == Compression(0) {
+		c = NoCompression
+	}
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	name, _ := compressionName(c)
+	return name
+}
+
+// ParseCompression attempts to convert a string to a Compression
+func ParseCompression(name string) (Compression, error) {
+	if name == "" {
+		return NoCompression, nil
+	}
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	return parseCompressionName(name)
+}
+
+// MarshalText implements the text marshaller method
+func (c Compression) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (c *Compression) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseCompression(name)
+	if err != nil {
+		return err
+	}
+	*c = tmp
+	return nil
+}
+
+// *** VerificationProblemKind ***
+
+// VerificationProblemKind specifies the kind of problem found while verifying a package
+type VerificationProblemKind int
+
+const (
+	_ VerificationProblemKind = iota
+	// MissingFile indicates that a file listed in the manifest is not in the package
+	MissingFile
+	// UnlistedFile indicates that a file in the package is not listed in the manifest
+	UnlistedFile
+	// DuplicateFile indicates that a file is listed more than once
+	DuplicateFile
+	// SizeMismatch indicates that the size of a file does not match the index
+	SizeMismatch
+	// HashMismatch indicates that the SHA256 hash of a file does not match the manifest
+	HashMismatch
+	// UnreadableFile indicates that the contents of a file could not be read
+	UnreadableFile
+	// UnverifiedSignature indicates that the package signature could not be verified by the configured verifier
+	UnverifiedSignature
+)
+
+var verificationProblemKindValues = helper.EnumeratorValues{
+	"missing":    MissingFile,
+	"unlisted":   UnlistedFile,
+	"duplicate":  DuplicateFile,
+	"size":       SizeMismatch,
+	"hash":       HashMismatch,
+	"unreadable": UnreadableFile,
+	"unverified": UnverifiedSignature,
+}
+
+// String implements the Stringer interface.
+func (k VerificationProblemKind) String() string {
+	return verificationProblemKindValues.AsString(k)
+}
+
+// ParseVerificationProblemKind attempts to convert a string to a VerificationProblemKind
+func ParseVerificationProblemKind(name string) (VerificationProblemKind, error) {
+	x, err := verificationProblemKindValues.Parse(name)
+	if err != nil {
+		return VerificationProblemKind(0), err
+	}
+	return x.(VerificationProblemKind), nil
+}
+
+// MarshalText implements the text marshaller method
+func (k VerificationProblemKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (k *VerificationProblemKind) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseVerificationProblemKind(name)
+	if err != nil {
+		return err
+	}
+	*k = tmp
+	return nil
+}
+
+// *** ChangeType ***
+
+// ChangeType specifies how an element differs between two manifests
+type ChangeType int
+
+const (
+	_ ChangeType = iota
+	// Added indicates that the element only exists in the new manifest
+	Added
+	// Removed indicates that the element only exists in the old manifest
+	Removed
+	// Changed indicates that the element exists in both manifests but differs
+	Changed
+)
+
+var changeTypeValues = helper.EnumeratorValues{
+	"added":   Added,
+	"removed": Removed,
+	"changed": Changed,
+}
+
+// String implements the Stringer interface.
+func (c ChangeType) String() string {
+	return changeTypeValues.AsString(c)
+}
+
+// ParseChangeType attempts to convert a string to a ChangeType
+func ParseChangeType(name string) (ChangeType, error) {
+	x, err := changeTypeValues.Parse(name)
+	if err != nil {
+		return ChangeType(0), err
+	}
+	return x.(ChangeType), nil
+}
+
+// MarshalText implements the text marshaller method
+func (c ChangeType) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (c *ChangeType) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseChangeType(name)
+	if err != nil {
+		return err
+	}
+	*c = tmp
+	return nil
+}
+
+// *** DeltaMethod ***
+
+// DeltaMethod specifies how a delta package reconstructs a file
+type DeltaMethod int
+
+const (
+	_ DeltaMethod = iota
+	// DeltaCopy indicates that the file is copied unchanged from the base package
+	DeltaCopy
+	// DeltaFull indicates that the full contents of the file are stored in the delta package
+	DeltaFull
+	// DeltaPatch indicates that the file is reconstructed by applying a binary patch to a file of the base package
+	DeltaPatch
+)
+
+var deltaMethodValues = helper.EnumeratorValues{
+	"copy":  DeltaCopy,
+	"full":  DeltaFull,
+	"patch": DeltaPatch,
+}
+
+// String implements the Stringer interface.
+func (m DeltaMethod) String() string {
+	return deltaMethodValues.AsString(m)
+}
+
+// ParseDeltaMethod attempts to convert a string to a DeltaMethod
+func ParseDeltaMethod(name string) (DeltaMethod, error) {
+	x, err := deltaMethodValues.Parse(name)
+	if err != nil {
+		return DeltaMethod(0), err
+	}
+	return x.(DeltaMethod), nil
+}
+
+// MarshalText implements the text marshaller method
+func (m DeltaMethod) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (m *DeltaMethod) UnmarshalText(text []byte) error {
+	name := string(text)
+	tmp, err := ParseDeltaMethod(name)
+	if err != nil {
+		return err
+	}
+	*m = tmp
+	return nil
+}
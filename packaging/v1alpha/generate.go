@@ -0,0 +1,307 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileRule classifies the files matching it. A pattern ending in a slash matches all files below the directory, a
+// pattern without a slash is matched against the base name of files and any other pattern is matched against the
+// full path using path.Match. An empty pattern matches all files.
+type FileRule struct {
+	Pattern    string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`       // Pattern is the pattern matched against the file path
+	Executable bool     `yaml:"executable,omitempty" json:"executable,omitempty"` // Executable restricts the rule to files with an executable bit set
+	Type       FileType `yaml:"type" json:"type"`                                 // Type is the type of matching files
+}
+
+// FileRules is a list of file rules, the first matching rule classifies a file
+type FileRules []*FileRule
+
+// DefaultFileRules classifies files below /etc as configuration files and other files with an executable bit as
+// executables
+var DefaultFileRules = FileRules{
+	{Pattern: "/etc/", Type: ConfigurationFile},
+	{Executable: true, Type: ExecutableFile},
+}
+
+// Validate checks that the rule is valid
+func (r *FileRule) Validate() error {
+	if r.Type == FileType(0) {
+		return fmt.Errorf("file rule %q requires a type", r.Pattern)
+	}
+	if _, err := path.Match(r.Pattern, ""); err != nil {
+		return fmt.Errorf("invalid file rule pattern %q: %s", r.Pattern, err)
+	}
+	return nil
+}
+
+// Matches checks if the rule matches the file at p with the given unix permission bits
+func (r *FileRule) Matches(p string, mode int) bool {
+	if r.Executable && mode&0111 == 0 {
+		return false
+	}
+	switch {
+	case r.Pattern == "":
+		return true
+	case strings.HasSuffix(r.Pattern, "/"):
+		return strings.HasPrefix(p, r.Pattern)
+	case !strings.Contains(r.Pattern, "/"):
+		matched, _ := path.Match(r.Pattern, path.Base(p))
+		return matched
+	}
+	matched, _ := path.Match(r.Pattern, p)
+	return matched
+}
+
+// Validate checks that all rules are valid
+func (r FileRules) Validate() error {
+	for _, rule := range r {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Classify returns the type of the first rule matching the file, files not matched by any rule are data files
+func (r FileRules) Classify(p string, mode int) FileType {
+	for _, rule := range r {
+		if rule.Matches(p, mode) {
+			return rule.Type
+		}
+	}
+	return DataFile
+}
+
+// ManifestGenerator generates manifests listing the files of a staging directory or tar archive
+type ManifestGenerator struct {
+	rules         FileRules
+	user          string
+	group         string
+	deterministic bool
+}
+
+// NewManifestGenerator creates a new ManifestGenerator classifying files with rules, DefaultFileRules are used if
+// rules is nil
+func NewManifestGenerator(rules FileRules) (*ManifestGenerator, error) {
+	if rules == nil {
+		rules = DefaultFileRules
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &ManifestGenerator{rules: rules}, nil
+}
+
+// SetOwner sets the user and group owning all generated files instead of the owners found in the staging directory
+// or tar archive. An empty user or group is not overridden.
+func (g *ManifestGenerator) SetOwner(user, group string) {
+	g.user, g.group = user, group
+}
+
+// SetDeterministic sets whether manifests are generated reproducibly, independent of the machine and time they are
+// generated at. Deterministic manifests are owned by root unless SetOwner was called and their Created time is taken
+// from SOURCE_DATE_EPOCH if it is set, or from template otherwise.
+func (g *ManifestGenerator) SetDeterministic(deterministic bool) {
+	g.deterministic = deterministic
+}
+
+// manifest returns a copy of template listing files sorted by path
+func (g *ManifestGenerator) manifest(template *Manifest, files Files) (*Manifest, error) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	m := *template
+	m.Files = files
+	if g.deterministic {
+		epoch, found, err := SourceDateEpoch()
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			m.Created = epoch
+		} else if m.Created.IsZero() {
+			return nil, fmt.Errorf("deterministic manifests require a created time or %s", SourceDateEpochVariable)
+		}
+	} else if m.Created.IsZero() {
+		m.Created = time.Now().UTC()
+	}
+	return &m, nil
+}
+
+// file returns a file entry for the file at p
+func (g *ManifestGenerator) file(p string, mode int, user, group string, sum []byte) *File {
+	if g.deterministic {
+		user, group = "root", "root"
+	}
+	if g.user != "" {
+		user = g.user
+	}
+	if g.group != "" {
+		group = g.group
+	}
+	return &File{
+		Path:   p,
+		Type:   g.rules.Classify(p, mode),
+		SHA256: hex.EncodeToString(sum),
+		User:   user,
+		Group:  group,
+		Mode:   mode,
+	}
+}
+
+// unixMode returns the unix permission bits of mode
+func unixMode(mode os.FileMode) int {
+	m := int(mode.Perm())
+	for _, bit := range []struct {
+		mode os.FileMode
+		unix int
+	}{{os.ModeSetuid, 04000}, {os.ModeSetgid, 02000}, {os.ModeSticky, 01000}} {
+		if mode&bit.mode != 0 {
+			m |= bit.unix
+		}
+	}
+	return m
+}
+
+// hashReader returns the SHA256 hash of the contents of r
+func hashReader(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// GenerateFromDirectory returns a copy of template listing the regular files below the staging directory root,
+// which is the root of the file system the package is installed to. The Created time of template is set to the
+// current time if it is zero, unless SetDeterministic was called. Files are owned by the owners of the staged files
+// unless SetOwner was called. The paths of entries that cannot be packaged, such as symbolic links, are returned as
+// skipped.
+func (g *ManifestGenerator) GenerateFromDirectory(template *Manifest, root string) (*Manifest, []string, error) {
+	var files Files
+	var skipped []string
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		p := path.Clean("/" + filepath.ToSlash(rel))
+		switch {
+		case info.IsDir():
+			return nil
+		case !info.Mode().IsRegular():
+			skipped = append(skipped, p)
+			return nil
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		sum, err := hashReader(f)
+		if err != nil {
+			return err
+		}
+		user, group := fileOwner(info)
+		files = append(files, g.file(p, unixMode(info.Mode()), user, group, sum))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := g.manifest(template, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, skipped, nil
+}
+
+// tarOwner returns the owner of a tar entry, falling back to numeric ids if the entry has no owner names
+func tarOwner(h *tar.Header) (string, string) {
+	user, group := h.Uname, h.Gname
+	if user == "" {
+		user = strconv.Itoa(h.Uid)
+	}
+	if group == "" {
+		group = strconv.Itoa(h.Gid)
+	}
+	return user, group
+}
+
+// GenerateFromTar returns a copy of template listing the regular files and hard links of the uncompressed tar
+// archive read from r. Entry names are relative to the root of the file system the package is installed to. The
+// Created time of template is set to the current time if it is zero, unless SetDeterministic was called. Files are
+// owned by the owners recorded in the archive unless SetOwner was called. The paths of entries that cannot be
+// packaged, such as symbolic links, are returned as skipped.
+func (g *ManifestGenerator) GenerateFromTar(template *Manifest, r io.Reader) (*Manifest, []string, error) {
+	var files Files
+	var skipped []string
+	sums := map[string][]byte{}
+	t := tar.NewReader(r)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		p := path.Clean("/" + h.Name)
+		var sum []byte
+		switch h.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+			if sum, err = hashReader(t); err != nil {
+				return nil, nil, err
+			}
+		case tar.TypeLink:
+			found := false
+			if sum, found = sums[path.Clean("/"+h.Linkname)]; !found {
+				return nil, nil, fmt.Errorf("hard link %s to unknown file %s", p, h.Linkname)
+			}
+		default:
+			skipped = append(skipped, p)
+			continue
+		}
+		if _, found := sums[p]; found {
+			return nil, nil, fmt.Errorf("duplicate tar entry %s", p)
+		}
+		sums[p] = sum
+
+		user, group := tarOwner(h)
+		files = append(files, g.file(p, int(h.Mode&07777), user, group, sum))
+	}
+	m, err := g.manifest(template, files)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, skipped, nil
+}
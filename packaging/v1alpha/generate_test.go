@@ -0,0 +1,143 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRules(t *testing.T) {
+	rules := FileRules{
+		{Pattern: "*.conf", Type: ConfigurationFile},
+		{Pattern: "/usr/share/doc/", Type: OtherFile},
+		{Pattern: "/opt/*/bin/*", Executable: true, Type: ExecutableFile},
+	}
+	assert.NoError(t, rules.Validate())
+	assert.Equal(t, ConfigurationFile, rules.Classify("/usr/lib/foo/foo.conf", 0644))
+	assert.Equal(t, OtherFile, rules.Classify("/usr/share/doc/foo/README", 0644))
+	assert.Equal(t, ExecutableFile, rules.Classify("/opt/foo/bin/foo", 0755))
+	assert.Equal(t, DataFile, rules.Classify("/opt/foo/bin/foo", 0644))
+	assert.Equal(t, DataFile, rules.Classify("/opt/foo/lib/bin/foo", 0755))
+
+	assert.Equal(t, ConfigurationFile, DefaultFileRules.Classify("/etc/foo", 0755))
+	assert.Equal(t, ExecutableFile, DefaultFileRules.Classify("/usr/bin/foo", 0700))
+	assert.Equal(t, DataFile, DefaultFileRules.Classify("/etcetera/foo", 0644))
+
+	assert.Error(t, FileRules{{Pattern: "[", Type: DataFile}}.Validate())
+	assert.Error(t, FileRules{{Pattern: "*.conf"}}.Validate())
+	_, err := NewManifestGenerator(FileRules{{Pattern: "["}})
+	assert.Error(t, err)
+}
+
+func TestGenerateFromDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generate")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	for name, mode := range map[string]os.FileMode{"etc/foo.conf": 0640, "usr/bin/foo": 0755, "usr/share/foo/data": 0644} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), mode))
+		assert.NoError(t, os.Chmod(filepath.Join(dir, name), mode))
+	}
+	assert.NoError(t, os.Symlink("foo", filepath.Join(dir, "usr/bin/bar")))
+
+	g, err := NewManifestGenerator(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	g.SetOwner("root", "")
+	template := testManifest()
+	m, skipped, err := g.GenerateFromDirectory(template, dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"/usr/bin/bar"}, skipped)
+	assert.Equal(t, template.Name, m.Name)
+	assert.Equal(t, template.Created, m.Created)
+	assert.Empty(t, template.Files)
+	if assert.Len(t, m.Files, 3) {
+		assert.Equal(t, &File{Path: "/etc/foo.conf", Type: ConfigurationFile, SHA256: hashOf("etc/foo.conf"), User: "root", Group: m.Files[0].Group, Mode: 0640}, m.Files[0])
+		assert.NotEmpty(t, m.Files[0].Group)
+		assert.Equal(t, "/usr/bin/foo", m.Files[1].Path)
+		assert.Equal(t, ExecutableFile, m.Files[1].Type)
+		assert.Equal(t, DataFile, m.Files[2].Type)
+	}
+
+	_, _, err = g.GenerateFromDirectory(template, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestGenerateFromTar(t *testing.T) {
+	var archive bytes.Buffer
+	w := tar.NewWriter(&archive)
+	for _, entry := range []struct {
+		header   *tar.Header
+		contents string
+	}{
+		{&tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{&tar.Header{Name: "./etc/foo.conf", Typeflag: tar.TypeReg, Mode: 0600, Uname: "foo", Gname: "foo"}, "key=value\n"},
+		{&tar.Header{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Mode: 04755, Uid: 0, Gid: 50}, "#!/bin/sh\n"},
+		{&tar.Header{Name: "usr/bin/foo2", Typeflag: tar.TypeLink, Linkname: "usr/bin/foo", Mode: 04755}, ""},
+		{&tar.Header{Name: "usr/bin/bar", Typeflag: tar.TypeSymlink, Linkname: "foo"}, ""},
+	} {
+		entry.header.Size = int64(len(entry.contents))
+		assert.NoError(t, w.WriteHeader(entry.header))
+		w.Write([]byte(entry.contents))
+	}
+	assert.NoError(t, w.Close())
+
+	g, _ := NewManifestGenerator(nil)
+	m, skipped, err := g.GenerateFromTar(testManifest(), bytes.NewReader(archive.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"/usr/bin/bar"}, skipped)
+	assert.Equal(t, Files{
+		{Path: "/etc/foo.conf", Type: ConfigurationFile, SHA256: hashOf("key=value\n"), User: "foo", Group: "foo", Mode: 0600},
+		{Path: "/usr/bin/foo", Type: ExecutableFile, SHA256: hashOf("#!/bin/sh\n"), User: "0", Group: "50", Mode: 04755},
+		{Path: "/usr/bin/foo2", Type: ExecutableFile, SHA256: hashOf("#!/bin/sh\n"), User: "0", Group: "0", Mode: 04755},
+	}, m.Files)
+
+	_, _, err = g.GenerateFromTar(testManifest(), bytes.NewReader([]byte("not a tar archive")))
+	assert.Error(t, err)
+
+	defer setSourceDateEpoch("1600000000")()
+	g.SetDeterministic(true)
+	g.SetOwner("", "wheel")
+	m, _, err = g.GenerateFromTar(testManifest(), bytes.NewReader(archive.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1600000000, 0).UTC(), m.Created)
+		for _, f := range m.Files {
+			assert.Equal(t, "root", f.User)
+			assert.Equal(t, "wheel", f.Group)
+		}
+	}
+
+	os.Unsetenv(SourceDateEpochVariable)
+	_, _, err = g.GenerateFromTar(&Manifest{Name: "test"}, bytes.NewReader(archive.Bytes()))
+	assert.Error(t, err)
+	os.Setenv(SourceDateEpochVariable, "yesterday")
+	_, _, err = g.GenerateFromTar(testManifest(), bytes.NewReader(archive.Bytes()))
+	assert.Error(t, err)
+}
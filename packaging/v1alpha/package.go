@@ -0,0 +1,288 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+// A lime package is laid out as follows:
+//
+//	Magic           8 bytes  "LiMedPkg"
+//	ManifestLength  8 bytes  length of the manifest
+//	Manifest        yaml encoded Manifest
+//	IndexLength     8 bytes  length of the index
+//	Index           yaml encoded LimePackageFileIndex
+//	SignatureLength 8 bytes  length of the signature, zero if the package is not signed
+//	Signature       yaml encoded LimePackageSignature
+//	Files           the concatenated file contents
+//
+// All length fields are unsigned 64 bit big endian integers. The FileOffset of
+// a LimePackageFileIndexEntry is relative to the start of the Files section.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceDateEpochVariable is the environment variable setting the creation time of reproducible builds as seconds
+// since the unix epoch
+const SourceDateEpochVariable = "SOURCE_DATE_EPOCH"
+
+// SourceDateEpoch returns the creation time set by the SOURCE_DATE_EPOCH environment variable, found is false if the
+// variable is not set
+func SourceDateEpoch() (epoch time.Time, found bool, err error) {
+	value, found := os.LookupEnv(SourceDateEpochVariable)
+	if !found || value == "" {
+		return time.Time{}, false, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q", SourceDateEpochVariable, value)
+	}
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
+
+// encodeLength encodes a length field
+func encodeLength(length int64) (out [8]byte) {
+	binary.BigEndian.PutUint64(out[:], uint64(length))
+	return
+}
+
+// decodeLength decodes a length field
+func decodeLength(in [8]byte) uint64 {
+	return binary.BigEndian.Uint64(in[:])
+}
+
+// WriteTo writes the raw lime package to w
+func (p *RawLimePackage) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for _, part := range [][]byte{p.Magic[:], p.ManifestLength[:], p.Manifest, p.IndexLength[:], p.Index, p.SignatureLength[:], p.Signature, p.Files} {
+		n, err := w.Write(part)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// packageWriterFile is a file that has been added to a PackageWriter
+type packageWriterFile struct {
+	file     *File
+	contents []byte
+}
+
+// PackageWriter creates lime packages from a manifest and file contents
+type PackageWriter struct {
+	manifest           *Manifest
+	files              []*packageWriterFile
+	defaultCompression Compression
+	compression        map[FileType]Compression
+	signer             *PackageSigner
+	deterministic      bool
+}
+
+// NewPackageWriter creates a new PackageWriter for manifest
+func NewPackageWriter(manifest *Manifest) *PackageWriter {
+	return &PackageWriter{manifest: manifest, defaultCompression: NoCompression, compression: map[FileType]Compression{}}
+}
+
+// SetDefaultCompression sets the compression of files that do not have a compression set for their file type
+func (p *PackageWriter) SetDefaultCompression(compression Compression) {
+	p.defaultCompression = compression
+}
+
+// SetCompression sets the compression of files of the given file type
+func (p *PackageWriter) SetCompression(fileType FileType, compression Compression) {
+	p.compression[fileType] = compression
+}
+
+// SetSigner sets the signer used to embed a signature in the package
+func (p *PackageWriter) SetSigner(signer *PackageSigner) {
+	p.signer = signer
+}
+
+// SetDeterministic sets whether packages are built reproducibly, so that building the same manifest and file contents
+// twice yields identical packages. Deterministic packages store their files ordered by path, serialize the canonical
+// form of the manifest and take their Created time from SOURCE_DATE_EPOCH if it is set. Packages are only reproducible
+// if the codecs used are deterministic, as the built-in codecs are, and if they are unsigned or signed with a
+// deterministic signature algorithm such as SHA256WithRSA. All files of deterministic packages are owned by root, as
+// the owners of staged files depend on the machine building the package, while modes are written as listed in the
+// manifest.
+func (p *PackageWriter) SetDeterministic(deterministic bool) {
+	p.deterministic = deterministic
+}
+
+// compressionFor returns the compression used for file
+func (p *PackageWriter) compressionFor(file *File) Compression {
+	fileType := file.Type
+	if fileType == FileType(0) {
+		fileType = OtherFile
+	}
+	if compression, found := p.compression[fileType]; found {
+		return compression
+	}
+	return p.defaultCompression
+}
+
+// Manifest returns the manifest of the package being written
+func (p *PackageWriter) Manifest() *Manifest {
+	return p.manifest
+}
+
+// AddFile adds a file to the package, reading its contents from r. The SHA256 hash of the file is updated and the
+// file is appended to the manifest if it is not already listed.
+func (p *PackageWriter) AddFile(file *File, r io.Reader) error {
+	if p.find(file.Path) != nil {
+		return fmt.Errorf("duplicate package file %s", file.Path)
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(contents)
+	file.SHA256 = hex.EncodeToString(sum[:])
+
+	listed := false
+	for i, f := range p.manifest.Files {
+		if f.Path == file.Path {
+			p.manifest.Files[i] = file
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		p.manifest.Files = append(p.manifest.Files, file)
+	}
+
+	p.files = append(p.files, &packageWriterFile{file: file, contents: contents})
+	return nil
+}
+
+// Build computes the file index and returns the raw lime package
+func (p *PackageWriter) Build() (*RawLimePackage, error) {
+	for _, f := range p.manifest.Files {
+		if p.find(f.Path) == nil {
+			return nil, fmt.Errorf("missing contents for package file %s", f.Path)
+		}
+	}
+
+	packageFiles, packageManifest := p.files, p.manifest
+	if p.deterministic {
+		packageFiles = append([]*packageWriterFile{}, p.files...)
+		sort.Slice(packageFiles, func(i, j int) bool { return packageFiles[i].file.Path < packageFiles[j].file.Path })
+		packageManifest = p.manifest.Canonical()
+		for i, f := range packageManifest.Files {
+			file := *f
+			file.User, file.Group = "root", "root"
+			packageManifest.Files[i] = &file
+		}
+		epoch, found, err := SourceDateEpoch()
+		if err != nil {
+			return nil, err
+		} else if found {
+			packageManifest.Created = epoch
+		}
+	}
+
+	index := LimePackageFileIndex{Files: make([]LimePackageFileIndexEntry, 0, len(packageFiles))}
+	var files bytes.Buffer
+	for _, f := range packageFiles {
+		compression := p.compressionFor(f.file)
+		codec, err := LookupCodec(compression)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := files.Len()
+		w, err := codec.NewWriter(&files)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(f.contents); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+
+		index.Files = append(index.Files, LimePackageFileIndexEntry{
+			Path:           f.file.Path,
+			Size:           int64(len(f.contents)),
+			CompressedSize: int64(files.Len() - offset),
+			Compression:    compression,
+			FileOffset:     int64(offset),
+		})
+	}
+
+	manifest, err := yaml.Marshal(packageManifest)
+	if err != nil {
+		return nil, err
+	}
+	encodedIndex, err := yaml.Marshal(&index)
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	if p.signer != nil {
+		s, err := p.signer.Sign(manifest, encodedIndex)
+		if err != nil {
+			return nil, err
+		}
+		if signature, err = yaml.Marshal(s); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := &RawLimePackage{
+		ManifestLength:  encodeLength(int64(len(manifest))),
+		Manifest:        manifest,
+		IndexLength:     encodeLength(int64(len(encodedIndex))),
+		Index:           encodedIndex,
+		SignatureLength: encodeLength(int64(len(signature))),
+		Signature:       signature,
+		Files:           files.Bytes(),
+	}
+	copy(raw.Magic[:], LimePackageMagic)
+	return raw, nil
+}
+
+// WriteTo builds the lime package and writes it to w
+func (p *PackageWriter) WriteTo(w io.Writer) (int64, error) {
+	raw, err := p.Build()
+	if err != nil {
+		return 0, err
+	}
+	return raw.WriteTo(w)
+}
+
+func (p *PackageWriter) find(path string) *packageWriterFile {
+	for _, f := range p.files {
+		if f.file.Path == path {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func testManifest() *Manifest {
+	manifest := &Manifest{}
+	manifest.Name = "test"
+	manifest.Version = common.Version{Major: 1}
+	manifest.Created = time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	manifest.Metadata.Architectures = common.Architectures{common.AMD64}
+	return manifest
+}
+
+func hashOf(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+// setSourceDateEpoch sets SOURCE_DATE_EPOCH and returns a function restoring its previous value
+func setSourceDateEpoch(value string) func() {
+	previous, found := os.LookupEnv(SourceDateEpochVariable)
+	os.Setenv(SourceDateEpochVariable, value)
+	return func() {
+		if found {
+			os.Setenv(SourceDateEpochVariable, previous)
+		} else {
+			os.Unsetenv(SourceDateEpochVariable)
+		}
+	}
+}
+
+func TestPackageWriter(t *testing.T) {
+	manifest := testManifest()
+	manifest.Files = Files{&File{Path: "/etc/test.conf", Type: ConfigurationFile}}
+
+	w := NewPackageWriter(manifest)
+	assert.NoError(t, w.AddFile(&File{Path: "/etc/test.conf", Type: ConfigurationFile}, strings.NewReader("key=value\n")))
+	assert.NoError(t, w.AddFile(&File{Path: "/usr/bin/test", Type: ExecutableFile, Mode: 0755}, strings.NewReader("#!/bin/sh\n")))
+	assert.Error(t, w.AddFile(&File{Path: "/usr/bin/test"}, strings.NewReader("")))
+
+	var out bytes.Buffer
+	n, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(out.Len()), n)
+
+	raw := out.Bytes()
+	assert.Equal(t, LimePackageMagic, string(raw[:8]))
+	manifestLength := binary.BigEndian.Uint64(raw[8:16])
+	var m Manifest
+	if assert.NoError(t, yaml.Unmarshal(raw[16:16+manifestLength], &m)) {
+		assert.Len(t, m.Files, 2)
+		assert.Equal(t, ConfigurationFile, m.Files[0].Type)
+		assert.Equal(t, hashOf("key=value\n"), m.Files[0].SHA256)
+	}
+
+	offset := 16 + manifestLength
+	indexLength := binary.BigEndian.Uint64(raw[offset : offset+8])
+	var index LimePackageFileIndex
+	if assert.NoError(t, yaml.Unmarshal(raw[offset+8:offset+8+indexLength], &index)) && assert.Len(t, index.Files, 2) {
+		offset += 8 + indexLength
+		assert.Equal(t, uint64(0), binary.BigEndian.Uint64(raw[offset:offset+8]))
+		files := raw[offset+8:]
+		entry := index.Files[1]
+		assert.Equal(t, "/usr/bin/test", entry.Path)
+		assert.Equal(t, "#!/bin/sh\n", string(files[entry.FileOffset:entry.FileOffset+entry.Size]))
+	}
+
+	manifest = testManifest()
+	manifest.Files = Files{&File{Path: "/missing"}}
+	_, err = NewPackageWriter(manifest).Build()
+	assert.Error(t, err)
+}
+
+func TestDeterministicPackageWriter(t *testing.T) {
+	defer setSourceDateEpoch("1600000000")()
+
+	contents := map[string]string{"/etc/test.conf": "key=value\n", "/usr/bin/test": "#!/bin/sh\n", "/usr/share/test/data": strings.Repeat("data", 1000)}
+	build := func(paths []string, created time.Time, deterministic bool) []byte {
+		manifest := testManifest()
+		manifest.Created = created
+		w := NewPackageWriter(manifest)
+		w.SetDeterministic(deterministic)
+		w.SetDefaultCompression(ZstdCompression)
+		w.SetCompression(ConfigurationFile, GzipCompression)
+		w.SetCompression(ExecutableFile, XZCompression)
+		for _, p := range paths {
+			fileType := DataFile
+			if strings.HasPrefix(p, "/etc/") {
+				fileType = ConfigurationFile
+			} else if strings.HasPrefix(p, "/usr/bin/") {
+				fileType = ExecutableFile
+			}
+			assert.NoError(t, w.AddFile(&File{Path: p, Type: fileType}, strings.NewReader(contents[p])))
+		}
+		var out bytes.Buffer
+		_, err := w.WriteTo(&out)
+		assert.NoError(t, err)
+		return out.Bytes()
+	}
+
+	paths := []string{"/usr/share/test/data", "/etc/test.conf", "/usr/bin/test"}
+	reversed := []string{paths[2], paths[1], paths[0]}
+	local := time.Date(2020, 6, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	first := build(paths, time.Now(), true)
+	assert.Equal(t, first, build(reversed, local, true))
+	assert.NotEqual(t, build(paths, local, false), build(reversed, local, false))
+
+	r, err := OpenPackage(bytes.NewReader(first), int64(len(first)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Unix(1600000000, 0).UTC(), r.Manifest().Created)
+		assert.Equal(t, []string{"/etc/test.conf", "/usr/bin/test", "/usr/share/test/data"}, []string{r.Manifest().Files[0].Path, r.Manifest().Files[1].Path, r.Manifest().Files[2].Path})
+	}
+
+	os.Unsetenv(SourceDateEpochVariable)
+	assert.Equal(t, build(paths, local, true), build(reversed, local.UTC(), true))
+
+	owned := func(user, group string) []byte {
+		manifest := testManifest()
+		w := NewPackageWriter(manifest)
+		w.SetDeterministic(true)
+		for _, p := range paths {
+			assert.NoError(t, w.AddFile(&File{Path: p, User: user, Group: group, Mode: 0644}, strings.NewReader(contents[p])))
+		}
+		raw, err := w.Build()
+		assert.NoError(t, err)
+		var out bytes.Buffer
+		_, err = raw.WriteTo(&out)
+		assert.NoError(t, err)
+		assert.Equal(t, user, manifest.Files[0].User)
+		return out.Bytes()
+	}
+	root := owned("", "")
+	assert.Equal(t, root, owned("builder", "staff"))
+	assert.Equal(t, root, owned("1000", "1000"))
+	r, err = OpenPackage(bytes.NewReader(root), int64(len(root)))
+	if assert.NoError(t, err) {
+		for _, file := range r.Manifest().Files {
+			assert.Equal(t, "root", file.User)
+			assert.Equal(t, "root", file.Group)
+		}
+	}
+
+	os.Setenv(SourceDateEpochVariable, "-1")
+	w := NewPackageWriter(testManifest())
+	w.SetDeterministic(true)
+	_, err = w.Build()
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+// A binary patch reconstructs a new file from an old one. It starts with the length of the new file followed by a
+// sequence of operations:
+//
+//	'C' offset length  copies length bytes starting at offset of the old file
+//	'I' length data    inserts length bytes of data
+//
+// All numbers are unsigned varints. Patches are computed by matching blocks of the old file using a rolling
+// checksum, as done by rsync.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// patchBlockSize is the size of the blocks of the old file that are matched in the new file
+	patchBlockSize = 64
+	patchCopy      = 'C'
+	patchInsert    = 'I'
+)
+
+// rollingChecksum is the weak rolling checksum of a block
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingChecksum(block []byte) *rollingChecksum {
+	c := &rollingChecksum{n: uint32(len(block))}
+	for i, x := range block {
+		c.a += uint32(x)
+		c.b += (c.n - uint32(i)) * uint32(x)
+	}
+	return c
+}
+
+// roll removes out from the start of the block and appends in to its end
+func (c *rollingChecksum) roll(out, in byte) {
+	c.a = c.a - uint32(out) + uint32(in)
+	c.b = c.b - c.n*uint32(out) + c.a
+}
+
+func (c *rollingChecksum) sum() uint32 {
+	return c.a&0xffff | c.b<<16
+}
+
+// patchWriter encodes patch operations
+type patchWriter struct {
+	bytes.Buffer
+}
+
+func (w *patchWriter) uvarint(x int) {
+	var encoded [binary.MaxVarintLen64]byte
+	w.Write(encoded[:binary.PutUvarint(encoded[:], uint64(x))])
+}
+
+func (w *patchWriter) insert(data []byte) {
+	if len(data) > 0 {
+		w.WriteByte(patchInsert)
+		w.uvarint(len(data))
+		w.Write(data)
+	}
+}
+
+func (w *patchWriter) copy(offset, length int) {
+	w.WriteByte(patchCopy)
+	w.uvarint(offset)
+	w.uvarint(length)
+}
+
+// diffBytes computes a binary patch that reconstructs new from old
+func diffBytes(old, new []byte) []byte {
+	blocks := map[uint32][]int{}
+	for offset := 0; offset+patchBlockSize <= len(old); offset += patchBlockSize {
+		sum := newRollingChecksum(old[offset : offset+patchBlockSize]).sum()
+		blocks[sum] = append(blocks[sum], offset)
+	}
+
+	w := &patchWriter{}
+	w.uvarint(len(new))
+	literal, pos := 0, 0
+	var checksum *rollingChecksum
+	for pos+patchBlockSize <= len(new) {
+		if checksum == nil {
+			checksum = newRollingChecksum(new[pos : pos+patchBlockSize])
+		}
+
+		match := -1
+		for _, offset := range blocks[checksum.sum()] {
+			if bytes.Equal(old[offset:offset+patchBlockSize], new[pos:pos+patchBlockSize]) {
+				match = offset
+				break
+			}
+		}
+		if match < 0 {
+			if pos+patchBlockSize < len(new) {
+				checksum.roll(new[pos], new[pos+patchBlockSize])
+			}
+			pos++
+			continue
+		}
+
+		length := patchBlockSize
+		for match+length < len(old) && pos+length < len(new) && old[match+length] == new[pos+length] {
+			length++
+		}
+		w.insert(new[literal:pos])
+		w.copy(match, length)
+		pos += length
+		literal, checksum = pos, nil
+	}
+	w.insert(new[literal:])
+	return w.Bytes()
+}
+
+// patchBytes applies a binary patch to old
+func patchBytes(old, patch []byte) ([]byte, error) {
+	r := bytes.NewReader(patch)
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch length")
+	}
+
+	capacity := uint64(len(old) + len(patch))
+	if length < capacity {
+		capacity = length
+	}
+	out := make([]byte, 0, capacity)
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch op {
+		case patchCopy:
+			offset, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid patch copy: %s", err)
+			}
+			n, err := binary.ReadUvarint(r)
+			if err != nil || offset > uint64(len(old)) || n > uint64(len(old))-offset {
+				return nil, fmt.Errorf("invalid patch copy")
+			}
+			out = append(out, old[offset:offset+n]...)
+		case patchInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(r.Len()) {
+				return nil, fmt.Errorf("invalid patch insert")
+			}
+			data := make([]byte, n)
+			io.ReadFull(r, data)
+			out = append(out, data...)
+		default:
+			return nil, fmt.Errorf("invalid patch operation %q", op)
+		}
+		if uint64(len(out)) > length {
+			return nil, fmt.Errorf("patch exceeds length %d", length)
+		}
+	}
+	if uint64(len(out)) != length {
+		return nil, fmt.Errorf("patch produced %d bytes instead of %d", len(out), length)
+	}
+	return out, nil
+}
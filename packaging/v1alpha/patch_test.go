@@ -0,0 +1,52 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffBytes(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	old := make([]byte, 16*1024)
+	random.Read(old)
+
+	changed := append([]byte{}, old[:5000]...)
+	changed = append(changed, []byte("inserted data")...)
+	changed = append(changed, old[5100:12000]...)
+	changed = append(changed, old[:300]...)
+	changed = append(changed, old[14000:]...)
+
+	for _, new := range [][]byte{changed, old, {}, []byte("short"), old[:patchBlockSize-1]} {
+		patch := diffBytes(old, new)
+		patched, err := patchBytes(old, patch)
+		if assert.NoError(t, err) {
+			assert.True(t, bytes.Equal(new, patched))
+		}
+	}
+	assert.Less(t, len(diffBytes(old, changed)), 256)
+
+	patch := diffBytes(old, changed)
+	_, err := patchBytes(old[:1000], patch)
+	assert.Error(t, err)
+	_, err = patchBytes(old, patch[:len(patch)-1])
+	assert.Error(t, err)
+	_, err = patchBytes(old, []byte{1, 'X'})
+	assert.Error(t, err)
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxPackageSectionLength is the maximum length of the manifest and index sections
+	maxPackageSectionLength = 64 << 20
+)
+
+// InvalidPackageError is an error that occurs when a lime package is malformed
+type InvalidPackageError struct {
+	limejuiceerrors.LimeJuiceError
+}
+
+func newInvalidPackageError(format string, a ...interface{}) error {
+	err := &InvalidPackageError{}
+	err.Message = fmt.Sprintf(format, a...)
+	return err
+}
+
+// packageHeader is the decoded manifest and index of a lime package
+type packageHeader struct {
+	rawManifest  []byte
+	rawIndex     []byte
+	rawSignature []byte
+	manifest     *Manifest
+	index        *LimePackageFileIndex
+	signature    *LimePackageSignature
+	verifier     *PackageVerifier
+	verified     bool
+	insecure     bool
+}
+
+// length returns the number of bytes preceding the Files section
+func (h *packageHeader) length() int64 {
+	return int64(len(LimePackageMagic) + 3*8 + len(h.rawManifest) + len(h.rawIndex) + len(h.rawSignature))
+}
+
+// verify verifies a signature of the package, the package is verified if the signature is verified by the configured
+// verifier
+func (h *packageHeader) verify(verifier *PackageVerifier, signature *LimePackageSignature) error {
+	if signature == nil {
+		return newSignatureError("package is not signed")
+	}
+	if err := verifier.Verify(h.rawManifest, h.rawIndex, signature); err != nil {
+		return err
+	}
+	if verifier == h.verifier {
+		h.verified = true
+	}
+	return nil
+}
+
+// checkVerified checks that the package signature has been verified if a verifier is configured. The embedded
+// signature is verified if no signature has been verified yet.
+func (h *packageHeader) checkVerified() error {
+	if h.verifier == nil || h.verified || h.insecure {
+		return nil
+	}
+	return h.verify(h.verifier, h.signature)
+}
+
+// readSection reads a length prefixed section
+func readSection(r io.Reader, name string) ([]byte, error) {
+	var encoded [8]byte
+	if _, err := io.ReadFull(r, encoded[:]); err != nil {
+		return nil, newInvalidPackageError("cannot read %s length: %s", name, err)
+	}
+	length := decodeLength(encoded)
+	if length > maxPackageSectionLength {
+		return nil, newInvalidPackageError("%s length %d exceeds maximum of %d", name, length, maxPackageSectionLength)
+	}
+	section := make([]byte, length)
+	if _, err := io.ReadFull(r, section); err != nil {
+		return nil, newInvalidPackageError("cannot read %s: %s", name, err)
+	}
+	return section, nil
+}
+
+// readPackageHeader reads and decodes everything preceding the Files section
+func readPackageHeader(r io.Reader) (*packageHeader, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != LimePackageMagic {
+		return nil, newInvalidPackageError("not a lime package")
+	}
+
+	var err error
+	h := &packageHeader{manifest: &Manifest{}, index: &LimePackageFileIndex{}, verifier: DefaultVerifier()}
+	if h.rawManifest, err = readSection(r, "manifest"); err != nil {
+		return nil, err
+	}
+	if h.rawIndex, err = readSection(r, "index"); err != nil {
+		return nil, err
+	}
+	if h.rawSignature, err = readSection(r, "signature"); err != nil {
+		return nil, err
+	}
+	if len(h.rawSignature) > 0 {
+		h.signature = &LimePackageSignature{}
+		if err = yaml.Unmarshal(h.rawSignature, h.signature); err != nil {
+			return nil, newInvalidPackageError("cannot decode signature: %s", err)
+		}
+	}
+	if err = yaml.Unmarshal(h.rawManifest, h.manifest); err != nil {
+		return nil, newInvalidPackageError("cannot decode manifest: %s", err)
+	}
+	if err = yaml.Unmarshal(h.rawIndex, h.index); err != nil {
+		return nil, newInvalidPackageError("cannot decode index: %s", err)
+	}
+
+	for _, entry := range h.index.Files {
+		if entry.Size < 0 || entry.CompressedSize < 0 || entry.FileOffset < 0 {
+			return nil, newInvalidPackageError("invalid index entry for %s", entry.Path)
+		}
+	}
+	return h, nil
+}
+
+// PackageReader provides random access to the files of a lime package
+type PackageReader struct {
+	r      io.ReaderAt
+	size   int64
+	header *packageHeader
+}
+
+// OpenPackage opens a lime package of size bytes that is read from r. Only the manifest and index are read, file
+// contents are read on demand.
+func OpenPackage(r io.ReaderAt, size int64) (*PackageReader, error) {
+	header, err := readPackageHeader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	dataLength := size - header.length()
+	for _, entry := range header.index.Files {
+		if entry.FileOffset > dataLength || entry.CompressedSize > dataLength-entry.FileOffset {
+			return nil, newInvalidPackageError("index entry for %s exceeds package size", entry.Path)
+		}
+	}
+
+	return &PackageReader{r: r, size: size, header: header}, nil
+}
+
+// Manifest returns the package manifest
+func (p *PackageReader) Manifest() *Manifest {
+	return p.header.manifest
+}
+
+// Index returns the package file index
+func (p *PackageReader) Index() *LimePackageFileIndex {
+	return p.header.index
+}
+
+// Signature returns the embedded package signature or nil if the package is not signed
+func (p *PackageReader) Signature() *LimePackageSignature {
+	return p.header.signature
+}
+
+// SetVerifier sets the verifier that must verify the package signature before any file is extracted, replacing the
+// default verifier. Open verifies the embedded signature unless VerifyDetached already succeeded with verifier.
+func (p *PackageReader) SetVerifier(verifier *PackageVerifier) {
+	p.header.verifier = verifier
+	p.header.verified = false
+}
+
+// InsecureSkipVerify allows files to be extracted without verifying the package signature even if a verifier is
+// configured. InsecureSkipVerify should only be used for packages that are known to be trusted.
+func (p *PackageReader) InsecureSkipVerify() {
+	p.header.insecure = true
+}
+
+// Verify verifies the embedded package signature. Verify should be called before any file is extracted.
+func (p *PackageReader) Verify(verifier *PackageVerifier) error {
+	return p.header.verify(verifier, p.header.signature)
+}
+
+// VerifyDetached verifies a detached package signature
+func (p *PackageReader) VerifyDetached(verifier *PackageVerifier, signature *LimePackageSignature) error {
+	return p.header.verify(verifier, signature)
+}
+
+// Lookup returns the index entry for the file at path
+func (p *PackageReader) Lookup(path string) (*LimePackageFileIndexEntry, bool) {
+	for i := range p.header.index.Files {
+		if p.header.index.Files[i].Path == path {
+			return &p.header.index.Files[i], true
+		}
+	}
+	return nil, false
+}
+
+// Open opens the file at path for reading. The file is decompressed and verified against the size and SHA256 hash
+// listed in the manifest as it is read.
+func (p *PackageReader) Open(path string) (io.ReadCloser, error) {
+	if err := p.header.checkVerified(); err != nil {
+		return nil, err
+	}
+	entry, found := p.Lookup(path)
+	if !found {
+		return nil, fmt.Errorf("package file %s not found", path)
+	}
+	file := p.header.manifest.Files.Find(path)
+	if file == nil {
+		return nil, newInvalidPackageError("file %s is not listed in the manifest", path)
+	}
+
+	r, err := p.openEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{newVerifyingReader(r, path, entry.Size, file.SHA256), r}, nil
+}
+
+// openEntry opens the decompressed contents of an index entry without verification
+func (p *PackageReader) openEntry(entry *LimePackageFileIndexEntry) (io.ReadCloser, error) {
+	codec, err := LookupCodec(entry.Compression)
+	if err != nil {
+		return nil, err
+	}
+	return codec.NewReader(io.NewSectionReader(p.r, p.header.length()+entry.FileOffset, entry.CompressedSize))
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPackage(t *testing.T, files map[string]string) []byte {
+	w := NewPackageWriter(testManifest())
+	for path, contents := range files {
+		if !assert.NoError(t, w.AddFile(&File{Path: path, Type: DataFile}, strings.NewReader(contents))) {
+			t.FailNow()
+		}
+	}
+	var out bytes.Buffer
+	if _, err := w.WriteTo(&out); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return out.Bytes()
+}
+
+func TestOpenPackage(t *testing.T) {
+	raw := testPackage(t, map[string]string{"/a": "contents of a", "/b": "contents of b"})
+
+	p, err := OpenPackage(bytes.NewReader(raw), int64(len(raw)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, PackageName("test"), p.Manifest().Name)
+	assert.Len(t, p.Index().Files, 2)
+
+	for _, path := range []string{"/a", "/b"} {
+		r, err := p.Open(path)
+		if assert.NoError(t, err) {
+			contents, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, "contents of "+path[1:], string(contents))
+			assert.NoError(t, r.Close())
+		}
+	}
+
+	_, err = p.Open("/c")
+	assert.Error(t, err)
+
+	_, err = OpenPackage(bytes.NewReader(raw), int64(len(raw)-1))
+	assert.IsType(t, &InvalidPackageError{}, err)
+	_, err = OpenPackage(bytes.NewReader(raw[:20]), 20)
+	assert.IsType(t, &InvalidPackageError{}, err)
+	_, err = OpenPackage(strings.NewReader("NotAPackage"), 11)
+	assert.IsType(t, &InvalidPackageError{}, err)
+}
@@ -0,0 +1,229 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+)
+
+// UnsatisfiableError is an error that occurs when a consistent install set cannot be found
+type UnsatisfiableError struct {
+	limejuiceerrors.LimeJuiceError
+	Chain   []string // Chain is the chain of requirements leading to the unsatisfiable dependency
+	Reasons []string // Reasons are the reasons each candidate was rejected
+}
+
+func newUnsatisfiableError(chain []string, reasons ...string) *UnsatisfiableError {
+	err := &UnsatisfiableError{Chain: chain, Reasons: reasons}
+	var b strings.Builder
+	b.WriteString("unsatisfiable dependencies:")
+	for _, c := range chain {
+		fmt.Fprintf(&b, "\n  %s", c)
+	}
+	for _, r := range reasons {
+		fmt.Fprintf(&b, "\n    %s", r)
+	}
+	err.Message = b.String()
+	return err
+}
+
+// describe returns the human readable name and version of a manifest
+func describe(m *Manifest) string {
+	return fmt.Sprintf("%s %s", m.Name, m.Version.String())
+}
+
+// obligation is a dependency that must be satisfied by the install set
+type obligation struct {
+	dep   *Dependency
+	chain []string
+}
+
+// Resolver computes consistent install sets from a set of available packages. Depends and Predepends
+// relationships must be satisfied, Conflicts and Breaks relationships must not be and Provides relationships
+// satisfy dependencies on virtual packages. Suggests, Recommends and Replaces do not affect resolution.
+type Resolver struct {
+	available []*Manifest
+}
+
+// NewResolver creates a new Resolver for the available packages
+func NewResolver(available ...*Manifest) *Resolver {
+	return &Resolver{available: available}
+}
+
+// Resolve computes a consistent install set containing the requested packages and their dependencies. Packages are
+// returned in installation order, dependencies before the packages that depend on them.
+func (r *Resolver) Resolve(requested ...PackageName) ([]*Manifest, error) {
+	pending := make([]obligation, 0, len(requested))
+	for _, name := range requested {
+		pending = append(pending, obligation{
+			dep:   &Dependency{Name: name, Relationship: Depends},
+			chain: []string{fmt.Sprintf("requested %s", name)},
+		})
+	}
+
+	selected := map[PackageName]*Manifest{}
+	if err := r.resolve(selected, pending); err != nil {
+		return nil, err
+	}
+	return installOrder(selected), nil
+}
+
+func (r *Resolver) resolve(selected map[PackageName]*Manifest, pending []obligation) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	ob, rest := pending[0], pending[1:]
+
+	for _, m := range selected {
+		if providesDependency(m, ob.dep) {
+			return r.resolve(selected, rest)
+		}
+	}
+
+	candidates := r.candidates(ob.dep)
+	if len(candidates) == 0 {
+		return newUnsatisfiableError(ob.chain, fmt.Sprintf("no available package satisfies %s", ob.dep.String()))
+	}
+
+	var reasons []string
+	var deeper error
+	for _, c := range candidates {
+		if existing, found := selected[c.Name]; found {
+			reasons = append(reasons, fmt.Sprintf("%s cannot be installed alongside %s", describe(c), describe(existing)))
+			continue
+		}
+		if reason := conflicting(selected, c); reason != "" {
+			reasons = append(reasons, reason)
+			continue
+		}
+
+		selected[c.Name] = c
+		next := append([]obligation{}, rest...)
+		for _, dep := range c.Dependencies {
+			if dep.Relationship == Depends || dep.Relationship == Predepends {
+				chain := append(append([]string{}, ob.chain...), fmt.Sprintf("%s %s %s", describe(c), dep.Relationship, dep.String()))
+				next = append(next, obligation{dep: dep, chain: chain})
+			}
+		}
+		err := r.resolve(selected, next)
+		if err == nil {
+			return nil
+		}
+		delete(selected, c.Name)
+		if deeper == nil {
+			deeper = err
+		}
+	}
+
+	if deeper != nil {
+		return deeper
+	}
+	return newUnsatisfiableError(ob.chain, reasons...)
+}
+
+// candidates returns the available packages that provide dep, preferring packages with a matching name and higher
+// versions
+func (r *Resolver) candidates(dep *Dependency) []*Manifest {
+	var candidates []*Manifest
+	for _, m := range r.available {
+		if providesDependency(m, dep) {
+			candidates = append(candidates, m)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.Name == dep.Name) != (b.Name == dep.Name) {
+			return a.Name == dep.Name
+		}
+		if c := a.Version.Compare(&b.Version); c != 0 {
+			return c > 0
+		}
+		return a.Name < b.Name
+	})
+	return candidates
+}
+
+// providesDependency checks if m satisfies dep either directly or through a Provides relationship
+func providesDependency(m *Manifest, dep *Dependency) bool {
+	if m.Name == dep.Name {
+		return Satisfies(*dep, m.Version)
+	}
+	for _, p := range m.Dependencies {
+		if p.Relationship != Provides || p.Name != dep.Name {
+			continue
+		}
+		if dep.Requires == Required(0) {
+			return true
+		}
+		if p.Requires == RequiresEqual && Satisfies(*dep, p.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicting returns a description of the conflict between candidate and the selected packages or an empty
+// string if there is none
+func conflicting(selected map[PackageName]*Manifest, candidate *Manifest) string {
+	for _, m := range selected {
+		for _, pair := range [][2]*Manifest{{candidate, m}, {m, candidate}} {
+			for _, dep := range pair[0].Dependencies {
+				if (dep.Relationship == Conflicts || dep.Relationship == Breaks) && providesDependency(pair[1], dep) {
+					return fmt.Sprintf("%s %s %s", describe(pair[0]), dep.Relationship, describe(pair[1]))
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// installOrder orders packages so that dependencies are installed before the packages that depend on them
+func installOrder(selected map[PackageName]*Manifest) []*Manifest {
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	visited := map[PackageName]bool{}
+	ordered := make([]*Manifest, 0, len(selected))
+	var visit func(m *Manifest)
+	visit = func(m *Manifest) {
+		if visited[m.Name] {
+			return
+		}
+		visited[m.Name] = true
+		for _, dep := range m.Dependencies {
+			if dep.Relationship != Depends && dep.Relationship != Predepends {
+				continue
+			}
+			for _, name := range names {
+				if providesDependency(selected[PackageName(name)], dep) {
+					visit(selected[PackageName(name)])
+					break
+				}
+			}
+		}
+		ordered = append(ordered, m)
+	}
+	for _, name := range names {
+		visit(selected[PackageName(name)])
+	}
+	return ordered
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPackageManifest(name string, version string, deps ...*Dependency) *Manifest {
+	v, err := common.ParseVersion(version)
+	if err != nil {
+		panic(err)
+	}
+	return &Manifest{Name: PackageName(name), Version: *v, Dependencies: deps}
+}
+
+func testDependency(name string, relationship Relationship, requires Required, version string) *Dependency {
+	dep := &Dependency{Name: PackageName(name), Relationship: relationship, Requires: requires}
+	if version != "" {
+		v, err := common.ParseVersion(version)
+		if err != nil {
+			panic(err)
+		}
+		dep.Version = *v
+	}
+	return dep
+}
+
+func names(manifests []*Manifest) []string {
+	out := make([]string, 0, len(manifests))
+	for _, m := range manifests {
+		out = append(out, describe(m))
+	}
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	available := []*Manifest{
+		testPackageManifest("app", "1.0.0",
+			testDependency("lib", Depends, RequiresGreaterThanEqual, "2.0.0"),
+			testDependency("mta", Depends, Required(0), ""),
+			testDependency("docs", Suggests, Required(0), "")),
+		testPackageManifest("lib", "1.0.0"),
+		testPackageManifest("lib", "2.0.0", testDependency("base", Predepends, Required(0), "")),
+		testPackageManifest("lib", "2.1.0-rc1", testDependency("base", Predepends, Required(0), "")),
+		testPackageManifest("lib", "3.0.0", testDependency("base", Predepends, RequiresGreaterThan, "5.0.0")),
+		testPackageManifest("base", "1.0.0"),
+		testPackageManifest("postfix", "3.0.0", testDependency("mta", Provides, Required(0), "")),
+	}
+
+	installed, err := NewResolver(available...).Resolve("app")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"base v1.0.0", "lib v2.1.0-rc1", "postfix v3.0.0", "app v1.0.0"}, names(installed))
+	}
+
+	available = append(available, testPackageManifest("base", "1.0.1", testDependency("postfix", Conflicts, Required(0), "")))
+	installed, err = NewResolver(available...).Resolve("app")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"base v1.0.0", "lib v2.1.0-rc1", "postfix v3.0.0", "app v1.0.0"}, names(installed))
+	}
+
+	_, err = NewResolver(available...).Resolve("missing")
+	assert.IsType(t, &UnsatisfiableError{}, err)
+
+	_, err = NewResolver(available...).Resolve("app", "exim")
+	assert.Error(t, err)
+
+	available = []*Manifest{
+		testPackageManifest("app", "1.0.0", testDependency("lib", Depends, RequiresGreaterThanEqual, "2.0.0")),
+		testPackageManifest("lib", "2.0.0", testDependency("base", Depends, RequiresEqual, "1.0.0")),
+		testPackageManifest("base", "1.0.0", testDependency("lib", Breaks, RequiresLessThanEqual, "2.0.0")),
+	}
+	_, err = NewResolver(available...).Resolve("app")
+	if assert.IsType(t, &UnsatisfiableError{}, err) {
+		unsatisfiable := err.(*UnsatisfiableError)
+		assert.Equal(t, []string{
+			"requested app",
+			"app v1.0.0 depends lib (>= v2.0.0)",
+			"lib v2.0.0 depends base (== v1.0.0)",
+		}, unsatisfiable.Chain)
+		assert.Equal(t, []string{"base v1.0.0 breaks lib v2.0.0"}, unsatisfiable.Reasons)
+	}
+}
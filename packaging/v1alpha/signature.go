@@ -0,0 +1,228 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"sync"
+
+	limecrypto "github.com/limejuice-cc/api/crypto/v1alpha"
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+)
+
+// LimePackageSignature is the signature of the manifest and index of a lime package
+type LimePackageSignature struct {
+	Algorithm    string   `yaml:"algorithm" json:"algorithm"`       // Algorithm is the x509 signature algorithm
+	Signature    string   `yaml:"signature" json:"signature"`       // Signature is the base64 encoded signature of the package digest
+	Certificates []string `yaml:"certificates" json:"certificates"` // Certificates is the pem encoded signer certificate chain starting with the signer
+}
+
+// SignatureError is an error that occurs when a package signature cannot be verified
+type SignatureError struct {
+	limejuiceerrors.LimeJuiceError
+}
+
+func newSignatureError(format string, a ...interface{}) error {
+	err := &SignatureError{}
+	err.Message = fmt.Sprintf(format, a...)
+	return err
+}
+
+var signatureHashes = map[x509.SignatureAlgorithm]crypto.Hash{
+	x509.SHA256WithRSA:    crypto.SHA256,
+	x509.SHA384WithRSA:    crypto.SHA384,
+	x509.SHA512WithRSA:    crypto.SHA512,
+	x509.ECDSAWithSHA256:  crypto.SHA256,
+	x509.ECDSAWithSHA384:  crypto.SHA384,
+	x509.ECDSAWithSHA512:  crypto.SHA512,
+	x509.PureEd25519:      crypto.Hash(0),
+	x509.SHA256WithRSAPSS: crypto.SHA256,
+	x509.SHA384WithRSAPSS: crypto.SHA384,
+	x509.SHA512WithRSAPSS: crypto.SHA512,
+}
+
+func parseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	for algorithm := range signatureHashes {
+		if algorithm.String() == name {
+			return algorithm, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, newSignatureError("unsupported signature algorithm %s", name)
+}
+
+// PackageDigest returns the digest of the manifest and index sections of a lime package that is signed
+func PackageDigest(manifest, index []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(LimePackageMagic))
+	for _, section := range [][]byte{manifest, index} {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(section)))
+		h.Write(length[:])
+		h.Write(section)
+	}
+	return h.Sum(nil)
+}
+
+// PackageSigner signs lime packages
+type PackageSigner struct {
+	certificate limecrypto.Certificate
+	chain       []limecrypto.Certificate
+}
+
+// NewPackageSigner creates a new PackageSigner that signs with the private key of certificate. The chain of
+// intermediate certificates up to but not including the trusted root is embedded in signatures.
+func NewPackageSigner(certificate limecrypto.Certificate, chain ...limecrypto.Certificate) *PackageSigner {
+	return &PackageSigner{certificate: certificate, chain: chain}
+}
+
+// Sign signs the manifest and index sections of a lime package
+func (s *PackageSigner) Sign(manifest, index []byte) (*LimePackageSignature, error) {
+	key := s.certificate.PrivateKey()
+	if key == nil {
+		return nil, fmt.Errorf("signing certificate has no private key")
+	}
+	signer, ok := key.PrivateKey().(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key does not support signing")
+	}
+
+	algorithm := key.SignatureAlgorithm()
+	hash, found := signatureHashes[algorithm]
+	if !found {
+		return nil, fmt.Errorf("unsupported signature algorithm %s", algorithm)
+	}
+
+	var opts crypto.SignerOpts = hash
+	switch algorithm {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+
+	signed := PackageDigest(manifest, index)
+	if hash != crypto.Hash(0) {
+		h := hash.New()
+		h.Write(signed)
+		signed = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, signed, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &LimePackageSignature{Algorithm: algorithm.String(), Signature: base64.StdEncoding.EncodeToString(signature)}
+	for _, c := range append([]limecrypto.Certificate{s.certificate}, s.chain...) {
+		out.Certificates = append(out.Certificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Certificate().Raw})))
+	}
+	return out, nil
+}
+
+// SignPackage creates a detached signature for an existing package
+func (s *PackageSigner) SignPackage(p *PackageReader) (*LimePackageSignature, error) {
+	return s.Sign(p.header.rawManifest, p.header.rawIndex)
+}
+
+// PackageVerifier verifies lime package signatures against a set of trusted root certificates
+type PackageVerifier struct {
+	roots     *x509.CertPool
+	keyUsages []x509.ExtKeyUsage
+}
+
+// NewPackageVerifier creates a new PackageVerifier that trusts roots
+func NewPackageVerifier(roots ...limecrypto.Certificate) *PackageVerifier {
+	pool := x509.NewCertPool()
+	for _, root := range roots {
+		pool.AddCert(root.Certificate())
+	}
+	return &PackageVerifier{roots: pool, keyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}
+}
+
+var (
+	defaultVerifierMutex sync.RWMutex
+	defaultVerifier      *PackageVerifier
+)
+
+// SetDefaultVerifier sets the verifier of every package opened or decoded afterwards. Files of these packages are only
+// extracted once their signature is verified, unless verification is explicitly skipped with InsecureSkipVerify. A nil
+// verifier removes the default verifier.
+func SetDefaultVerifier(verifier *PackageVerifier) {
+	defaultVerifierMutex.Lock()
+	defer defaultVerifierMutex.Unlock()
+	defaultVerifier = verifier
+}
+
+// DefaultVerifier returns the default verifier or nil if no default verifier is set
+func DefaultVerifier() *PackageVerifier {
+	defaultVerifierMutex.RLock()
+	defer defaultVerifierMutex.RUnlock()
+	return defaultVerifier
+}
+
+// SetKeyUsages sets the extended key usages that the signer certificate must have
+func (v *PackageVerifier) SetKeyUsages(usages ...x509.ExtKeyUsage) {
+	v.keyUsages = usages
+}
+
+// Verify verifies the signature of the manifest and index sections of a lime package
+func (v *PackageVerifier) Verify(manifest, index []byte, signature *LimePackageSignature) error {
+	if len(signature.Certificates) == 0 {
+		return newSignatureError("signature has no signer certificate")
+	}
+
+	var certificates []*x509.Certificate
+	for _, encoded := range signature.Certificates {
+		block, _ := pem.Decode([]byte(encoded))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return newSignatureError("invalid signer certificate")
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return newSignatureError("invalid signer certificate: %s", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	if _, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     v.keyUsages,
+	}); err != nil {
+		return newSignatureError("untrusted signer certificate: %s", err)
+	}
+
+	algorithm, err := parseSignatureAlgorithm(signature.Algorithm)
+	if err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return newSignatureError("invalid signature encoding: %s", err)
+	}
+	if err := certificates[0].CheckSignature(algorithm, PackageDigest(manifest, index), raw); err != nil {
+		return newSignatureError("invalid package signature: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	limecrypto "github.com/limejuice-cc/api/crypto/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testKey struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k *testKey) Algorithm() limecrypto.KeyAlgorithm          { return limecrypto.ECDSAKey }
+func (k *testKey) Size() int                                   { return 256 }
+func (k *testKey) Encoded() []byte                             { return nil }
+func (k *testKey) PrivateKey() crypto.PrivateKey               { return k.key }
+func (k *testKey) PublicKeyAlgorithm() x509.PublicKeyAlgorithm { return x509.ECDSA }
+func (k *testKey) PublicKey() crypto.PublicKey                 { return k.key.Public() }
+func (k *testKey) SignatureAlgorithm() x509.SignatureAlgorithm { return x509.ECDSAWithSHA256 }
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *testKey
+}
+
+func (c *testCertificate) Encoded() []byte                           { return c.certificate.Raw }
+func (c *testCertificate) Certificate() *x509.Certificate            { return c.certificate }
+func (c *testCertificate) PrivateKey() limecrypto.Key                { return c.key }
+func (c *testCertificate) CA() bool                                  { return c.certificate.IsCA }
+func (c *testCertificate) Subject() limecrypto.DistinguishedName     { return nil }
+func (c *testCertificate) Hosts() limecrypto.CertificateHosts        { return nil }
+func (c *testCertificate) Expires() time.Time                        { return c.certificate.NotAfter }
+func (c *testCertificate) Usage() limecrypto.CertificateKeyUsages    { return nil }
+func (c *testCertificate) SerialNumber() *big.Int                    { return c.certificate.SerialNumber }
+func (c *testCertificate) SelfSign() (limecrypto.Certificate, error) { return nil, nil }
+func (c *testCertificate) Sign(limecrypto.Certificate) (limecrypto.Certificate, error) {
+	return nil, nil
+}
+
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key.key
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, signer, key.Public(), signerKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	certificate, err := x509.ParseCertificate(raw)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return &testCertificate{certificate: certificate, key: &testKey{key: key}}
+}
+
+func TestPackageSignature(t *testing.T) {
+	root := newTestCertificate(t, "root", nil)
+	leaf := newTestCertificate(t, "leaf", root)
+	other := newTestCertificate(t, "other", nil)
+
+	w := NewPackageWriter(testManifest())
+	w.SetSigner(NewPackageSigner(leaf))
+	assert.NoError(t, w.AddFile(&File{Path: "/a"}, strings.NewReader("contents of a")))
+	var out bytes.Buffer
+	_, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw := out.Bytes()
+
+	p, err := OpenPackage(bytes.NewReader(raw), int64(len(raw)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, p.Signature())
+	assert.NoError(t, p.Verify(NewPackageVerifier(root)))
+	assert.IsType(t, &SignatureError{}, p.Verify(NewPackageVerifier(other)))
+
+	verifier := NewPackageVerifier(root)
+	verifier.SetKeyUsages(x509.ExtKeyUsageServerAuth)
+	assert.IsType(t, &SignatureError{}, p.Verify(verifier))
+
+	d, err := NewPackageDecoder(bytes.NewReader(raw))
+	if assert.NoError(t, err) {
+		assert.NoError(t, d.Verify(NewPackageVerifier(root)))
+	}
+
+	tampered := *p.Signature()
+	tampered.Signature = tampered.Signature[4:]
+	assert.IsType(t, &SignatureError{}, p.VerifyDetached(NewPackageVerifier(root), &tampered))
+
+	unsigned := testPackage(t, map[string]string{"/a": "contents of a"})
+	p, err = OpenPackage(bytes.NewReader(unsigned), int64(len(unsigned)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, p.Signature())
+	assert.IsType(t, &SignatureError{}, p.Verify(NewPackageVerifier(root)))
+
+	detached, err := NewPackageSigner(leaf).SignPackage(p)
+	if assert.NoError(t, err) {
+		encoded, err := yaml.Marshal(detached)
+		assert.NoError(t, err)
+		var decoded LimePackageSignature
+		assert.NoError(t, yaml.Unmarshal(encoded, &decoded))
+		assert.NoError(t, p.VerifyDetached(NewPackageVerifier(root), &decoded))
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	root := newTestCertificate(t, "root", nil)
+	leaf := newTestCertificate(t, "leaf", root)
+
+	w := NewPackageWriter(testManifest())
+	w.SetSigner(NewPackageSigner(leaf))
+	assert.NoError(t, w.AddFile(&File{Path: "/a"}, strings.NewReader("contents of a")))
+	var out bytes.Buffer
+	_, err := w.WriteTo(&out)
+	if !assert.NoError(t, err) {
+		return
+	}
+	signed := out.Bytes()
+	unsigned := testPackage(t, map[string]string{"/a": "contents of a"})
+	tampered := bytes.Replace(signed, []byte("contents of a"), []byte("contents of b"), 1)
+	tampered = bytes.Replace(tampered, []byte(hashOf("contents of a")), []byte(hashOf("contents of b")), 1)
+	assert.NotEqual(t, signed, tampered)
+
+	verifier := NewPackageVerifier(root)
+	p, err := OpenPackage(bytes.NewReader(signed), int64(len(signed)))
+	if assert.NoError(t, err) {
+		p.SetVerifier(NewPackageVerifier(newTestCertificate(t, "other", nil)))
+		_, err = p.Open("/a")
+		assert.IsType(t, &SignatureError{}, err)
+		p.SetVerifier(verifier)
+		r, err := p.Open("/a")
+		if assert.NoError(t, err) {
+			r.Close()
+		}
+	}
+	d, err := NewPackageDecoder(bytes.NewReader(signed))
+	if assert.NoError(t, err) {
+		d.SetVerifier(verifier)
+		_, _, err = d.Next()
+		assert.NoError(t, err)
+	}
+
+	for _, raw := range [][]byte{unsigned, tampered} {
+		p, err := OpenPackage(bytes.NewReader(raw), int64(len(raw)))
+		if assert.NoError(t, err) {
+			p.SetVerifier(verifier)
+			_, err = p.Open("/a")
+			assert.IsType(t, &SignatureError{}, err)
+			p.InsecureSkipVerify()
+			r, err := p.Open("/a")
+			if assert.NoError(t, err) {
+				r.Close()
+			}
+		}
+		d, err := NewPackageDecoder(bytes.NewReader(raw))
+		if assert.NoError(t, err) {
+			d.SetVerifier(verifier)
+			_, _, err = d.Next()
+			assert.IsType(t, &SignatureError{}, err)
+		}
+	}
+
+	p, err = OpenPackage(bytes.NewReader(unsigned), int64(len(unsigned)))
+	if assert.NoError(t, err) {
+		p.SetVerifier(verifier)
+		detached, err := NewPackageSigner(leaf).SignPackage(p)
+		if assert.NoError(t, err) {
+			assert.NoError(t, p.VerifyDetached(verifier, detached))
+			r, err := p.Open("/a")
+			if assert.NoError(t, err) {
+				r.Close()
+			}
+		}
+	}
+}
+
+func TestDefaultVerifier(t *testing.T) {
+	root := newTestCertificate(t, "root", nil)
+	unsigned := testPackage(t, map[string]string{"/a": "contents of a"})
+
+	SetDefaultVerifier(NewPackageVerifier(root))
+	defer SetDefaultVerifier(nil)
+
+	p, err := OpenPackage(bytes.NewReader(unsigned), int64(len(unsigned)))
+	if assert.NoError(t, err) {
+		_, err = p.Open("/a")
+		assert.IsType(t, &SignatureError{}, err)
+		p.InsecureSkipVerify()
+		r, err := p.Open("/a")
+		if assert.NoError(t, err) {
+			r.Close()
+		}
+	}
+	d, err := NewPackageDecoder(bytes.NewReader(unsigned))
+	if assert.NoError(t, err) {
+		_, _, err = d.Next()
+		assert.IsType(t, &SignatureError{}, err)
+		d.InsecureSkipVerify()
+		_, _, err = d.Next()
+		assert.NoError(t, err)
+	}
+
+	SetDefaultVerifier(nil)
+	p, err = OpenPackage(bytes.NewReader(unsigned), int64(len(unsigned)))
+	if assert.NoError(t, err) {
+		r, err := p.Open("/a")
+		if assert.NoError(t, err) {
+			r.Close()
+		}
+	}
+}
@@ -15,11 +15,14 @@
 package v1alpha
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	common "github.com/limejuice-cc/api/common/v1alpha"
+	"gopkg.in/yaml.v3"
 )
 
 // PackageName represents the name of a package
@@ -58,25 +61,60 @@ func (n PackageName) MarshalYAML() (interface{}, error) {
 	return string(n), nil
 }
 
+// MarshalText implements the text marshaller method
+func (n PackageName) MarshalText() ([]byte, error) {
+	return []byte(n), nil
+}
+
+// UnmarshalText implements the text unmarshaller method
+func (n *PackageName) UnmarshalText(text []byte) error {
+	name := PackageName(text)
+	if err := name.Valid(); err != nil {
+		return err
+	}
+	*n = name
+	return nil
+}
+
 // MetadataItem represents an non-categorized metadata item
 type MetadataItem struct {
-	Key   string `yaml:"key"`   // Key is the metadata item's key
-	Value string `yaml:"value"` // Value is the metadata item's value
+	Key   string `yaml:"key" json:"key"`     // Key is the metadata item's key
+	Value string `yaml:"value" json:"value"` // Value is the metadata item's value
 }
 
 // Metadata represents package metadata
 type Metadata struct {
-	Description   string               `yaml:"description,omitempty"` // Description is an optional description of the package
-	Architectures common.Architectures `yaml:"arch,omitempty"`        // Architectures is an optional list of architectures
-	Items         []*MetadataItem      `yaml:"items,omitempty"`       // Items are additional metadata items
+	Description   string               `yaml:"description,omitempty" json:"description,omitempty"` // Description is an optional description of the package
+	Architectures common.Architectures `yaml:"arch,omitempty" json:"arch,omitempty"`               // Architectures is an optional list of architectures
+	Items         []*MetadataItem      `yaml:"items,omitempty" json:"items,omitempty"`             // Items are additional metadata items
 }
 
 // Dependency is a dependant package
 type Dependency struct {
-	Name         PackageName    `yaml:"name"`         // Name is the name of the dependant package
-	Version      common.Version `yaml:"version,flow"` // Version is the dependant package version
-	Requires     Required       `yaml:"requires"`     // Requires specifies the required version of the dependant package
-	Relationship Relationship   `yaml:"relation"`     // Relationship is the relationship of the package to the dependant package
+	Name         PackageName    `yaml:"name" json:"name"`            // Name is the name of the dependant package
+	Version      common.Version `yaml:"version,flow" json:"version"` // Version is the dependant package version
+	Requires     Required       `yaml:"requires" json:"requires"`    // Requires specifies the required version of the dependant package
+	Relationship Relationship   `yaml:"relation" json:"relation"`    // Relationship is the relationship of the package to the dependant package
+}
+
+// String implements the Stringer interface.
+func (d *Dependency) String() string {
+	if d.Requires == Required(0) {
+		return string(d.Name)
+	}
+	return fmt.Sprintf("%s (%s %s)", d.Name, d.Requires, d.Version.String())
+}
+
+// Satisfies checks if the candidate version satisfies the version requirement of dep. A dependency without a
+// version requirement is satisfied by any version.
+func Satisfies(dep Dependency, candidate common.Version) bool {
+	if dep.Requires == Required(0) {
+		return true
+	}
+	c := candidate.Compare(&dep.Version)
+	return (c == 0 && dep.Requires&RequiresEqual != 0) ||
+		(c > 0 && dep.Requires&RequiresGreaterThan != 0) ||
+		(c < 0 && dep.Requires&RequiresLessThan != 0)
 }
 
 // Dependencies is a list of dependant packages
@@ -84,21 +122,31 @@ type Dependencies []*Dependency
 
 // File is a package file
 type File struct {
-	Path     string   `yaml:"path"`             // Path is full path of the file
-	Type     FileType `yaml:"type"`             // Type is the package type of the file
-	IsCommon bool     `yaml:"common,omitempty"` // IsCommon indicates the file is a common file
-	SHA256   string   `yaml:"hash"`             // SHA256 hash is the SHA256 hash of the file
-	User     string   `yaml:"user,omitempty"`   // User is the user who owns the file
-	Group    string   `yaml:"group,omitempty"`  // Group is the group that owns the file
-	Mode     int      `yaml:"mode,omitempty"`   // Mode is the mode of the file
+	Path     string   `yaml:"path" json:"path"`                         // Path is full path of the file
+	Type     FileType `yaml:"type" json:"type"`                         // Type is the package type of the file
+	IsCommon bool     `yaml:"common,omitempty" json:"common,omitempty"` // IsCommon indicates the file is a common file
+	SHA256   string   `yaml:"hash" json:"hash"`                         // SHA256 hash is the SHA256 hash of the file
+	User     string   `yaml:"user,omitempty" json:"user,omitempty"`     // User is the user who owns the file
+	Group    string   `yaml:"group,omitempty" json:"group,omitempty"`   // Group is the group that owns the file
+	Mode     int      `yaml:"mode,omitempty" json:"mode,omitempty"`     // Mode is the mode of the file
 }
 
 // Files is a list of package file
 type Files []*File
 
+// Find returns the file with the given path or nil if it is not listed
+func (f Files) Find(path string) *File {
+	for _, file := range f {
+		if file.Path == path {
+			return file
+		}
+	}
+	return nil
+}
+
 // ActionItem is a step within an action
 type ActionItem struct {
-	Values interface{} `yaml:"action"` // Values are the action values
+	Values ActionValues `yaml:"action" json:"action"` // Values are the typed action values
 }
 
 // ActionItems are a list of ActionItem
@@ -106,17 +154,27 @@ type ActionItems []*ActionItem
 
 // Action is a packaging action
 type Action struct {
-	Type   ActionType  `yaml:"type"`             // Type is the type of action
-	Before ActionItems `yaml:"before,omitempty"` // Before are action items before the actiontype occurs
-	After  ActionItems `yaml:"after,omitempty"`  // After are action items after the actiontype occurs
+	Type   ActionType  `yaml:"type" json:"type"`                         // Type is the type of action
+	Before ActionItems `yaml:"before,omitempty" json:"before,omitempty"` // Before are action items before the actiontype occurs
+	After  ActionItems `yaml:"after,omitempty" json:"after,omitempty"`   // After are action items after the actiontype occurs
 }
 
 // Actions is a list of actions
 type Actions []*Action
 
+// Find returns the action of the given type or nil if there is none
+func (a Actions) Find(actionType ActionType) *Action {
+	for _, action := range a {
+		if action.Type == actionType {
+			return action
+		}
+	}
+	return nil
+}
+
 // Plugin desfines a plugin
 type Plugin struct {
-	Name PackageName `yaml:"name"` // Name is the name of the plugin
+	Name PackageName `yaml:"name" json:"name"` // Name is the name of the plugin
 }
 
 // Plugins is a lit of plugins
@@ -124,15 +182,137 @@ type Plugins []*Plugin
 
 // Manifest describes the contents of a lime package
 type Manifest struct {
-	Name         PackageName    `yaml:"name"`               // Name is the name of the package
-	Version      common.Version `yaml:"version,flow"`       // Version is the package version
-	Created      time.Time      `yaml:"created"`            // Created is the datetime that the package was created
-	Metadata     Metadata       `yaml:"metadata,omitempty"` // Metadata is package metadata
-	Dependencies Dependencies   `yaml:"depends,omitempty"`  // Dependencies are depdenant packages
-	Files        Files          `yaml:"files,omitempty"`    // Files are package files
-	Actions      Actions        `yaml:"actions,omitempty"`  // Actions are package actions
-	Triggers     Actions        `yaml:"triggers,omitempty"` // Triggers are actions triggered by other packages
-	Plugins      Plugins        `yaml:"plugins,omitempty"`  // Plugins specifies the plugsins used by this package
+	Name          PackageName          `yaml:"name" json:"name"`                                       // Name is the name of the package
+	Version       common.Version       `yaml:"version,flow" json:"version"`                            // Version is the package version
+	VersionScheme common.VersionScheme `yaml:"versionScheme,omitempty" json:"versionScheme,omitempty"` // VersionScheme is the versioning scheme of the package and its dependencies
+	Created       time.Time            `yaml:"created" json:"created"`                                 // Created is the datetime that the package was created
+	Metadata      Metadata             `yaml:"metadata,omitempty" json:"metadata,omitempty"`           // Metadata is package metadata
+	Dependencies  Dependencies         `yaml:"depends,omitempty" json:"depends,omitempty"`             // Dependencies are depdenant packages
+	Files         Files                `yaml:"files,omitempty" json:"files,omitempty"`                 // Files are package files
+	Actions       Actions              `yaml:"actions,omitempty" json:"actions,omitempty"`             // Actions are package actions
+	Triggers      Triggers             `yaml:"triggers,omitempty" json:"triggers,omitempty"`           // Triggers are actions triggered by other packages
+	Activates     []string             `yaml:"activates,omitempty" json:"activates,omitempty"`         // Activates are the named trigger events activated by operations on this package
+	Plugins       Plugins              `yaml:"plugins,omitempty" json:"plugins,omitempty"`             // Plugins specifies the plugsins used by this package
+}
+
+// Canonical returns a copy of the manifest in canonical form, its files are ordered by path and its creation time is
+// in UTC. Manifests that only differ in the order their files were listed or the time zone of their creation time are
+// serialized identically in canonical form.
+func (m *Manifest) Canonical() *Manifest {
+	c := *m
+	c.Created = m.Created.UTC()
+	if m.Files != nil {
+		c.Files = append(Files{}, m.Files...)
+		sort.SliceStable(c.Files, func(i, j int) bool { return c.Files[i].Path < c.Files[j].Path })
+	}
+	return &c
+}
+
+// UnmarshalYAML implements custom unmarshal for Manifest, applying the version scheme of the manifest to the
+// package version and the versions of its dependencies
+func (m *Manifest) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	type plain Manifest
+	if err = unmarshal((*plain)(m)); err != nil {
+		return
+	}
+	var raw struct {
+		Version      yaml.Node `yaml:"version"`
+		Dependencies []struct {
+			Version yaml.Node `yaml:"version"`
+		} `yaml:"depends"`
+	}
+	if err = unmarshal(&raw); err != nil {
+		return
+	}
+	texts := []string{yamlVersionText(&raw.Version)}
+	for _, dep := range raw.Dependencies {
+		texts = append(texts, yamlVersionText(&dep.Version))
+	}
+	return m.applyVersionScheme(texts)
+}
+
+// UnmarshalJSON implements custom unmarshal for Manifest, applying the version scheme of the manifest like
+// UnmarshalYAML
+func (m *Manifest) UnmarshalJSON(data []byte) error {
+	type plain Manifest
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	var raw struct {
+		Version      json.RawMessage `json:"version"`
+		Dependencies []struct {
+			Version json.RawMessage `json:"version"`
+		} `json:"depends"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	texts := []string{jsonVersionText(raw.Version)}
+	for _, dep := range raw.Dependencies {
+		texts = append(texts, jsonVersionText(dep.Version))
+	}
+	return m.applyVersionScheme(texts)
+}
+
+// yamlVersionText returns the text of a version encoded as a yaml scalar, versions encoded as mappings have no text
+func yamlVersionText(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	return ""
+}
+
+// jsonVersionText returns the text of a version encoded as a json string, versions encoded as objects have no text
+func jsonVersionText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return ""
+	}
+	return text
+}
+
+// checkVersionScheme checks that a version does not use another versioning scheme than scheme
+func checkVersionScheme(v *common.Version, scheme common.VersionScheme) error {
+	if v.Scheme != common.VersionScheme(0) && v.Scheme != scheme {
+		return fmt.Errorf("version %s uses %s versioning instead of %s versioning", v.String(), v.Scheme, scheme)
+	}
+	return nil
+}
+
+// applyVersionScheme sets the scheme of all versions in the manifest and validates them. Versions encoded as text
+// are parsed leniently before the version scheme is known, they are parsed again from texts using the scheme. texts
+// lists the text of the package version followed by those of the dependency versions, it is empty for versions that
+// were not encoded as text.
+func (m *Manifest) applyVersionScheme(texts []string) error {
+	versions := []*common.Version{&m.Version}
+	for _, dep := range m.Dependencies {
+		versions = append(versions, &dep.Version)
+	}
+	for i, v := range versions {
+		if m.VersionScheme != common.VersionScheme(0) {
+			if i < len(texts) && texts[i] != "" {
+				parsed, err := common.ParseVersionWithScheme(texts[i], m.VersionScheme)
+				if err != nil {
+					return err
+				}
+				*v = *parsed
+				continue
+			}
+			if err := checkVersionScheme(v, m.VersionScheme); err != nil {
+				return err
+			}
+			v.Scheme = m.VersionScheme
+		}
+		if err := v.Valid(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseVersion parses a version using the versioning scheme of the manifest
+func (m *Manifest) ParseVersion(v string) (*common.Version, error) {
+	return common.ParseVersionWithScheme(v, m.VersionScheme)
 }
 
 const (
@@ -142,15 +322,16 @@ const (
 
 // LimePackageFileIndexEntry is an entry in the lime package file index
 type LimePackageFileIndexEntry struct {
-	Path           string `yaml:"path"`       // Path is the file path
-	Size           int64  `yaml:"size"`       // Size is the original file size
-	CompressedSize int64  `yaml:"compressed"` // CompressedSize is the compressed file size
-	FileOffset     int64  `yaml:"offset"`     // FileOffset is the offset of the file in the package
+	Path           string      `yaml:"path" json:"path"`                                   // Path is the file path
+	Size           int64       `yaml:"size" json:"size"`                                   // Size is the original file size
+	CompressedSize int64       `yaml:"compressed" json:"compressed"`                       // CompressedSize is the compressed file size
+	Compression    Compression `yaml:"compression,omitempty" json:"compression,omitempty"` // Compression is the codec used to compress the file
+	FileOffset     int64       `yaml:"offset" json:"offset"`                               // FileOffset is the offset of the file in the package
 }
 
 // LimePackageFileIndex is the file index for a lime package
 type LimePackageFileIndex struct {
-	Files []LimePackageFileIndexEntry `yaml:"files"` // Files are the entries in the file index
+	Files []LimePackageFileIndexEntry `yaml:"files" json:"files"` // Files are the entries in the file index
 }
 
 // RawLimePackageFile is a raw lime package file
@@ -158,10 +339,12 @@ type RawLimePackageFile []byte
 
 // RawLimePackage is a raw lime package
 type RawLimePackage struct {
-	Magic          [8]byte
-	ManifestLength [8]byte
-	Manifest       []byte
-	IndexLength    [8]byte
-	Index          []byte
-	Files          []byte
+	Magic           [8]byte
+	ManifestLength  [8]byte
+	Manifest        []byte
+	IndexLength     [8]byte
+	Index           []byte
+	SignatureLength [8]byte
+	Signature       []byte
+	Files           []byte
 }
@@ -15,10 +15,14 @@
 package v1alpha
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
 	"testing"
 	"time"
 
 	common "github.com/limejuice-cc/api/common/v1alpha"
+	"github.com/limejuice-cc/api/helper"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
@@ -75,6 +79,54 @@ func TestParseRequired(t *testing.T) {
 	_, err := ParseRequired("")
 	assert.Error(t, err)
 	assert.Equal(t, "", Required(0).String())
+
+	encoded, err := yaml.Marshal(&Dependency{Name: "dep", Relationship: Depends})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(encoded), "requires: \"\"\n")
+		assert.Contains(t, string(encoded), "version: {major: 0, minor: 0, patch: 0, tag: \"\"}\n")
+		var d Dependency
+		if assert.NoError(t, yaml.Unmarshal(encoded, &d)) {
+			assert.Equal(t, Dependency{Name: "dep", Relationship: Depends}, d)
+		}
+	}
+	var r Required
+	assert.Error(t, yaml.Unmarshal([]byte("unknown"), &r))
+}
+
+func TestSatisfies(t *testing.T) {
+	var testValues = []struct {
+		requires  Required
+		version   string
+		candidate string
+		outcome   bool
+	}{
+		{Required(0), "", "v0.1.0", true},
+		{RequiresEqual, "v1.0.0", "v1.0.0", true},
+		{RequiresEqual, "v1.0.0", "v1.0.0-rc1", false},
+		{RequiresGreaterThan, "v1.0.0", "v1.0.1", true},
+		{RequiresGreaterThan, "v1.0.0", "v1.0.0", false},
+		{RequiresGreaterThanEqual, "v1.0.0", "v1.0.0", true},
+		{RequiresGreaterThanEqual, "v1.0.0", "v1.0.0-rc1", false},
+		{RequiresLessThan, "v1.0.0", "v1.0.0-rc1", true},
+		{RequiresLessThan, "v1.0.0", "v1.0.0", false},
+		{RequiresLessThanEqual, "v1.0.0", "v1.0.0", true},
+		{RequiresLessThanEqual, "v1.0.0", "v1.1.0", false},
+	}
+
+	for _, v := range testValues {
+		dep := Dependency{Name: "test", Requires: v.requires}
+		if v.version != "" {
+			version, err := common.ParseVersion(v.version)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			dep.Version = *version
+		}
+		candidate, err := common.ParseVersion(v.candidate)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, Satisfies(dep, *candidate), "%s %s", dep.String(), v.candidate)
+		}
+	}
 }
 
 func TestParseFileType(t *testing.T) {
@@ -112,6 +164,7 @@ func TestParseActionType(t *testing.T) {
 		{"upgrade", Upgrade},
 		{"remove", Remove},
 		{"purge", Purge},
+		{"trigger", Triggered},
 	}
 
 	for _, v := range testValues {
@@ -127,6 +180,105 @@ func TestParseActionType(t *testing.T) {
 	assert.Equal(t, "", ActionType(0).String())
 }
 
+func TestParseCompression(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome Compression
+	}{
+		{"none", NoCompression},
+		{"gzip", GzipCompression},
+		{"zstd", ZstdCompression},
+		{"xz", XZCompression},
+	}
+
+	for _, v := range testValues {
+		c, err := ParseCompression(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, c)
+			assert.Equal(t, v.value, c.String())
+		}
+	}
+
+	_, err := ParseCompression("")
+	assert.NoError(t, err)
+	assert.Equal(t, "none", Compression(0).String())
+	_, err = ParseCompression("nothing")
+	assert.Error(t, err)
+}
+
+func TestParseVerificationProblemKind(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome VerificationProblemKind
+	}{
+		{"missing", MissingFile},
+		{"unlisted", UnlistedFile},
+		{"duplicate", DuplicateFile},
+		{"size", SizeMismatch},
+		{"hash", HashMismatch},
+		{"unreadable", UnreadableFile},
+		{"unverified", UnverifiedSignature},
+	}
+
+	for _, v := range testValues {
+		k, err := ParseVerificationProblemKind(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, k)
+			assert.Equal(t, v.value, k.String())
+		}
+	}
+
+	_, err := ParseVerificationProblemKind("")
+	assert.Error(t, err)
+	assert.Equal(t, "", VerificationProblemKind(0).String())
+}
+
+func TestParseChangeType(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome ChangeType
+	}{
+		{"added", Added},
+		{"removed", Removed},
+		{"changed", Changed},
+	}
+
+	for _, v := range testValues {
+		c, err := ParseChangeType(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, c)
+			assert.Equal(t, v.value, c.String())
+		}
+	}
+
+	_, err := ParseChangeType("")
+	assert.Error(t, err)
+	assert.Equal(t, "", ChangeType(0).String())
+}
+
+func TestParseDeltaMethod(t *testing.T) {
+	var testValues = []struct {
+		value   string
+		outcome DeltaMethod
+	}{
+		{"copy", DeltaCopy},
+		{"full", DeltaFull},
+		{"patch", DeltaPatch},
+	}
+
+	for _, v := range testValues {
+		m, err := ParseDeltaMethod(v.value)
+		if assert.NoError(t, err) {
+			assert.Equal(t, v.outcome, m)
+			assert.Equal(t, v.value, m.String())
+		}
+	}
+
+	_, err := ParseDeltaMethod("")
+	assert.Error(t, err)
+	assert.Equal(t, "", DeltaMethod(0).String())
+}
+
 func TestMarshalManifest(t *testing.T) {
 	manifest := Manifest{}
 	manifest.Name = "test"
@@ -146,6 +298,18 @@ func TestMarshalManifest(t *testing.T) {
 		assert.NoError(t, yaml.Unmarshal(out, &m))
 	}
 
+	debian := "name: test\nversionScheme: debian\nversion: {major: 1, epoch: 2, revision: \"1\"}\n" +
+		"depends:\n  - {name: dep, version: {major: 1, tag: \"~rc1\"}, requires: \">=\", relation: depends}\n"
+	if assert.NoError(t, yaml.Unmarshal([]byte(debian), &manifest)) {
+		assert.Equal(t, "2:1.0.0-1", manifest.Version.String())
+		assert.Equal(t, common.DebianVersioning, manifest.Dependencies[0].Version.Scheme)
+		v, err := manifest.ParseVersion("1.0.0~rc2")
+		if assert.NoError(t, err) {
+			assert.True(t, Satisfies(*manifest.Dependencies[0], *v))
+		}
+	}
+	assert.Error(t, yaml.Unmarshal([]byte("name: test\nversionScheme: semver\nversion: {major: 1, tag: \"01\"}"), &manifest))
+
 	var pn PackageName
 	assert.Error(t, yaml.Unmarshal([]byte("[1,2,3]"), &pn))
 	assert.Error(t, yaml.Unmarshal([]byte("NONEn"), &pn))
@@ -169,3 +333,168 @@ func TestMarshalManifest(t *testing.T) {
 	assert.Error(t, yaml.Unmarshal([]byte("[1,2,3]"), &at))
 	assert.Error(t, yaml.Unmarshal([]byte("unknown"), &at))
 }
+
+func TestManifestVersionText(t *testing.T) {
+	testValues := []struct {
+		scheme  string
+		version string
+		depends string
+		outcome string
+		valid   bool
+	}{
+		{"", "1.2", "2", "v1.2.0 v2.0.0", true},
+		{"", "1:2.3-1", "2.3", "1:2.3-1 v2.3.0", true},
+		{"semver", "1.2.3-rc.1", "2.0.0", "v1.2.3-rc.1 v2.0.0", true},
+		{"semver", "1", "2.0.0", "", false},
+		{"semver", "1.2.3", "1.2", "", false},
+		{"semver", "1:2.3-1", "2.0.0", "", false},
+		{"debian", "1:2.3-1", "2.14", "1:2.3-1 2.14", true},
+		{"debian", "2.3-1", "2.0~rc1-0ubuntu1", "2.3-1 2.0~rc1-0ubuntu1", true},
+		{"debian", "2.30+dfsg-1", "1.2", "2.30+dfsg-1 1.2", true},
+		{"debian", "v1.2", "1.2", "", false},
+	}
+	for _, v := range testValues {
+		document, toml := `{"name": "test", `, "name = \"test\"\n"
+		if v.scheme != "" {
+			document += fmt.Sprintf(`"versionScheme": %q, `, v.scheme)
+			toml += fmt.Sprintf("versionScheme = %q\n", v.scheme)
+		}
+		document += fmt.Sprintf(`"version": %q, "depends": [{"name": "dep", "version": %q, "requires": ">=", "relation": "depends"}]}`, v.version, v.depends)
+		toml += fmt.Sprintf("version = %q\n[[depends]]\nname = \"dep\"\nversion = %q\nrequires = \">=\"\nrelation = \"depends\"\n", v.version, v.depends)
+		for name, decode := range map[string]func(*Manifest) error{
+			"yaml": func(m *Manifest) error { return yaml.Unmarshal([]byte(document), m) },
+			"json": func(m *Manifest) error { return json.Unmarshal([]byte(document), m) },
+			"toml": func(m *Manifest) error { return helper.UnmarshalTOML([]byte(toml), m) },
+		} {
+			var m Manifest
+			err := decode(&m)
+			if !v.valid {
+				assert.Error(t, err, "%s %s", name, document)
+				continue
+			}
+			if assert.NoError(t, err, "%s %s", name, document) {
+				assert.Equal(t, v.outcome, m.Version.String()+" "+m.Dependencies[0].Version.String(), name)
+				assert.Equal(t, m.VersionScheme, m.Dependencies[0].Version.Scheme, name)
+			}
+		}
+	}
+
+	var m Manifest
+	if assert.NoError(t, yaml.Unmarshal([]byte("name: test\nversionScheme: debian\nversion: 2.3-1\n"), &m)) {
+		assert.Equal(t, common.Version{Major: 2, Minor: 3, Revision: "1", Upstream: "2.3", Scheme: common.DebianVersioning}, m.Version)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`{"name": "test", "versionScheme": "debian", "version": {"major": 1, "scheme": "semver"}}`), &m))
+}
+
+// documentKeys returns the sorted paths of all keys of a decoded document
+func documentKeys(prefix string, document interface{}) []string {
+	var keys []string
+	switch d := document.(type) {
+	case map[string]interface{}:
+		for k, v := range d {
+			keys = append(keys, prefix+k)
+			keys = append(keys, documentKeys(prefix+k+".", v)...)
+		}
+	case []interface{}:
+		for _, v := range d {
+			keys = append(keys, documentKeys(prefix, v)...)
+		}
+	case []map[string]interface{}:
+		for _, v := range d {
+			keys = append(keys, documentKeys(prefix, v)...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestManifestEncodings(t *testing.T) {
+	version := common.Version{Major: 1, Minor: 2, Epoch: 1, Revision: "3", Scheme: common.DebianVersioning}
+	manifest := testManifest()
+	manifest.VersionScheme = common.DebianVersioning
+	manifest.Version = version
+	manifest.Metadata.Description = "test package"
+	manifest.Metadata.Items = []*MetadataItem{{Key: "maintainer", Value: "Jane Doe"}}
+	manifest.Dependencies = Dependencies{
+		{Name: "libc", Version: version, Requires: RequiresGreaterThanEqual, Relationship: Depends},
+		{Name: "old", Version: common.Version{Scheme: common.DebianVersioning}, Relationship: Replaces},
+	}
+	manifest.Files = Files{
+		{Path: "/etc/test.conf", Type: ConfigurationFile, SHA256: hashOf("key=value\n"), User: "root", Group: "root", Mode: 0640},
+		{Path: "/usr/bin/test", Type: ExecutableFile, IsCommon: true, SHA256: hashOf("")},
+	}
+	manifest.Actions = Actions{{
+		Type:   Install,
+		Before: ActionItems{{Values: &CreateUserAction{Name: "test", System: true}}},
+		After: ActionItems{
+			{Values: &CommandAction{Command: []string{"systemctl", "daemon-reload"}, Env: map[string]string{"A": "b"}}},
+			{Values: &SystemdUnitAction{Unit: "test.service", Now: true}},
+		},
+	}}
+	manifest.Triggers = Triggers{{Paths: []string{"/usr/lib"}, Items: ActionItems{{Values: &CommandAction{Command: []string{"ldconfig"}}}}}}
+	manifest.Activates = []string{"test-event"}
+	manifest.Plugins = Plugins{{Name: "systemd"}}
+
+	encoded, err := yaml.Marshal(manifest)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var yamlDocument map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(encoded, &yamlDocument))
+	keys := documentKeys("", yamlDocument)
+	assert.Contains(t, keys, "actions.after.action.kind")
+	assert.Contains(t, keys, "depends.version.revision")
+
+	encodings := []struct {
+		name      string
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+	}{
+		{"yaml", yaml.Marshal, yaml.Unmarshal},
+		{"json", json.Marshal, json.Unmarshal},
+		{"toml", helper.MarshalTOML, helper.UnmarshalTOML},
+	}
+	for _, e := range encodings {
+		encoded, err := e.marshal(manifest)
+		if !assert.NoError(t, err, e.name) {
+			continue
+		}
+		var m Manifest
+		if assert.NoError(t, e.unmarshal(encoded, &m), e.name) {
+			assert.Equal(t, manifest, &m, e.name)
+		}
+		var document map[string]interface{}
+		if assert.NoError(t, e.unmarshal(encoded, &document), e.name) {
+			assert.Equal(t, keys, documentKeys("", document), e.name)
+		}
+	}
+
+	for _, e := range encodings[1:] {
+		for _, invalid := range []string{
+			`{"name": "Not Valid"}`,
+			`{"name": "test", "version": "dead beef"}`,
+			`{"name": "test", "versionScheme": "semver", "version": {"major": 1, "tag": "01"}}`,
+			`{"name": "test", "depends": [{"name": "dep", "relation": "unknown"}]}`,
+			`{"name": "test", "files": [{"path": "/a", "type": "unknown"}]}`,
+			`{"name": "test", "actions": [{"type": "install", "before": [{"action": {"kind": "unknown"}}]}]}`,
+			`{"name": "test", "actions": [{"type": "install", "before": [{"action": {"kind": "command"}}]}]}`,
+		} {
+			var document map[string]interface{}
+			if !assert.NoError(t, json.Unmarshal([]byte(invalid), &document)) {
+				continue
+			}
+			encoded, err := e.marshal(document)
+			if assert.NoError(t, err, e.name) {
+				var m Manifest
+				assert.Error(t, e.unmarshal(encoded, &m), "%s %s", e.name, invalid)
+			}
+		}
+	}
+
+	var m Manifest
+	if assert.NoError(t, json.Unmarshal([]byte(`{"name": "test", "version": "1.2.3"}`), &m)) {
+		assert.Equal(t, common.Version{Major: 1, Minor: 2, Patch: 3}, m.Version)
+	}
+	_, err = json.Marshal(&ActionItem{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var triggerEventPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Trigger declares action items that are run when other packages activate the trigger. A trigger is activated by
+// a named event listed in the Activates of a package, or by a package operation that installs, replaces or removes a
+// file at one of the trigger paths or below one of the trigger directories.
+type Trigger struct {
+	Events []string    `yaml:"events,omitempty" json:"events,omitempty"` // Events are the named events that activate the trigger
+	Paths  []string    `yaml:"paths,omitempty" json:"paths,omitempty"`   // Paths are the files and directories that activate the trigger
+	Items  ActionItems `yaml:"items" json:"items"`                       // Items are the action items run when the trigger fires
+}
+
+// Triggers is a list of triggers
+type Triggers []*Trigger
+
+// triggerFields are the fields of an encoded trigger
+var triggerFields = map[string]bool{"events": true, "paths": true, "items": true}
+
+// checkTriggerFields rejects unknown trigger fields. Manifests used to list triggers as actions with a type and
+// before and after items, which would otherwise decode as triggers that are never activated.
+func checkTriggerFields(fields []string) error {
+	sort.Strings(fields)
+	for _, field := range fields {
+		if !triggerFields[field] {
+			return fmt.Errorf("unknown trigger field %s, triggers list the events and paths activating them and their items", field)
+		}
+	}
+	return nil
+}
+
+// UnmarshalYAML implements custom unmarshal for Trigger, rejecting unknown fields
+func (t *Trigger) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var document map[string]interface{}
+	if err := unmarshal(&document); err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(document))
+	for field := range document {
+		fields = append(fields, field)
+	}
+	if err := checkTriggerFields(fields); err != nil {
+		return err
+	}
+	type plain Trigger
+	return unmarshal((*plain)(t))
+}
+
+// UnmarshalJSON implements custom unmarshal for Trigger, rejecting unknown fields like UnmarshalYAML
+func (t *Trigger) UnmarshalJSON(data []byte) error {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(document))
+	for field := range document {
+		fields = append(fields, field)
+	}
+	if err := checkTriggerFields(fields); err != nil {
+		return err
+	}
+	type plain Trigger
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// validTriggerEvent checks the name of a trigger event
+func validTriggerEvent(event string) error {
+	if !triggerEventPattern.MatchString(event) {
+		return fmt.Errorf("invalid trigger event %s", event)
+	}
+	return nil
+}
+
+// triggerProblem is a problem with the events or paths of a trigger
+type triggerProblem struct {
+	field string // field is the path of the field relative to the trigger such as .events[1], empty for the trigger
+	err   error
+}
+
+// validateTargets checks the events and paths that activate the trigger and returns every problem found
+func (t *Trigger) validateTargets() []triggerProblem {
+	var problems []triggerProblem
+	if len(t.Events) == 0 && len(t.Paths) == 0 {
+		problems = append(problems, triggerProblem{"", fmt.Errorf("trigger requires an event or a path")})
+	}
+	for i, event := range t.Events {
+		if err := validTriggerEvent(event); err != nil {
+			problems = append(problems, triggerProblem{fmt.Sprintf(".events[%d]", i), err})
+		}
+	}
+	for i, p := range t.Paths {
+		if err := validAbsolutePath(p); err != nil {
+			problems = append(problems, triggerProblem{fmt.Sprintf(".paths[%d]", i), err})
+		}
+	}
+	return problems
+}
+
+// Validate checks that the trigger is valid
+func (t *Trigger) Validate() error {
+	if problems := t.validateTargets(); len(problems) > 0 {
+		return problems[0].err
+	}
+	for _, item := range t.Items {
+		if err := item.Validate(); err != nil {
+			return fmt.Errorf("invalid trigger: %s", err)
+		}
+	}
+	return nil
+}
+
+// MatchesEvent checks if the trigger is activated by the named event
+func (t *Trigger) MatchesEvent(event string) bool {
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesPath checks if the trigger is activated by a change to the file at path
+func (t *Trigger) MatchesPath(path string) bool {
+	for _, p := range t.Paths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTrigger(t *testing.T) {
+	trigger := &Trigger{
+		Events: []string{"ldconfig"},
+		Paths:  []string{"/usr/lib/", "/etc/ld.so.conf"},
+		Items:  ActionItems{&ActionItem{Values: &CommandAction{Command: []string{"/sbin/ldconfig"}}}},
+	}
+	assert.Error(t, trigger.Validate())
+	trigger.Paths[0] = "/usr/lib"
+	assert.NoError(t, trigger.Validate())
+
+	assert.True(t, trigger.MatchesEvent("ldconfig"))
+	assert.False(t, trigger.MatchesEvent("systemd-reload"))
+	assert.True(t, trigger.MatchesPath("/usr/lib"))
+	assert.True(t, trigger.MatchesPath("/usr/lib/x86_64/libc.so"))
+	assert.True(t, trigger.MatchesPath("/etc/ld.so.conf"))
+	assert.False(t, trigger.MatchesPath("/usr/libexec/app"))
+	assert.False(t, trigger.MatchesPath("/etc/ld.so.conf.d/app.conf"))
+	assert.True(t, (&Trigger{Paths: []string{"/"}}).MatchesPath("/etc/app.conf"))
+
+	out, err := yaml.Marshal(Triggers{trigger})
+	if assert.NoError(t, err) {
+		var decoded Triggers
+		assert.NoError(t, yaml.Unmarshal(out, &decoded))
+		assert.Equal(t, Triggers{trigger}, decoded)
+	}
+
+	old := "name: test\nversion: 1.0.0\ntriggers:\n  - type: install\n    after:\n      - action: {kind: command}\n        command: [ldconfig]\n"
+	var m Manifest
+	err = yaml.Unmarshal([]byte(old), &m)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown trigger field after")
+	}
+	err = json.Unmarshal([]byte(`{"name": "test", "version": "1.0.0", "triggers": [{"type": "install", "before": []}]}`), &m)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown trigger field before")
+	}
+	out, err = json.Marshal(Triggers{trigger})
+	if assert.NoError(t, err) {
+		var decoded Triggers
+		assert.NoError(t, json.Unmarshal(out, &decoded))
+		assert.Equal(t, Triggers{trigger}, decoded)
+	}
+
+	assert.Error(t, (&Trigger{}).Validate())
+	assert.Error(t, (&Trigger{Events: []string{"Bad Event"}}).Validate())
+	assert.Error(t, (&Trigger{Events: []string{"ldconfig"}, Items: ActionItems{&ActionItem{}}}).Validate())
+}
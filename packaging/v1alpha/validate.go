@@ -0,0 +1,249 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// FieldError is a problem with a field of a manifest
+type FieldError struct {
+	Field   string // Field is the YAML path of the field, such as files[2].hash
+	Message string // Message describes the problem
+}
+
+// String implements the Stringer interface.
+func (e *FieldError) String() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ManifestValidationError is an error that occurs when a manifest is invalid
+type ManifestValidationError struct {
+	limejuiceerrors.LimeJuiceError
+	Fields []*FieldError // Fields are all problems found in the manifest
+}
+
+func newManifestValidationError(fields []*FieldError) *ManifestValidationError {
+	err := &ManifestValidationError{Fields: fields}
+	var b strings.Builder
+	b.WriteString("invalid manifest:")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "\n  %s", f)
+	}
+	err.Message = b.String()
+	return err
+}
+
+// manifestValidator collects the problems found in a manifest
+type manifestValidator struct {
+	manifest *Manifest
+	fields   []*FieldError
+}
+
+func (v *manifestValidator) add(field, format string, a ...interface{}) {
+	v.fields = append(v.fields, &FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+}
+
+func (v *manifestValidator) check(field string, err error) {
+	if err != nil {
+		v.add(field, "%s", err)
+	}
+}
+
+// checkVersion checks a version using the versioning scheme of the manifest
+func (v *manifestValidator) checkVersion(field string, version common.Version) {
+	if v.manifest.VersionScheme != common.VersionScheme(0) {
+		if err := checkVersionScheme(&version, v.manifest.VersionScheme); err != nil {
+			v.check(field, err)
+			return
+		}
+		version.Scheme = v.manifest.VersionScheme
+	}
+	v.check(field, version.Valid())
+}
+
+// checkName checks a required package name
+func (v *manifestValidator) checkName(field string, name PackageName) {
+	if name == "" {
+		v.add(field, "name is required")
+		return
+	}
+	v.check(field, name.Valid())
+}
+
+// checkItems checks a list of action items
+func (v *manifestValidator) checkItems(field string, items ActionItems) {
+	for i, item := range items {
+		v.check(fmt.Sprintf("%s[%d].action", field, i), item.Validate())
+	}
+}
+
+// Validate checks the whole manifest and returns a *ManifestValidationError listing every problem with the YAML
+// path of the offending field, or nil if the manifest is valid
+func (m *Manifest) Validate() error {
+	v := &manifestValidator{manifest: m}
+	v.checkName("name", m.Name)
+	if m.VersionScheme != common.VersionScheme(0) && m.VersionScheme.String() == "" {
+		v.add("versionScheme", "unknown version scheme %d", m.VersionScheme)
+	} else {
+		v.checkVersion("version", m.Version)
+	}
+	if m.Created.IsZero() {
+		v.add("created", "created time is required")
+	}
+
+	m.validateMetadata(v)
+	m.validateDependencies(v)
+	m.validateFiles(v)
+
+	actions := map[ActionType]int{}
+	for i, action := range m.Actions {
+		field := fmt.Sprintf("actions[%d]", i)
+		switch {
+		case action.Type == ActionType(0):
+			v.add(field+".type", "action type is required")
+		case action.Type.String() == "":
+			v.add(field+".type", "unknown action type %d", action.Type)
+		default:
+			if j, found := actions[action.Type]; found {
+				v.add(field+".type", "duplicate %s action, also listed as actions[%d]", action.Type, j)
+			}
+			actions[action.Type] = i
+		}
+		v.checkItems(field+".before", action.Before)
+		v.checkItems(field+".after", action.After)
+	}
+
+	for i, trigger := range m.Triggers {
+		field := fmt.Sprintf("triggers[%d]", i)
+		for _, problem := range trigger.validateTargets() {
+			v.check(field+problem.field, problem.err)
+		}
+		v.checkItems(field+".items", trigger.Items)
+	}
+	for i, event := range m.Activates {
+		v.check(fmt.Sprintf("activates[%d]", i), validTriggerEvent(event))
+	}
+
+	for i, plugin := range m.Plugins {
+		v.checkName(fmt.Sprintf("plugins[%d].name", i), plugin.Name)
+	}
+
+	if len(v.fields) > 0 {
+		return newManifestValidationError(v.fields)
+	}
+	return nil
+}
+
+func (m *Manifest) validateMetadata(v *manifestValidator) {
+	architectures := map[common.Architecture]int{}
+	for i, arch := range m.Metadata.Architectures {
+		field := fmt.Sprintf("metadata.arch[%d]", i)
+		if arch.String() == "" {
+			v.add(field, "unknown architecture %d", arch)
+			continue
+		}
+		if j, found := architectures[arch]; found {
+			v.add(field, "duplicate architecture %s, also listed as metadata.arch[%d]", arch, j)
+		}
+		architectures[arch] = i
+	}
+
+	keys := map[string]int{}
+	for i, item := range m.Metadata.Items {
+		field := fmt.Sprintf("metadata.items[%d].key", i)
+		if item.Key == "" {
+			v.add(field, "metadata key is required")
+			continue
+		}
+		if j, found := keys[item.Key]; found {
+			v.add(field, "duplicate metadata key %s, also listed as metadata.items[%d]", item.Key, j)
+		}
+		keys[item.Key] = i
+	}
+}
+
+func (m *Manifest) validateDependencies(v *manifestValidator) {
+	for i, dep := range m.Dependencies {
+		field := fmt.Sprintf("depends[%d]", i)
+		v.checkName(field+".name", dep.Name)
+		if dep.Name == m.Name && m.Name != "" {
+			v.add(field+".name", "package cannot have a %s relationship with itself", dep.Relationship)
+		}
+		if dep.Relationship.String() == "" {
+			v.add(field+".relation", "unknown relationship %d", dep.Relationship)
+		}
+		if dep.Requires != Required(0) {
+			if dep.Requires.String() == "" {
+				v.add(field+".requires", "unknown version requirement %d", dep.Requires)
+			}
+			v.checkVersion(field+".version", dep.Version)
+		}
+
+		for j, other := range m.Dependencies[:i] {
+			if other.Name != dep.Name {
+				continue
+			}
+			if other.Relationship == dep.Relationship && other.Requires == dep.Requires && other.Version.Compare(&dep.Version) == 0 {
+				v.add(field, "duplicate dependency %s, also listed as depends[%d]", dep, j)
+			} else if contradicts(dep, other) || contradicts(other, dep) {
+				v.add(field, "%s %s contradicts %s %s of depends[%d]", dep.Relationship, dep, other.Relationship, other, j)
+			}
+		}
+	}
+}
+
+// contradicts checks if a depends or predepends relationship can never be satisfied because of a conflicts or
+// breaks relationship with the same package, either because the conflict applies to every version or because the
+// only acceptable version conflicts
+func contradicts(positive, negative *Dependency) bool {
+	if (positive.Relationship != Depends && positive.Relationship != Predepends) ||
+		(negative.Relationship != Conflicts && negative.Relationship != Breaks) {
+		return false
+	}
+	return negative.Requires == Required(0) ||
+		(positive.Requires == RequiresEqual && Satisfies(*negative, positive.Version))
+}
+
+func (m *Manifest) validateFiles(v *manifestValidator) {
+	paths := map[string]int{}
+	for i, file := range m.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		if err := validAbsolutePath(file.Path); err != nil || file.Path == "/" {
+			v.add(field+".path", "path %q must be an absolute and clean file path", file.Path)
+		}
+		if j, found := paths[file.Path]; found {
+			v.add(field+".path", "duplicate path %s, also listed as files[%d]", file.Path, j)
+		}
+		paths[file.Path] = i
+
+		if file.Type != FileType(0) && file.Type.String() == "" {
+			v.add(field+".type", "unknown file type %d", file.Type)
+		}
+		if !sha256Pattern.MatchString(file.SHA256) {
+			v.add(field+".hash", "hash %q must be a lower case hex encoded SHA256 hash", file.SHA256)
+		}
+		if file.Mode < 0 || file.Mode > 07777 {
+			v.add(field+".mode", "mode %o is out of range", file.Mode)
+		}
+	}
+}
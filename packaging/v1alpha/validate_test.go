@@ -0,0 +1,106 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestValidate(t *testing.T) {
+	m := testManifest()
+	m.Files = Files{{Path: "/etc/test.conf", Type: ConfigurationFile, SHA256: hashOf("key=value\n"), Mode: 0644}}
+	m.Dependencies = Dependencies{
+		{Name: "libc", Relationship: Depends, Requires: RequiresGreaterThanEqual, Version: common.Version{Major: 2}},
+		{Name: "libc", Relationship: Breaks, Requires: RequiresLessThan, Version: common.Version{Major: 2}},
+	}
+	m.Actions = Actions{{Type: Install, After: ActionItems{{Values: &CommandAction{Command: []string{"true"}}}}}}
+	m.Triggers = Triggers{{Events: []string{"ldconfig"}, Items: ActionItems{{Values: &CommandAction{Command: []string{"ldconfig"}}}}}}
+	m.Activates = []string{"ldconfig"}
+	assert.NoError(t, m.Validate())
+
+	m = testManifest()
+	m.Name = ""
+	m.Version = common.Version{Major: -1}
+	m.Metadata.Architectures = common.Architectures{common.AMD64, common.AMD64, common.Architecture(99)}
+	m.Metadata.Items = []*MetadataItem{{Key: "maintainer"}, {Key: ""}, {Key: "maintainer"}}
+	m.Dependencies = Dependencies{
+		{Name: "libc", Relationship: Depends},
+		{Name: "libc", Relationship: Conflicts},
+		{Name: "libc", Relationship: Depends},
+		{Name: "foo", Relationship: Predepends, Requires: RequiresEqual, Version: common.Version{Major: 1}},
+		{Name: "foo", Relationship: Breaks, Requires: RequiresLessThan, Version: common.Version{Major: 2}},
+		{Name: "Bad", Relationship: Relationship(42), Requires: Required(6)},
+	}
+	m.Files = Files{
+		{Path: "/etc/test.conf", SHA256: "abc"},
+		{Path: "etc/../test", SHA256: hashOf(""), Mode: 010000},
+		{Path: "/etc/test.conf", Type: FileType(9), SHA256: hashOf("")},
+	}
+	m.Actions = Actions{{Before: ActionItems{{}}}, {Type: Install}, {Type: Install}}
+	m.Triggers = Triggers{{Paths: []string{"relative"}}, {}}
+	m.Activates = []string{"Not An Event"}
+	m.Plugins = Plugins{{Name: "ok"}, {}}
+
+	err := m.Validate()
+	if !assert.IsType(t, &ManifestValidationError{}, err) {
+		return
+	}
+	var fields []string
+	for _, f := range err.(*ManifestValidationError).Fields {
+		fields = append(fields, f.Field)
+	}
+	assert.Equal(t, []string{
+		"name",
+		"version",
+		"metadata.arch[1]",
+		"metadata.arch[2]",
+		"metadata.items[1].key",
+		"metadata.items[2].key",
+		"depends[1]",
+		"depends[2]",
+		"depends[2]",
+		"depends[4]",
+		"depends[5].name",
+		"depends[5].relation",
+		"depends[5].requires",
+		"files[0].hash",
+		"files[1].path",
+		"files[1].mode",
+		"files[2].path",
+		"files[2].type",
+		"actions[0].type",
+		"actions[0].before[0].action",
+		"actions[2].type",
+		"triggers[0].paths[0]",
+		"triggers[1]",
+		"activates[0]",
+		"plugins[1].name",
+	}, fields)
+	assert.Contains(t, err.Error(), "invalid manifest:\n  name: name is required\n")
+	assert.Contains(t, err.Error(), "files[2].path: duplicate path /etc/test.conf, also listed as files[0]")
+
+	m = testManifest()
+	m.VersionScheme = common.DebianVersioning
+	m.Version = common.Version{Major: 1, Minor: 2, Scheme: common.SemanticVersioning}
+	assert.EqualError(t, m.Validate(), "invalid manifest:\n  version: version v1.2.0 uses semver versioning instead of debian versioning")
+
+	m = testManifest()
+	m.Dependencies = Dependencies{{Name: "test", Relationship: Depends}}
+	assert.EqualError(t, m.Validate(), "invalid manifest:\n  depends[0].name: package cannot have a depends relationship with itself")
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/limejuice-cc/api/pkg/limejuiceerrors"
+)
+
+// VerificationProblem is a mismatch between the manifest, the index and the contents of a package
+type VerificationProblem struct {
+	Path     string                  `yaml:"path" json:"path"`                             // Path is the path of the file
+	Kind     VerificationProblemKind `yaml:"kind" json:"kind"`                             // Kind is the kind of problem
+	Expected string                  `yaml:"expected,omitempty" json:"expected,omitempty"` // Expected is the expected value
+	Actual   string                  `yaml:"actual,omitempty" json:"actual,omitempty"`     // Actual is the actual value
+}
+
+// String implements the Stringer interface.
+func (p *VerificationProblem) String() string {
+	switch p.Kind {
+	case SizeMismatch, HashMismatch:
+		return fmt.Sprintf("%s: %s mismatch, expected %s got %s", p.Path, p.Kind, p.Expected, p.Actual)
+	case UnreadableFile:
+		return fmt.Sprintf("%s: unreadable: %s", p.Path, p.Actual)
+	case UnverifiedSignature:
+		return fmt.Sprintf("unverified signature: %s", p.Actual)
+	default:
+		return fmt.Sprintf("%s: %s", p.Path, p.Kind)
+	}
+}
+
+// VerificationReport lists all problems found while verifying a package
+type VerificationReport struct {
+	Problems []*VerificationProblem `yaml:"problems,omitempty" json:"problems,omitempty"` // Problems are the problems found
+}
+
+func (r *VerificationReport) add(path string, kind VerificationProblemKind, expected, actual string) {
+	r.Problems = append(r.Problems, &VerificationProblem{Path: path, Kind: kind, Expected: expected, Actual: actual})
+}
+
+// OK returns true if no problems were found
+func (r *VerificationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns a VerificationError if any problems were found
+func (r *VerificationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	err := &VerificationError{Report: r}
+	lines := make([]string, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		lines = append(lines, p.String())
+	}
+	err.Message = fmt.Sprintf("package verification failed: %s", strings.Join(lines, "; "))
+	return err
+}
+
+// VerificationError is an error that occurs when package verification fails
+type VerificationError struct {
+	limejuiceerrors.LimeJuiceError
+	Report *VerificationReport
+}
+
+// VerifyContents cross checks every file listed in the manifest against the index and the file contents. All
+// problems are reported rather than only the first. If the package signature cannot be verified by the configured
+// verifier only that problem is reported and the contents are not checked.
+func (p *PackageReader) VerifyContents() *VerificationReport {
+	report := &VerificationReport{}
+	if err := p.header.checkVerified(); err != nil {
+		report.add("", UnverifiedSignature, "", err.Error())
+		return report
+	}
+	manifest, index := p.header.manifest, p.header.index
+
+	listed := map[string]bool{}
+	for _, file := range manifest.Files {
+		if listed[file.Path] {
+			report.add(file.Path, DuplicateFile, "", "")
+		}
+		listed[file.Path] = true
+	}
+
+	indexed := map[string]bool{}
+	for i := range index.Files {
+		entry := &index.Files[i]
+		if indexed[entry.Path] {
+			report.add(entry.Path, DuplicateFile, "", "")
+			continue
+		}
+		indexed[entry.Path] = true
+		if !listed[entry.Path] {
+			report.add(entry.Path, UnlistedFile, "", "")
+		}
+	}
+
+	for _, file := range manifest.Files {
+		entry, found := p.Lookup(file.Path)
+		if !found {
+			report.add(file.Path, MissingFile, "", "")
+			continue
+		}
+
+		size, hash, err := p.hashEntry(entry)
+		if err != nil {
+			report.add(file.Path, UnreadableFile, "", err.Error())
+			continue
+		}
+		if size != entry.Size {
+			report.add(file.Path, SizeMismatch, strconv.FormatInt(entry.Size, 10), strconv.FormatInt(size, 10))
+		}
+		if hash != file.SHA256 {
+			report.add(file.Path, HashMismatch, file.SHA256, hash)
+		}
+	}
+
+	return report
+}
+
+// hashEntry returns the size and SHA256 hash of the decompressed contents of an index entry
+func (p *PackageReader) hashEntry(entry *LimePackageFileIndexEntry) (int64, string, error) {
+	r, err := p.openEntry(entry)
+	if err != nil {
+		return 0, "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
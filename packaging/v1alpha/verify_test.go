@@ -0,0 +1,90 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestVerifyContents(t *testing.T) {
+	w := NewPackageWriter(testManifest())
+	for _, path := range []string{"/a", "/b", "/c"} {
+		assert.NoError(t, w.AddFile(&File{Path: path}, strings.NewReader("contents of "+path)))
+	}
+	raw, err := w.Build()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	open := func(raw *RawLimePackage) *PackageReader {
+		var out bytes.Buffer
+		_, err := raw.WriteTo(&out)
+		assert.NoError(t, err)
+		p, err := OpenPackage(bytes.NewReader(out.Bytes()), int64(out.Len()))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return p
+	}
+
+	report := open(raw).VerifyContents()
+	assert.True(t, report.OK())
+	assert.NoError(t, report.Err())
+
+	p := open(raw)
+	p.SetVerifier(NewPackageVerifier(newTestCertificate(t, "root", nil)))
+	report = p.VerifyContents()
+	if assert.Len(t, report.Problems, 1) {
+		assert.Equal(t, UnverifiedSignature, report.Problems[0].Kind)
+		assert.Equal(t, "unverified signature: package is not signed", report.Problems[0].String())
+	}
+
+	var manifest Manifest
+	assert.NoError(t, yaml.Unmarshal(raw.Manifest, &manifest))
+	manifest.Files[0].SHA256 = hashOf("other contents")
+	manifest.Files = append(manifest.Files[:2], &File{Path: "/d"}, &File{Path: "/a"})
+	raw.Manifest, err = yaml.Marshal(&manifest)
+	assert.NoError(t, err)
+	raw.ManifestLength = encodeLength(int64(len(raw.Manifest)))
+
+	var index LimePackageFileIndex
+	assert.NoError(t, yaml.Unmarshal(raw.Index, &index))
+	index.Files[1].Size++
+	raw.Index, err = yaml.Marshal(&index)
+	assert.NoError(t, err)
+	raw.IndexLength = encodeLength(int64(len(raw.Index)))
+
+	report = open(raw).VerifyContents()
+	assert.False(t, report.OK())
+	problems := map[VerificationProblemKind][]string{}
+	for _, p := range report.Problems {
+		problems[p.Kind] = append(problems[p.Kind], p.Path)
+	}
+	assert.Equal(t, []string{"/a"}, problems[DuplicateFile])
+	assert.Equal(t, []string{"/c"}, problems[UnlistedFile])
+	assert.Equal(t, []string{"/d"}, problems[MissingFile])
+	assert.Equal(t, []string{"/b"}, problems[SizeMismatch])
+	assert.Equal(t, []string{"/a", "/a"}, problems[HashMismatch])
+
+	err = report.Err()
+	if assert.IsType(t, &VerificationError{}, err) {
+		assert.Contains(t, err.Error(), "/d: missing")
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/limejuice-cc/api/helper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// indexCacheMetadataFileName is the file name of the cached index metadata
+	indexCacheMetadataFileName = "index.meta.yaml"
+	// packageCacheDirectory is the cache subdirectory containing downloaded packages
+	packageCacheDirectory = "packages"
+	// partialDownloadExtension is the file extension of partially downloaded packages
+	partialDownloadExtension = ".part"
+)
+
+// indexCacheMetadata is the metadata used to revalidate a cached index
+type indexCacheMetadata struct {
+	ETag         string `yaml:"etag,omitempty"`         // ETag is the entity tag of the cached index
+	LastModified string `yaml:"lastModified,omitempty"` // LastModified is the last modified date of the cached index
+}
+
+// HTTPRepository is a repository served over HTTP or HTTPS. The index and downloaded packages are cached in a local
+// directory, the index is revalidated using ETag and If-Modified-Since and interrupted package downloads are resumed
+// using range requests.
+type HTTPRepository struct {
+	baseURL  *url.URL
+	cacheDir string
+	client   *http.Client
+}
+
+// NewHTTPRepository creates a new HTTPRepository for the repository at baseURL that caches in cacheDir. If client is
+// nil http.DefaultClient is used.
+func NewHTTPRepository(baseURL string, cacheDir string, client *http.Client) (*HTTPRepository, error) {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported repository url scheme %s", u.Scheme)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if err = os.MkdirAll(filepath.Join(cacheDir, packageCacheDirectory), 0755); err != nil {
+		return nil, err
+	}
+	return &HTTPRepository{baseURL: u, cacheDir: cacheDir, client: client}, nil
+}
+
+func (r *HTTPRepository) resolve(path string) (string, error) {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	return r.baseURL.ResolveReference(ref).String(), nil
+}
+
+// Index fetches the repository index, using the cached index if it has not been modified
+func (r *HTTPRepository) Index() (*Index, error) {
+	indexPath := filepath.Join(r.cacheDir, IndexFileName)
+	metadataPath := filepath.Join(r.cacheDir, indexCacheMetadataFileName)
+
+	metadata := &indexCacheMetadata{}
+	cached, err := ioutil.ReadFile(indexPath)
+	if err == nil {
+		if raw, err := ioutil.ReadFile(metadataPath); err == nil {
+			_ = yaml.Unmarshal(raw, metadata)
+		}
+	}
+
+	u, err := r.resolve(IndexFileName)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if metadata.ETag != "" {
+			req.Header.Set("If-None-Match", metadata.ETag)
+		}
+		if metadata.LastModified != "" {
+			req.Header.Set("If-Modified-Since", metadata.LastModified)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var raw []byte
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		raw = cached
+	case resp.StatusCode == http.StatusOK:
+		if raw, err = ioutil.ReadAll(resp.Body); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected status %s fetching %s", resp.Status, u)
+	}
+
+	index := &Index{}
+	if err = yaml.Unmarshal(raw, index); err != nil {
+		return nil, fmt.Errorf("cannot decode repository index: %s", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		metadata = &indexCacheMetadata{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		encoded, err := yaml.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		if err = helper.WriteFileAtomic(indexPath, raw, 0644); err != nil {
+			return nil, err
+		}
+		if err = helper.WriteFileAtomic(metadataPath, encoded, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// Fetch opens the package with the given SHA256 digest, downloading it to the cache if necessary
+func (r *HTTPRepository) Fetch(digest string) (io.ReadCloser, error) {
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid package digest %s", digest)
+	}
+
+	path := filepath.Join(r.cacheDir, packageCacheDirectory, digest+PackageExtension)
+	if f := openCached(path, digest); f != nil {
+		return f, nil
+	}
+
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+	entry, found := index.Lookup(digest)
+	if !found {
+		return nil, fmt.Errorf("package %s not found", digest)
+	}
+	if err = r.download(entry, path); err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// openCached opens the cached package at path if its SHA256 hash matches digest. A cached package that does not
+// match is removed, so that it is downloaded again.
+func openCached(path, digest string) *os.File {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err == nil && hex.EncodeToString(h.Sum(nil)) == digest {
+		if _, err = f.Seek(0, io.SeekStart); err == nil {
+			return f
+		}
+	}
+	f.Close()
+	os.Remove(path)
+	return nil
+}
+
+// download downloads a package to path, resuming a previous partial download and verifying its digest
+func (r *HTTPRepository) download(entry *IndexEntry, path string) error {
+	partial := path + partialDownloadExtension
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if offset < entry.Size {
+		if err = r.downloadRange(entry, f, offset); err != nil {
+			return err
+		}
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); size != entry.Size || actual != entry.SHA256 {
+		f.Close()
+		os.Remove(partial)
+		return fmt.Errorf("downloaded package %s has size %d and hash %s, expected %d and %s", entry.Path, size, actual, entry.Size, entry.SHA256)
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// downloadRange downloads a package starting at offset and appends it to f
+func (r *HTTPRepository) downloadRange(entry *IndexEntry, f *os.File, offset int64) error {
+	u, err := r.resolve(entry.Path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("unexpected content range %s fetching %s", resp.Header.Get("Content-Range"), u)
+		}
+	case http.StatusOK:
+		if err = f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unexpected status %s fetching %s", resp.Status, u)
+	}
+
+	_, err = io.Copy(f, io.LimitReader(resp.Body, entry.Size))
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testServer struct {
+	sync.Mutex
+	dir      string
+	requests []*http.Request
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	s.requests = append(s.requests, r)
+	s.Unlock()
+
+	path := filepath.Join(s.dir, filepath.FromSlash(strings.TrimPrefix(r.URL.Path, "/repo/")))
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", `"`+info.ModTime().String()+`"`)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (s *testServer) last() *http.Request {
+	s.Lock()
+	defer s.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func TestHTTPRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repository")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	repoDir, cacheDir := filepath.Join(dir, "repo"), filepath.Join(dir, "cache")
+
+	writeTestPackage(t, filepath.Join(repoDir, "lib", "lib-1.0.0.lime"), "lib", "1.0.0", nil)
+	writeTestPackage(t, filepath.Join(repoDir, "lib", "lib-1.1.0.lime"), "lib", "1.1.0", nil)
+	if _, err = NewLocalRepository(repoDir).UpdateIndex(); !assert.NoError(t, err) {
+		return
+	}
+
+	handler := &testServer{dir: repoDir}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	_, err = NewHTTPRepository("ftp://localhost/repo", cacheDir, nil)
+	assert.Error(t, err)
+
+	r, err := NewHTTPRepository(server.URL+"/repo", cacheDir, server.Client())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	index, err := r.Index()
+	if !assert.NoError(t, err) || !assert.Len(t, index.Packages, 2) {
+		return
+	}
+	assert.Equal(t, "/repo/index.yaml", handler.last().URL.Path)
+	assert.Empty(t, handler.last().Header.Get("If-None-Match"))
+
+	index, err = r.Index()
+	if assert.NoError(t, err) {
+		assert.Len(t, index.Packages, 2)
+		assert.NotEmpty(t, handler.last().Header.Get("If-None-Match"))
+		assert.NotEmpty(t, handler.last().Header.Get("If-Modified-Since"))
+	}
+
+	entry, _ := index.Latest("lib", common.AMD64)
+	raw, err := ioutil.ReadFile(filepath.Join(repoDir, "lib", "lib-1.1.0.lime"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	partial := filepath.Join(cacheDir, packageCacheDirectory, entry.SHA256+PackageExtension+partialDownloadExtension)
+	assert.NoError(t, ioutil.WriteFile(partial, raw[:10], 0644))
+
+	f, err := r.Fetch(entry.SHA256)
+	if assert.NoError(t, err) {
+		downloaded, err := ioutil.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, raw, downloaded)
+		assert.NoError(t, f.Close())
+		assert.Equal(t, "/repo/lib/lib-1.1.0.lime", handler.last().URL.Path)
+		assert.Equal(t, "bytes=10-", handler.last().Header.Get("Range"))
+	}
+
+	count := len(handler.requests)
+	f, err = r.Fetch(entry.SHA256)
+	if assert.NoError(t, err) {
+		assert.NoError(t, f.Close())
+		assert.Equal(t, count, len(handler.requests))
+	}
+
+	cached := filepath.Join(cacheDir, packageCacheDirectory, entry.SHA256+PackageExtension)
+	for _, contents := range [][]byte{raw[:len(raw)/2], append([]byte{raw[0] ^ 0xff}, raw[1:]...)} {
+		assert.NoError(t, ioutil.WriteFile(cached, contents, 0644))
+		f, err = r.Fetch(entry.SHA256)
+		if assert.NoError(t, err) {
+			downloaded, err := ioutil.ReadAll(f)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, downloaded)
+			assert.NoError(t, f.Close())
+			assert.Equal(t, "/repo/lib/lib-1.1.0.lime", handler.last().URL.Path)
+		}
+	}
+
+	entry = index.Packages[0]
+	corrupt := append([]byte{}, raw[:20]...)
+	corrupt[0] ^= 0xff
+	partial = filepath.Join(cacheDir, packageCacheDirectory, entry.SHA256+PackageExtension+partialDownloadExtension)
+	assert.NoError(t, ioutil.WriteFile(partial, corrupt, 0644))
+	_, err = r.Fetch(entry.SHA256)
+	assert.Error(t, err)
+	_, err = os.Stat(partial)
+	assert.True(t, os.IsNotExist(err))
+
+	f, err = r.Fetch(entry.SHA256)
+	if assert.NoError(t, err) {
+		assert.NoError(t, f.Close())
+	}
+
+	_, err = r.Fetch("invalid")
+	assert.Error(t, err)
+	_, err = r.Fetch(strings.Repeat("0", 64))
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/limejuice-cc/api/helper"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+	"gopkg.in/yaml.v3"
+)
+
+// LocalRepository is a repository stored in a local directory containing lime packages and an index file
+type LocalRepository struct {
+	dir string
+}
+
+// NewLocalRepository creates a new LocalRepository for dir
+func NewLocalRepository(dir string) *LocalRepository {
+	return &LocalRepository{dir: dir}
+}
+
+// Dir returns the repository directory
+func (r *LocalRepository) Dir() string {
+	return r.dir
+}
+
+// Index reads the repository index
+func (r *LocalRepository) Index() (*Index, error) {
+	raw, err := ioutil.ReadFile(filepath.Join(r.dir, IndexFileName))
+	if err != nil {
+		return nil, err
+	}
+	index := &Index{}
+	if err = yaml.Unmarshal(raw, index); err != nil {
+		return nil, fmt.Errorf("cannot decode repository index: %s", err)
+	}
+	return index, nil
+}
+
+// UpdateIndex scans the repository directory for lime packages and writes a new index
+func (r *LocalRepository) UpdateIndex() (*Index, error) {
+	index, err := IndexDirectory(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := yaml.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	if err = helper.WriteFileAtomic(filepath.Join(r.dir, IndexFileName), raw, 0644); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Fetch opens the package with the given SHA256 digest
+func (r *LocalRepository) Fetch(digest string) (io.ReadCloser, error) {
+	index, err := r.Index()
+	if err != nil {
+		return nil, err
+	}
+	entry, found := index.Lookup(digest)
+	if !found {
+		return nil, fmt.Errorf("package %s not found", digest)
+	}
+	return os.Open(filepath.Join(r.dir, filepath.FromSlash(entry.Path)))
+}
+
+// IndexDirectory creates an index of the lime packages in dir and its subdirectories
+func IndexDirectory(dir string) (*Index, error) {
+	index := &Index{Generated: time.Now().UTC()}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), PackageExtension) {
+			return nil
+		}
+		entry, err := indexPackage(path, info.Size())
+		if err != nil {
+			return fmt.Errorf("cannot index %s: %s", path, err)
+		}
+		if entry.Path, err = filepath.Rel(dir, path); err != nil {
+			return err
+		}
+		entry.Path = filepath.ToSlash(entry.Path)
+		index.Packages = append(index.Packages, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	index.sort()
+	return index, nil
+}
+
+// indexPackage creates the index entry of the package at path
+func indexPackage(path string, size int64) (*IndexEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := pkg.OpenPackage(f, size)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, io.NewSectionReader(f, 0, size)); err != nil {
+		return nil, err
+	}
+
+	m := p.Manifest()
+	return &IndexEntry{
+		Name:          m.Name,
+		Version:       m.Version,
+		VersionScheme: m.VersionScheme,
+		Architectures: m.Metadata.Architectures,
+		Dependencies:  m.Dependencies,
+		Size:          size,
+		SHA256:        hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestPackage(t *testing.T, path string, name string, version string, arch common.Architectures, deps ...*pkg.Dependency) {
+	v, err := common.ParseVersion(version)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	m := &pkg.Manifest{Name: pkg.PackageName(name), Version: *v, Created: time.Now(), Dependencies: deps}
+	m.Metadata.Architectures = arch
+	w := pkg.NewPackageWriter(m)
+	assert.NoError(t, w.AddFile(&pkg.File{Path: "/usr/share/" + name}, strings.NewReader(name+" "+version)))
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	_, err = w.WriteTo(f)
+	assert.NoError(t, err)
+}
+
+func TestLocalRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repository")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestPackage(t, filepath.Join(dir, "app-1.0.0.lime"), "app", "1.0.0", common.Architectures{common.AMD64},
+		&pkg.Dependency{Name: "lib", Relationship: pkg.Depends})
+	writeTestPackage(t, filepath.Join(dir, "lib", "lib-1.0.0.lime"), "lib", "1.0.0", nil)
+	writeTestPackage(t, filepath.Join(dir, "lib", "lib-1.1.0.lime"), "lib", "1.1.0", nil)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a package"), 0644))
+
+	r := NewLocalRepository(dir)
+	_, err = r.Index()
+	assert.Error(t, err)
+
+	_, err = r.UpdateIndex()
+	if !assert.NoError(t, err) {
+		return
+	}
+	index, err := r.Index()
+	if !assert.NoError(t, err) || !assert.Len(t, index.Packages, 3) {
+		return
+	}
+	assert.Equal(t, "app-1.0.0.lime", index.Packages[0].Path)
+	assert.Equal(t, "lib/lib-1.0.0.lime", index.Packages[1].Path)
+
+	latest, found := index.Latest("lib", common.AMD64)
+	if assert.True(t, found) {
+		assert.Equal(t, "v1.1.0", latest.Version.String())
+	}
+	v, _ := common.ParseVersion("1.1.0")
+	assert.Len(t, index.Query(pkg.Dependency{Name: "lib", Requires: pkg.RequiresLessThan, Version: *v}, common.AMD64), 1)
+	assert.Len(t, index.Query(pkg.Dependency{Name: "app"}, common.Architecture(100)), 0)
+
+	resolved, err := pkg.NewResolver(index.Manifests(common.AMD64)...).Resolve("app")
+	if assert.NoError(t, err) {
+		assert.Len(t, resolved, 2)
+	}
+
+	f, err := r.Fetch(latest.SHA256)
+	if assert.NoError(t, err) {
+		defer f.Close()
+		raw, err := ioutil.ReadAll(f)
+		assert.NoError(t, err)
+		sum := sha256.Sum256(raw)
+		assert.Equal(t, latest.SHA256, hex.EncodeToString(sum[:]))
+		assert.Equal(t, latest.Size, int64(len(raw)))
+	}
+	_, err = r.Fetch("missing")
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.lime"), []byte("not a package"), 0644))
+	_, err = r.UpdateIndex()
+	assert.Error(t, err)
+}
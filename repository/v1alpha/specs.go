@@ -0,0 +1,135 @@
+// Copyright 2020 Limejuice-cc Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha
+
+import (
+	"io"
+	"sort"
+	"time"
+
+	common "github.com/limejuice-cc/api/common/v1alpha"
+	pkg "github.com/limejuice-cc/api/packaging/v1alpha"
+)
+
+const (
+	// IndexFileName is the file name of a repository index
+	IndexFileName = "index.yaml"
+	// PackageExtension is the file extension of lime packages
+	PackageExtension = ".lime"
+)
+
+// IndexEntry describes a package in a repository
+type IndexEntry struct {
+	Name          pkg.PackageName      `yaml:"name" json:"name"`                                       // Name is the name of the package
+	Version       common.Version       `yaml:"version,flow" json:"version"`                            // Version is the package version
+	VersionScheme common.VersionScheme `yaml:"versionScheme,omitempty" json:"versionScheme,omitempty"` // VersionScheme is the versioning scheme of the package
+	Architectures common.Architectures `yaml:"arch,omitempty" json:"arch,omitempty"`                   // Architectures are the architectures supported by the package
+	Dependencies  pkg.Dependencies     `yaml:"depends,omitempty" json:"depends,omitempty"`             // Dependencies are the package dependencies
+	Size          int64                `yaml:"size" json:"size"`                                       // Size is the size of the package file
+	SHA256        string               `yaml:"hash" json:"hash"`                                       // SHA256 is the SHA256 hash of the package file
+	Path          string               `yaml:"path" json:"path"`                                       // Path is the path of the package file relative to the repository
+}
+
+// SupportsArchitecture checks if the package can be installed on arch. Packages without architectures are
+// architecture independent.
+func (e *IndexEntry) SupportsArchitecture(arch common.Architecture) bool {
+	if len(e.Architectures) == 0 {
+		return true
+	}
+	for _, a := range e.Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// Manifest returns a manifest describing the package and its dependencies that can be used for dependency
+// resolution
+func (e *IndexEntry) Manifest() *pkg.Manifest {
+	m := &pkg.Manifest{
+		Name:          e.Name,
+		Version:       e.Version,
+		VersionScheme: e.VersionScheme,
+		Dependencies:  e.Dependencies,
+	}
+	m.Metadata.Architectures = e.Architectures
+	return m
+}
+
+// Index lists the packages in a repository
+type Index struct {
+	Generated time.Time     `yaml:"generated" json:"generated"`                   // Generated is the datetime that the index was generated
+	Packages  []*IndexEntry `yaml:"packages,omitempty" json:"packages,omitempty"` // Packages are the packages in the repository
+}
+
+// sort orders the index by package name and version
+func (i *Index) sort() {
+	sort.SliceStable(i.Packages, func(a, b int) bool {
+		pa, pb := i.Packages[a], i.Packages[b]
+		if pa.Name != pb.Name {
+			return pa.Name < pb.Name
+		}
+		return pa.Version.Less(&pb.Version)
+	})
+}
+
+// Query returns the packages that satisfy dep and support arch, highest version first
+func (i *Index) Query(dep pkg.Dependency, arch common.Architecture) []*IndexEntry {
+	var out []*IndexEntry
+	for _, e := range i.Packages {
+		if e.Name == dep.Name && pkg.Satisfies(dep, e.Version) && e.SupportsArchitecture(arch) {
+			out = append(out, e)
+		}
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[b].Version.Less(&out[a].Version) })
+	return out
+}
+
+// Latest returns the highest version of the named package that supports arch
+func (i *Index) Latest(name pkg.PackageName, arch common.Architecture) (*IndexEntry, bool) {
+	found := i.Query(pkg.Dependency{Name: name}, arch)
+	if len(found) == 0 {
+		return nil, false
+	}
+	return found[0], true
+}
+
+// Lookup returns the package with the given SHA256 digest
+func (i *Index) Lookup(digest string) (*IndexEntry, bool) {
+	for _, e := range i.Packages {
+		if e.SHA256 == digest {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Manifests returns manifests for all packages supporting arch that can be used for dependency resolution
+func (i *Index) Manifests(arch common.Architecture) []*pkg.Manifest {
+	var out []*pkg.Manifest
+	for _, e := range i.Packages {
+		if e.SupportsArchitecture(arch) {
+			out = append(out, e.Manifest())
+		}
+	}
+	return out
+}
+
+// Repository is a source of lime packages
+type Repository interface {
+	Index() (*Index, error)
+	Fetch(digest string) (io.ReadCloser, error)
+}